@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/organizations"
+	orgtypes "github.com/aws/aws-sdk-go-v2/service/organizations/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// defaultAccountRole is the role --accounts assumes in each account. AWS Organizations
+// creates it in every account it creates.
+const defaultAccountRole = "OrganizationAccountAccessRole"
+
+// organizationAccounts is the --accounts value that stands for every active account in
+// the organization.
+const organizationAccounts = "org"
+
+// accountCredentials caches the assumed-role credentials per account ID, so that
+// discovery and the session that follows share them.
+var accountCredentials sync.Map
+
+// listInstancesAllAccounts lists the instances of every account given with --accounts:
+// the caller's own account with its credentials, and the others through --account-role.
+// Accounts are searched --fetch-concurrency at a time. Accounts that fail (e.g. the role
+// is missing) or, searched in one region, take longer than --fetch-timeout are reported
+// and skipped.
+func listInstancesAllAccounts(ctx context.Context, cfg aws.Config, opts *options, filters []types.Filter) ([]Instance, error) {
+	accounts, err := resolveAccounts(ctx, cfg, opts.Accounts)
+	if err != nil {
+		return nil, err
+	}
+	identity, err := sts.NewFromConfig(cfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return nil, fmt.Errorf("identifying the current account: %w", describeAPIError(err))
+	}
+	home := aws.ToString(identity.Account)
+	fmt.Fprintf(os.Stderr, "Searching %d accounts as %s...\n", len(accounts), opts.accountRole())
+	accountCredentials.Store(home, cfg.Credentials)
+
+	type accountResult struct {
+		account   string
+		instances []Instance
+		err       error
+	}
+
+	results := make([]accountResult, len(accounts))
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	slots := make(chan struct{}, max(opts.FetchConcurrency, 1))
+	// One progress line covers every account, and with --all-regions their regions too;
+	// lines of their own would overwrite each other.
+	done, regions := 0, 0
+	printProgress := func() {
+		switch {
+		case plainOutput:
+		case opts.AllRegions:
+			fmt.Fprintf(os.Stderr, "\rSearched %d/%d accounts (%d regions)...", done, len(results), regions)
+		default:
+			fmt.Fprintf(os.Stderr, "\rSearched %d/%d accounts...", done, len(results))
+		}
+	}
+	onRegion := func(int, int) {
+		mu.Lock()
+		defer mu.Unlock()
+		regions++
+		printProgress()
+	}
+	for i, account := range accounts {
+		wg.Add(1)
+		go func(i int, account string) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			accountCfg := cfg.Copy()
+			accountCfg.Credentials = assumeAccountRole(cfg, opts, account)
+			var instances []Instance
+			var err error
+			if opts.AllRegions {
+				// Each region is bounded by --fetch-timeout instead.
+				instances, err = listInstancesAllRegions(ctx, accountCfg, filters, opts, onRegion)
+			} else {
+				instances, err = listAccountInstances(ctx, accountCfg, filters, opts)
+			}
+			for j := range instances {
+				instances[j].Account = account
+			}
+			results[i] = accountResult{account: account, instances: instances, err: err}
+
+			mu.Lock()
+			done++
+			printProgress()
+			mu.Unlock()
+		}(i, account)
+	}
+	wg.Wait()
+	fmt.Fprintln(os.Stderr)
+
+	var instances []Instance
+	failed := 0
+	for _, result := range results {
+		if result.err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: skipping account %s: %v\n", result.account, describeAPIError(result.err))
+			failed++
+			continue
+		}
+		instances = append(instances, result.instances...)
+	}
+	if failed == len(results) && failed > 0 {
+		return nil, fmt.Errorf("failed to describe instances in all %d accounts", failed)
+	}
+	return instances, nil
+}
+
+// listAccountInstances lists the instances of one account in the configured region,
+// giving up after --fetch-timeout.
+func listAccountInstances(ctx context.Context, cfg aws.Config, filters []types.Filter, opts *options) ([]Instance, error) {
+	if opts.FetchTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.FetchTimeout)
+		defer cancel()
+	}
+	instances, err := listInstancesWithSSMStatus(ctx, cfg, filters, opts.instanceSources(), nil)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, fmt.Errorf("timed out after %s", opts.FetchTimeout)
+	}
+	return instances, err
+}
+
+// resolveAccounts expands the --accounts list: account IDs as given, or "org" for every
+// active account in the organization.
+func resolveAccounts(ctx context.Context, cfg aws.Config, list []string) ([]string, error) {
+	var accounts []string
+	seen := map[string]bool{}
+	for _, entry := range list {
+		for _, account := range strings.Split(entry, ",") {
+			account = strings.TrimSpace(account)
+			if account == "" || seen[account] {
+				continue
+			}
+			if account != organizationAccounts && !isAccountID(account) {
+				return nil, fmt.Errorf("invalid account '%s': expected a 12-digit account ID or '%s'", account, organizationAccounts)
+			}
+			seen[account] = true
+			if account != organizationAccounts {
+				accounts = append(accounts, account)
+				continue
+			}
+
+			members, err := listOrganizationAccounts(ctx, cfg)
+			if err != nil {
+				return nil, err
+			}
+			for _, member := range members {
+				if !seen[member] {
+					seen[member] = true
+					accounts = append(accounts, member)
+				}
+			}
+		}
+	}
+	return accounts, nil
+}
+
+// listOrganizationAccounts returns the IDs of the active accounts in the organization.
+// Only the management account and delegated administrators may list them.
+func listOrganizationAccounts(ctx context.Context, cfg aws.Config) ([]string, error) {
+	var accounts []string
+	paginator := organizations.NewListAccountsPaginator(organizations.NewFromConfig(cfg), &organizations.ListAccountsInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, withHints(fmt.Errorf("listing the organization's accounts: %w", describeAPIError(err)),
+				"Only the management account or a delegated administrator can list accounts; pass account IDs to --accounts instead.")
+		}
+		for _, account := range page.Accounts {
+			if account.Status == orgtypes.AccountStatusActive {
+				accounts = append(accounts, aws.ToString(account.Id))
+			}
+		}
+	}
+	return accounts, nil
+}
+
+// isAccountID reports whether s looks like an AWS account ID.
+func isAccountID(s string) bool {
+	if len(s) != 12 {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// accountRole returns the name of the role --accounts assumes.
+func (o *options) accountRole() string {
+	if o.AccountRole != "" {
+		return o.AccountRole
+	}
+	return defaultAccountRole
+}
+
+// assumeAccountRole returns credentials for the --account-role role in account, assumed
+// with the credentials of cfg and cached for the rest of the run. The caller's own account
+// is cached with its own credentials by listInstancesAllAccounts.
+func assumeAccountRole(cfg aws.Config, opts *options, account string) aws.CredentialsProvider {
+	if creds, ok := accountCredentials.Load(account); ok {
+		return creds.(aws.CredentialsProvider)
+	}
+	roleARN := fmt.Sprintf("arn:%s:iam::%s:role/%s", regionPartition(cfg.Region), account, opts.accountRole())
+	provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), roleARN, func(o *stscreds.AssumeRoleOptions) {
+		o.RoleSessionName = fmt.Sprintf("aws-ssm-connect-%d", time.Now().Unix())
+	})
+	creds, _ := accountCredentials.LoadOrStore(account, aws.NewCredentialsCache(provider))
+	return creds.(aws.CredentialsProvider)
+}
+
+// targetConfig returns the configuration for acting on inst: cfg in the instance's region
+// and, for an instance found in another account by --accounts, with that account's role.
+func targetConfig(ctx context.Context, cfg aws.Config, opts *options, inst Instance) aws.Config {
+	targetCfg := cfg.Copy()
+	if inst.Region != "" {
+		targetCfg.Region = inst.Region
+	}
+	if inst.Account != "" && len(opts.Accounts) > 0 {
+		if creds, ok := accountCredentials.Load(inst.Account); ok {
+			targetCfg.Credentials = creds.(aws.CredentialsProvider)
+		} else if !isHomeAccount(ctx, cfg, inst.Account) {
+			targetCfg.Credentials = assumeAccountRole(cfg, opts, inst.Account)
+		}
+	}
+	return targetCfg
+}
+
+// isHomeAccount reports whether account is the one the base credentials belong to. The
+// lookup only happens for listings served from the cache, which carry no credentials.
+func isHomeAccount(ctx context.Context, cfg aws.Config, account string) bool {
+	identity, err := sts.NewFromConfig(cfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	return err == nil && aws.ToString(identity.Account) == account
+}
+
+// accountsScope distinguishes cached --accounts listings by the accounts and role used.
+func (o *options) accountsScope() string {
+	sum := sha256.Sum256([]byte(strings.Join(o.Accounts, ",") + "|" + o.accountRole()))
+	return "accounts-" + hex.EncodeToString(sum[:4])
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/nkarisa/homebrew-aws-ssm-connect/pkg/picker"
+	"golang.org/x/term"
+)
+
+// instanceActions are the lifecycle actions of the actions command, in menu order.
+var instanceActions = []string{"start", "stop", "reboot", "terminate"}
+
+// actionsFor returns the actions that make sense for an instance in state; all of them if
+// the state is unknown.
+func actionsFor(state string) []string {
+	switch types.InstanceStateName(state) {
+	case types.InstanceStateNameRunning:
+		return []string{"stop", "reboot", "terminate"}
+	case types.InstanceStateNameStopped:
+		return []string{"start", "terminate"}
+	case "":
+		return instanceActions
+	}
+	// Pending, stopping and shutting-down instances can only be terminated.
+	return []string{"terminate"}
+}
+
+// runActions implements the actions command: pick an EC2 instance and start, stop, reboot
+// or terminate it, choosing the action from a menu or on the command line:
+//
+//	aws-ssm-connect actions --tag Env=dev
+//	aws-ssm-connect actions stop i-0abc
+//
+// Terminating asks twice, the second time for the instance's name or ID to be typed.
+func runActions(ctx context.Context, args []string) int {
+	var opts options
+	var yes bool
+	fs := newFlagSet(findCommand("actions"), &opts)
+	addDiscoveryFlags(fs, &opts)
+	addPickerFlags(fs, &opts)
+	fs.BoolVar(&yes, "yes", false, "don't ask for confirmation of the action given on the command line")
+	addDryRunFlag(fs, &opts)
+
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return flagErrorCode(err)
+	}
+	var action string
+	if len(positional) > 0 && slices.Contains(instanceActions, positional[0]) {
+		action, positional = positional[0], positional[1:]
+	}
+	if len(positional) > 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	if len(positional) == 1 {
+		opts.Target = positional[0]
+	}
+
+	fmt.Println(banner)
+	cfg, target, err := resolveTarget(ctx, &opts)
+	if err != nil {
+		return targetErrorCode(err, &opts)
+	}
+	if !strings.HasPrefix(target.InstanceID, "i-") {
+		return reportError(fmt.Errorf("%s is not an EC2 instance; only EC2 instances can be started, stopped or terminated", target.InstanceID))
+	}
+
+	if action == "" {
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			return reportError(errors.New("no action given; pass start, stop, reboot or terminate when not running in a terminal"))
+		}
+		choices := actionsFor(target.State)
+		state := target.State
+		if state == "" {
+			state = "unknown state"
+		}
+		index, err := picker.Choose(fmt.Sprintf("%s (%s)", hostLabel(target), state), choices, opts.Numbered)
+		if err != nil {
+			return targetErrorCode(err, &opts)
+		}
+		// Chosen from the menu, so it was asked for; only terminate asks again.
+		action = choices[index]
+		yes = action != "terminate"
+	}
+
+	if opts.DryRun {
+		printDryRun("aws", append([]string{"ec2", action + "-instances", "--instance-ids", target.InstanceID}, awsCLIArgs(cfg, &opts)...)...)
+		return exitOK
+	}
+	if err := confirmAction(action, target, yes); err != nil {
+		return targetErrorCode(err, &opts)
+	}
+	if err := applyInstanceAction(ctx, ec2.NewFromConfig(cfg), action, target.InstanceID); err != nil {
+		return reportError(err)
+	}
+	return exitOK
+}
+
+// confirmAction asks before action is applied to target, unless yes is set. Terminate is
+// confirmed twice: with a question, then by typing the instance's name or ID.
+func confirmAction(action string, target Instance, yes bool) error {
+	if yes {
+		return nil
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return withHints(fmt.Errorf("confirmation needed to %s %s", action, target.InstanceID),
+			"Pass --yes when not running in a terminal.")
+	}
+	if action != "terminate" {
+		if !picker.Confirm(fmt.Sprintf("\n%s %s?", strings.ToUpper(action[:1])+action[1:], hostLabel(target)), false) {
+			return errQuit
+		}
+		return nil
+	}
+
+	if !picker.Confirm(fmt.Sprintf("\nTerminate %s? Its instance store and any volumes deleted on termination are lost for good.", hostLabel(target)), false) {
+		return errQuit
+	}
+	fmt.Printf("Type %s to confirm: ", paint(os.Stdout, "warn", hostLabel(target)))
+	input, err := picker.Stdin.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("failed to read input: %w", err)
+	}
+	if answer := strings.TrimSpace(input); answer != hostLabel(target) && answer != target.InstanceID {
+		fmt.Println("That doesn't match; not terminating.")
+		return errQuit
+	}
+	return nil
+}
+
+// applyInstanceAction calls the EC2 API for action and reports the instance's new state.
+func applyInstanceAction(ctx context.Context, client *ec2.Client, action, instanceID string) error {
+	ids := []string{instanceID}
+	var changes []types.InstanceStateChange
+	var err error
+	switch action {
+	case "start":
+		var out *ec2.StartInstancesOutput
+		if out, err = client.StartInstances(ctx, &ec2.StartInstancesInput{InstanceIds: ids}); err == nil {
+			changes = out.StartingInstances
+		}
+	case "stop":
+		var out *ec2.StopInstancesOutput
+		if out, err = client.StopInstances(ctx, &ec2.StopInstancesInput{InstanceIds: ids}); err == nil {
+			changes = out.StoppingInstances
+		}
+	case "reboot":
+		_, err = client.RebootInstances(ctx, &ec2.RebootInstancesInput{InstanceIds: ids})
+	case "terminate":
+		var out *ec2.TerminateInstancesOutput
+		if out, err = client.TerminateInstances(ctx, &ec2.TerminateInstancesInput{InstanceIds: ids}); err == nil {
+			changes = out.TerminatingInstances
+		}
+	}
+	if err != nil {
+		hints := []string{fmt.Sprintf("You are not allowed to call ec2:%sInstances on the instance.", strings.ToUpper(action[:1])+action[1:])}
+		if action == "terminate" {
+			hints = append(hints, "Termination protection may be enabled on the instance (disableApiTermination).")
+		}
+		return withHints(fmt.Errorf("%s %s: %w", action, instanceID, describeAPIError(err)), hints...)
+	}
+
+	if action == "reboot" {
+		fmt.Printf("Rebooting %s.\n", instanceID)
+		return nil
+	}
+	for _, change := range changes {
+		previous, current := "", ""
+		if change.PreviousState != nil {
+			previous = string(change.PreviousState.Name)
+		}
+		if change.CurrentState != nil {
+			current = string(change.CurrentState.Name)
+		}
+		fmt.Printf("%s: %s -> %s\n", aws.ToString(change.InstanceId), previous, paint(os.Stdout, statusRole(current), current))
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// alias is a bookmarked instance. Region is optional; without it the region in effect at
+// connect time is used.
+type alias struct {
+	Instance string `yaml:"instance"`
+	Region   string `yaml:"region,omitempty"`
+}
+
+// aliasFile maps profile names to that profile's aliases. It is stored as aliases.yaml in
+// the config directory:
+//
+//	prod:
+//	  web1:
+//	    instance: i-0abc1234def567890
+//	    region: eu-west-1
+type aliasFile map[string]map[string]alias
+
+func aliasPath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "aliases.yaml"), nil
+}
+
+// loadAliases reads aliases.yaml. A missing file yields no aliases.
+func loadAliases() (aliasFile, error) {
+	aliases := aliasFile{}
+	path, err := aliasPath()
+	if err != nil {
+		return aliases, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return aliases, nil
+	}
+	if err != nil {
+		return aliases, fmt.Errorf("reading %s: %w", path, err)
+	}
+	if err := yaml.Unmarshal(data, &aliases); err != nil {
+		return aliases, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return aliases, nil
+}
+
+func saveAliases(aliases aliasFile) error {
+	path, err := aliasPath()
+	if err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(aliases)
+	if err != nil {
+		return fmt.Errorf("encoding aliases: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("creating %s: %w", filepath.Dir(path), err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	return nil
+}
+
+// isAlias reports whether name is an alias in any profile. The dispatcher uses it before
+// flags (and so the profile) are parsed.
+func isAlias(name string) bool {
+	aliases, _ := loadAliases()
+	for _, byName := range aliases {
+		if _, ok := byName[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// applyAlias replaces an alias given as the target with its instance. The alias is looked
+// up in the profile in effect; without an explicit profile, an alias defined in exactly
+// one other profile is used together with that profile.
+func (o *options) applyAlias() error {
+	if o.Target == "" || instanceIDPattern.MatchString(o.Target) {
+		return nil
+	}
+	aliases, err := loadAliases()
+	if err != nil {
+		return err
+	}
+
+	profile := profileName(o.Profile)
+	a, ok := aliases[profile][o.Target]
+	if !ok && o.Profile == "" && os.Getenv("AWS_PROFILE") == "" {
+		var matches []string
+		for p, byName := range aliases {
+			if _, found := byName[o.Target]; found {
+				matches = append(matches, p)
+			}
+		}
+		if len(matches) > 1 {
+			sort.Strings(matches)
+			return fmt.Errorf("alias '%s' is defined for several profiles (%v); pass --profile", o.Target, matches)
+		}
+		if len(matches) == 1 {
+			profile, a, ok = matches[0], aliases[matches[0]][o.Target], true
+			o.Profile = profile
+		}
+	}
+	if !ok {
+		return withHints(fmt.Errorf("'%s' is neither an instance ID nor an alias of profile %s", o.Target, profile),
+			"List the aliases with 'aws-ssm-connect alias list'.")
+	}
+
+	o.Target = a.Instance
+	if o.Region == "" {
+		o.Region = a.Region
+	}
+	return nil
+}
+
+// runAlias implements the alias command: add, rm and list bookmarks of the profile in effect.
+func runAlias(ctx context.Context, args []string) int {
+	var opts options
+	fs := newFlagSet(findCommand("alias"), &opts)
+
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return flagErrorCode(err)
+	}
+	if len(positional) == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	if err := opts.applyFileConfig(); err != nil {
+		return reportError(err)
+	}
+	aliases, err := loadAliases()
+	if err != nil {
+		return reportError(err)
+	}
+	profile := profileName(opts.Profile)
+
+	switch action, rest := positional[0], positional[1:]; {
+	case action == "add" && len(rest) == 2:
+		name, instanceID := rest[0], rest[1]
+		if !instanceIDPattern.MatchString(instanceID) {
+			return reportError(fmt.Errorf("'%s' is not an instance ID", instanceID))
+		}
+		if instanceIDPattern.MatchString(name) || findCommand(name) != nil {
+			return reportError(fmt.Errorf("'%s' can't be used as an alias: it is an instance ID or command", name))
+		}
+		if aliases[profile] == nil {
+			aliases[profile] = map[string]alias{}
+		}
+		aliases[profile][name] = alias{Instance: instanceID, Region: opts.Region}
+		if err := saveAliases(aliases); err != nil {
+			return reportError(err)
+		}
+		fmt.Printf("Added alias %s -> %s (profile %s).\n", name, instanceID, profile)
+	case action == "rm" && len(rest) == 1:
+		if _, ok := aliases[profile][rest[0]]; !ok {
+			return reportError(fmt.Errorf("no alias '%s' for profile %s", rest[0], profile))
+		}
+		delete(aliases[profile], rest[0])
+		if len(aliases[profile]) == 0 {
+			delete(aliases, profile)
+		}
+		if err := saveAliases(aliases); err != nil {
+			return reportError(err)
+		}
+		fmt.Printf("Removed alias %s (profile %s).\n", rest[0], profile)
+	case action == "list" && len(rest) == 0:
+		names := make([]string, 0, len(aliases[profile]))
+		for name := range aliases[profile] {
+			names = append(names, name)
+		}
+		if len(names) == 0 {
+			fmt.Printf("No aliases for profile %s.\n", profile)
+			return exitOK
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			a := aliases[profile][name]
+			fmt.Printf("%-20s %-20s %s\n", name, a.Instance, a.Region)
+		}
+	default:
+		fs.Usage()
+		return exitUsage
+	}
+	return exitOK
+}
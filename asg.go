@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	"github.com/nkarisa/homebrew-aws-ssm-connect/pkg/picker"
+)
+
+// asgTagKey is the tag EC2 Auto Scaling puts on every instance it launches, naming the group.
+const asgTagKey = "aws:autoscaling:groupName"
+
+// pickAutoScalingGroup lists the Auto Scaling groups in cfg's region and lets the user pick
+// one, for --asg. It returns the group name.
+func pickAutoScalingGroup(ctx context.Context, cfg aws.Config, numbered bool) (string, error) {
+	type group struct {
+		name                      string
+		instances, healthy        int
+		desired, minSize, maxSize int32
+	}
+	var groups []group
+	paginator := autoscaling.NewDescribeAutoScalingGroupsPaginator(autoscaling.NewFromConfig(cfg), &autoscaling.DescribeAutoScalingGroupsInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return "", withHints(fmt.Errorf("describing Auto Scaling groups: %w", describeAPIError(err)),
+				"You are not allowed to call autoscaling:DescribeAutoScalingGroups.")
+		}
+		for _, g := range page.AutoScalingGroups {
+			healthy := 0
+			for _, inst := range g.Instances {
+				if aws.ToString(inst.HealthStatus) == "Healthy" {
+					healthy++
+				}
+			}
+			groups = append(groups, group{
+				name:      aws.ToString(g.AutoScalingGroupName),
+				instances: len(g.Instances),
+				healthy:   healthy,
+				desired:   aws.ToInt32(g.DesiredCapacity),
+				minSize:   aws.ToInt32(g.MinSize),
+				maxSize:   aws.ToInt32(g.MaxSize),
+			})
+		}
+	}
+	if len(groups) == 0 {
+		return "", fmt.Errorf("no Auto Scaling groups found in %s", cfg.Region)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].name < groups[j].name })
+
+	rows := make([]string, len(groups))
+	for i, g := range groups {
+		rows[i] = fmt.Sprintf("%-40s %3d instances, %3d healthy  (desired %d, min %d, max %d)",
+			g.name, g.instances, g.healthy, g.desired, g.minSize, g.maxSize)
+	}
+	index, err := picker.Choose("Select an Auto Scaling group", rows, numbered)
+	if err != nil {
+		return "", err
+	}
+	return groups[index].name, nil
+}
+
+// applyASG narrows the listing to the instances of the Auto Scaling group the user picks,
+// by their group tag.
+func (o *options) applyASG(ctx context.Context, cfg aws.Config) error {
+	if o.AllRegions || len(o.Accounts) > 0 {
+		return errors.New("--asg can't be combined with --all-regions or --accounts")
+	}
+	name, err := pickAutoScalingGroup(ctx, cfg, o.Numbered)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Listing the instances of Auto Scaling group %s.\n", name)
+	o.Tags = append(o.Tags, asgTagKey+"="+name)
+	o.ASG = false // Picked once; refreshes of the listing keep the group.
+	return nil
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// auditEntry is one line of the audit log: a session that was attempted, whether it
+// could be started, and how long it lasted.
+type auditEntry struct {
+	Time      time.Time `json:"time"`
+	User      string    `json:"user"`
+	Profile   string    `json:"profile,omitempty"`
+	Account   string    `json:"account,omitempty"`
+	Region    string    `json:"region"`
+	Instance  string    `json:"instance"`
+	Document  string    `json:"document,omitempty"`
+	SessionID string    `json:"session_id,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	// Result is "ok", "exit N" for a session whose shell exited with status N, or "error".
+	Result   string  `json:"result"`
+	Error    string  `json:"error,omitempty"`
+	Duration float64 `json:"duration_seconds"`
+}
+
+// auditHeader names the fields of auditEntry.record for CSV and TSV output.
+var auditHeader = []string{"time", "user", "profile", "account", "region", "instance", "document", "session_id", "reason", "result", "error", "duration_seconds"}
+
+func (e auditEntry) record() []string {
+	return []string{e.Time.UTC().Format(time.RFC3339), e.User, e.Profile, e.Account, e.Region, e.Instance, e.Document,
+		e.SessionID, e.Reason, e.Result, e.Error, strconv.FormatFloat(e.Duration, 'f', -1, 64)}
+}
+
+func auditPath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "audit.jsonl"), nil
+}
+
+// recordAudit appends a session attempt to the audit log. Unlike the history it is never
+// rewritten, only appended to, so it keeps every attempt; failures to write it are warnings.
+func recordAudit(ctx context.Context, cfg aws.Config, opts *options, input *ssm.StartSessionInput, sessionID string, started time.Time, err error) {
+	entry := auditEntry{
+		Time:      started,
+		User:      localUser(),
+		Profile:   opts.Profile,
+		Region:    cfg.Region,
+		Instance:  aws.ToString(input.Target),
+		Document:  aws.ToString(input.DocumentName),
+		SessionID: sessionID,
+		Reason:    opts.Reason,
+		Result:    "ok",
+		Duration:  time.Since(started).Round(time.Second).Seconds(),
+	}
+	var exitErr *exitStatusError
+	switch {
+	case errors.As(err, &exitErr) && sessionID != "":
+		entry.Result = fmt.Sprintf("exit %d", exitErr.code)
+	case err != nil:
+		entry.Result, entry.Error = "error", err.Error()
+	}
+	_, entry.Account = callerIdentity(context.WithoutCancel(ctx), cfg)
+
+	if err := appendAudit(entry); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: writing the audit log: %v\n", err)
+	}
+}
+
+func appendAudit(entry auditEntry) error {
+	path, err := auditPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// callerIdentity returns the ARN and account of cfg's credentials, or empty strings when
+// they can't be looked up within notifyTimeout.
+func callerIdentity(ctx context.Context, cfg aws.Config) (arn, account string) {
+	ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+	defer cancel()
+	identity, err := sts.NewFromConfig(cfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", ""
+	}
+	return aws.ToString(identity.Arn), aws.ToString(identity.Account)
+}
+
+// auditQuery selects entries of the audit log for the history command.
+type auditQuery struct {
+	instance string
+	profile  string
+	region   string
+	since    time.Duration
+	failed   bool
+	limit    int
+}
+
+func (q auditQuery) matches(e auditEntry) bool {
+	switch {
+	case q.instance != "" && e.Instance != q.instance:
+		return false
+	case q.profile != "" && e.Profile != q.profile:
+		return false
+	case q.region != "" && e.Region != q.region:
+		return false
+	case q.since > 0 && time.Since(e.Time) > q.since:
+		return false
+	case q.failed && e.Result != "error":
+		return false
+	}
+	return true
+}
+
+// readAudit returns the entries of the audit log that match q, oldest first. Lines that
+// don't parse, e.g. one cut short by a crash, are skipped.
+func readAudit(q auditQuery) ([]auditEntry, error) {
+	path, err := auditPath()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading the audit log: %w", err)
+	}
+	defer f.Close()
+
+	var entries []auditEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var e auditEntry
+		if json.Unmarshal(scanner.Bytes(), &e) == nil && q.matches(e) {
+			entries = append(entries, e)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading the audit log: %w", err)
+	}
+	if q.limit > 0 && len(entries) > q.limit {
+		entries = entries[len(entries)-q.limit:]
+	}
+	return entries, nil
+}
+
+// runAuditHistory implements the history command, printing the connections recorded in the
+// audit log:
+//
+//	aws-ssm-connect history --since 24h --failed
+//	aws-ssm-connect history --instance i-0abc --output json
+func runAuditHistory(ctx context.Context, args []string) int {
+	var opts options
+	var q auditQuery
+	output := outputFormat("table")
+	fs := newFlagSet(findCommand("history"), &opts)
+	fs.StringVar(&q.instance, "instance", "", "only show sessions on this instance `id`")
+	fs.DurationVar(&q.since, "since", 0, "only show sessions started within this `duration` (e.g. 24h)")
+	fs.BoolVar(&q.failed, "failed", false, "only show sessions that couldn't be started")
+	fs.IntVar(&q.limit, "limit", 50, "show at most the `n` most recent sessions; 0 shows all")
+	fs.Var(&output, "output", "print the sessions as `format`: "+strings.Join(outputFormats, ", "))
+
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return flagErrorCode(err)
+	}
+	if len(positional) > 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	// --profile and --region filter rather than select credentials here.
+	q.profile, q.region = opts.Profile, opts.Region
+
+	entries, err := readAudit(q)
+	if err != nil {
+		return reportError(err)
+	}
+	if err := writeAudit(os.Stdout, entries, output); err != nil {
+		return reportError(err)
+	}
+	return exitOK
+}
+
+// writeAudit prints audit entries as a table or in a machine-readable format.
+func writeAudit(w *os.File, entries []auditEntry, format outputFormat) error {
+	switch format {
+	case "table":
+		if len(entries) == 0 {
+			fmt.Fprintln(w, "No sessions recorded.")
+			return nil
+		}
+		fmt.Fprintln(w, paint(w, "header", fmt.Sprintf("%-20s %-20s %-15s %-12s %-15s %-10s %-9s %s", "TIME", "INSTANCE", "PROFILE", "ACCOUNT", "REGION", "DURATION", "RESULT", "REASON")))
+		for _, e := range entries {
+			result := fmt.Sprintf("%-9s", e.Result)
+			if e.Result == "error" {
+				result = paint(w, "bad", result)
+			}
+			reason := e.Reason
+			if e.Error != "" {
+				reason = e.Error
+			}
+			fmt.Fprintf(w, "%-20s %-20s %-15s %-12s %-15s %-10s %s %s\n", e.Time.Local().Format("2006-01-02 15:04:05"), e.Instance,
+				padCell(e.Profile, 15), e.Account, e.Region, time.Duration(e.Duration)*time.Second, result, reason)
+		}
+		return nil
+	case "json":
+		if entries == nil {
+			entries = []auditEntry{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(entries)
+	case "csv", "tsv":
+		cw := csv.NewWriter(w)
+		if format == "tsv" {
+			cw.Comma = '\t'
+		}
+		cw.Write(auditHeader)
+		for _, e := range entries {
+			cw.Write(e.record())
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+	return fmt.Errorf("unsupported output format %q", format)
+}
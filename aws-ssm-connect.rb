@@ -13,7 +13,8 @@ class AwsSsmConnect < Formula
 
   def install
     # Build the binary using the version tag
-    system "go", "build", "-ldflags", "-s -w", "-o", bin/"aws-ssm-connect", "."
+    ldflags = "-s -w -X main.version=#{version} -X main.date=#{time.iso8601}"
+    system "go", "build", "-ldflags", ldflags, "-o", bin/"aws-ssm-connect", "."
   end
 
   # Test that the binary runs and displays help text
@@ -1,191 +1,635 @@
 package main
 
 import (
-	"bufio"
-	"encoding/json"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
-	"strconv"
+	"regexp"
+	"slices"
 	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/smithy-go"
+	"github.com/nkarisa/homebrew-aws-ssm-connect/pkg/inventory"
+	"github.com/nkarisa/homebrew-aws-ssm-connect/pkg/picker"
 )
 
-// Instance represents the structure of the data returned by the JMESPath query.
-type Instance struct {
-	InstanceID       string `json:"InstanceId"`
-	Name             string `json:"Name"`
-	PrivateIPAddress string `json:"PrivateIpAddress"`
+// This program lists EC2 instances using the AWS SDK for Go, and allows the user
+// to select an instance to start an SSM session on. See printUsage for the subcommands.
+func main() {
+	os.Exit(run(context.Background(), os.Args[1:]))
 }
 
-// This program executes the AWS CLI command to list EC2 instances, parses the
-// results, and allows the user to select an instance for detail viewing or SSM session.
-func main() {
-	fmt.Println("--- AWS EC2 Instance Lister (Interactive Selection) ---")
+// Exit codes shared by all subcommands. Failures that wrapper scripts commonly need to
+// tell apart get their own code (see errorKindOf); exec and sessions exit with the remote
+// command's status instead, which may coincide with them.
+const (
+	exitOK            = 0
+	exitError         = 1
+	exitUsage         = 2
+	exitCredentials   = 3
+	exitMissingTool   = 4
+	exitNoInstances   = 5
+	exitPermission    = 6
+	exitTargetOffline = 7
+)
 
-	// The JMESPath query is used to flatten the Reservations and Instances arrays
-	// and select the required fields. The output must be JSON for programmatic parsing.
-	const instanceQuery = "Reservations[*].Instances[*].{InstanceId:InstanceId,Name:Tags[?Key==`Name`].Value | [0],PrivateIpAddress:PrivateIpAddress}"
+// Build metadata, set at release time with
+//
+//	go build -ldflags "-X main.version=v1.2.3 -X main.commit=$(git rev-parse HEAD) -X main.date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Builds without them fall back to the VCS information the Go toolchain embeds.
+var (
+	version = "dev"
+	commit  = ""
+	date    = ""
+)
 
-	args := []string{
-		"ec2",
-		"describe-instances",
-		"--query", instanceQuery,
-		"--output", "json", // Output is JSON for programmatic parsing
-	}
+// command is a single aws-ssm-connect subcommand.
+type command struct {
+	name    string
+	usage   string
+	summary string
+	run     func(ctx context.Context, args []string) int
+}
 
-	// Check if the user provided an AWS Profile argument
-	profile := getProfileFromArgs()
-	if profile != "" {
-		fmt.Printf("Using AWS Profile: %s\n", profile)
-		args = append(args, "--profile", profile)
-	} else {
-		fmt.Println("No profile specified. Using the default profile/active environment.")
-	}
+// commands lists the subcommands in the order they appear in the help text. It is filled
+// in by init because runHelp refers back to it.
+var commands []*command
 
-	// 1. Execute the command and capture output
-	cmd := exec.Command("aws", args...)
-	output, err := cmd.Output()
+func init() {
+	commands = []*command{
+		{name: "connect", usage: "connect [instanceId] [flags]", summary: "Pick an instance and start an interactive SSM session (default)", run: runConnect},
+		{name: "tui", usage: "tui [flags]", summary: "Browse instances full-screen and connect, returning to the list after each session", run: runTUI},
+		{name: "list", usage: "list [flags]", summary: "List instances without prompting", run: runList},
+		{name: "forward", usage: "forward -L localPort:[remoteHost:]remotePort... | --socks port [instanceId] [flags]", summary: "Forward a local port through an instance", run: runForward},
+		{name: "tunnels", usage: "tunnels [list] | stop <id>|--all [flags]", summary: "List or stop the tunnels started with 'forward --background'", run: runTunnels},
+		{name: "rdp", usage: "rdp [instanceId] [flags]", summary: "Tunnel Remote Desktop to a Windows instance", run: runRdp},
+		{name: "db", usage: "db [instanceId] [flags]", summary: "Tunnel to an RDS or Aurora database through an instance", run: runDb},
+		{name: "exec", usage: "exec [instanceId] [flags] -- command [args...]", summary: "Run a command on one or more instances and print the output", run: runExec},
+		{name: "run", usage: "run [instanceId] --script file [flags]", summary: "Run a local script on instances and save each one's output", run: runScript},
+		{name: "broadcast", usage: "broadcast [flags]", summary: "Type into shells on several instances at once, cluster-ssh style", run: runBroadcast},
+		{name: "cp", usage: "cp [flags] [instanceId:]source... [instanceId:]destination", summary: "Copy files to or from an instance with scp over SSM", run: runCp},
+		{name: "scp", usage: "scp [flags] -- [scp flags] [user@]host:path...", summary: "Run scp with any of its flags against instances, by ID, alias or Name", run: runSCP},
+		{name: "rsync", usage: "rsync [flags] -- [rsync flags] [user@]host:path...", summary: "Run rsync against instances, by ID, alias or Name, over SSM", run: runRsync},
+		{name: "sftp", usage: "sftp [instanceId] [flags]", summary: "Browse an instance's files in an interactive sftp session over SSM", run: runSFTP},
+		{name: "serial", usage: "serial [instanceId] [flags]", summary: "Open an instance's EC2 serial console, for when SSM and the network are down", run: runSerial},
+		{name: "proxy", usage: "proxy instanceId [port] [flags]", summary: "Pipe SSH over SSM, for use as ProxyCommand in ~/.ssh/config", run: runProxy},
+		{name: "ssh-config", usage: "ssh-config [--write] [flags]", summary: "Generate ~/.ssh/config Host entries that reach instances over SSM", run: runSSHConfig},
+		{name: "actions", usage: "actions [start|stop|reboot|terminate] [instanceId] [flags]", summary: "Start, stop, reboot or terminate an instance", run: runActions},
+		{name: "console-output", usage: "console-output [instanceId] [flags]", summary: "Show an instance's boot console output, for when SSM never comes up", run: runConsoleOutput},
+		{name: "logs", usage: "logs [instanceId] --group pattern [flags]", summary: "Tail an instance's CloudWatch Logs streams without opening a shell", run: runLogs},
+		{name: "compliance", usage: "compliance [instanceId] [flags]", summary: "Show an instance's patch compliance and inventory summary", run: runCompliance},
+		{name: "history", usage: "history [flags]", summary: "Show the sessions recorded in the local audit log", run: runAuditHistory},
+		{name: "alias", usage: "alias add <name> <instanceId> | rm <name> | list [flags]", summary: "Bookmark instances under a name to connect with 'aws-ssm-connect <name>'", run: runAlias},
+		{name: "doctor", usage: "doctor [flags]", summary: "Check tools, credentials, region and permissions needed for sessions", run: runDoctor},
+		{name: "completion", usage: "completion bash|zsh|fish", summary: "Print a shell completion script", run: runCompletion},
+		{name: "version", usage: "version [flags]", summary: "Print the version", run: runVersion},
+		{name: "help", usage: "help [command]", summary: "Show help for a command", run: runHelp},
+	}
+}
 
-	if err != nil {
-		fmt.Printf("Error executing AWS CLI command: %v\n", err)
-		if exitError, ok := err.(*exec.ExitError); ok {
-			fmt.Fprintf(os.Stderr, "AWS CLI Error Output:\n%s\n", exitError.Stderr)
+// findCommand returns the subcommand with the given name, or nil.
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
 		}
-		fmt.Println("\nPossible issues:")
-		fmt.Println("1. Is the 'aws' CLI installed and in your PATH?")
-		fmt.Println("2. Is the specified profile configured for SSO and active (run 'aws sso login')?")
-		fmt.Println("3. Do you have the necessary EC2 permissions and SSM Agent running on the instances?")
-		os.Exit(1)
 	}
+	return nil
+}
 
-	// 2. Parse and flatten the JSON output (handling array-of-arrays structure)
-	var rawReservations [][]Instance
-	if err := json.Unmarshal(output, &rawReservations); err != nil {
-		fmt.Printf("Error parsing JSON output from AWS CLI: %v\n", err)
-		os.Exit(1)
+// run dispatches to a subcommand and returns the process exit code. Without a subcommand
+// the tool behaves like it always has: pick an instance and connect.
+func run(ctx context.Context, args []string) int {
+	cmd := findCommand("connect")
+	if len(args) > 0 {
+		switch {
+		case args[0] == "-h" || args[0] == "--help":
+			printUsage(os.Stdout)
+			return exitOK
+		case args[0] == "__complete":
+			return runComplete(ctx, args[1:])
+		case findCommand(args[0]) != nil:
+			cmd, args = findCommand(args[0]), args[1:]
+		case !strings.HasPrefix(args[0], "-") && !instanceIDPattern.MatchString(args[0]) && !isAlias(args[0]):
+			fmt.Fprintf(os.Stderr, "Unknown command %q.\n\n", args[0])
+			printUsage(os.Stderr)
+			return exitUsage
+		}
 	}
+	return cmd.run(ctx, args)
+}
 
-	// Flatten the raw array of arrays into a single slice of Instance
-	var instances []Instance
-	for _, reservationInstances := range rawReservations {
-		instances = append(instances, reservationInstances...)
+// printUsage writes the top-level help text.
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "aws-ssm-connect: interactive CLI tool for SSM access to EC2 instances")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Usage: aws-ssm-connect [command] [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", cmd.name, cmd.summary)
 	}
-
-	if len(instances) == 0 {
-		fmt.Println("\nNo EC2 instances found.")
-		return
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run 'aws-ssm-connect help <command>' for the flags of a command.")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Exit codes (exec and sessions exit with the remote status instead):")
+	fmt.Fprintf(w, "  %d  any other error\n", exitError)
+	fmt.Fprintf(w, "  %d  invalid flags or arguments\n", exitUsage)
+	for _, kind := range errorKinds {
+		fmt.Fprintf(w, "  %d  %s\n", kind.code, kind.description)
 	}
+	fmt.Fprintln(w)
+	printEnvUsage(w)
+}
 
-	// 3. Prompt user for selection
-	selectedID, err := promptForSelection(instances)
-	if err != nil {
-		if err.Error() == "quit signal" {
-			fmt.Println("\nExiting program.")
-			os.Exit(0) // Graceful exit on 'q'
+// options holds the settings shared by the subcommands. Flags are parsed into it first and
+// applyFileConfig then fills in whatever was left unset from the environment and config.yaml.
+type options struct {
+	Profile     string
+	Region      string
+	RoleARN     string
+	SSOPick     bool
+	SSOAccount  string
+	SSORole     string
+	MFASerial   string
+	Env         string
+	AllRegions  bool
+	Hybrid      bool
+	Sources     stringList
+	ASG         bool
+	TargetGroup bool
+	Accounts    stringList
+	AccountRole string
+	Tags        stringList
+	States      stringList
+	AllStates   bool
+	SSMOnly     bool
+	Sort        sortOrder
+	Columns     columnList
+	GroupBy     string
+	Query       queryFilter
+	Refresh     bool
+	CacheTTL    time.Duration
+	Numbered    bool
+	Name        string
+	IP          string
+	VpcIDs      stringList
+	SubnetIDs   stringList
+	Groups      stringList
+	Target      string
+	Last        bool
+	Start       bool
+	Wait        bool
+	Reconnect   int
+	History     bool
+	Document    string
+	Parameters  stringList
+	All         bool
+	Multi       bool
+	User        string
+	LogSession  bool
+	Record      string
+	Native      bool
+	DryRun      bool
+
+	// FetchConcurrency and FetchTimeout bound the searches of several regions or accounts.
+	FetchConcurrency int
+	FetchTimeout     time.Duration
+
+	// presets are the config file's named environments, for --env and the picker.
+	presets map[string]preset
+
+	// guard is the config file's guard policy, nil if there is none.
+	guard *guardPolicy
+
+	// notify is where the config file has sessions announced.
+	notify notifyConfig
+
+	// Reason is why the instances are being accessed, from --reason or asked for by the
+	// guard policy.
+	Reason string
+
+	// WindowsOnly restricts the listing to Windows instances; it is set by rdp, not a flag.
+	WindowsOnly bool
+
+	// targetHealth is the load balancer health of the instances of the target group picked
+	// with --target-group, by instance ID.
+	targetHealth map[string]string
+
+	// batchStdin lets resolveTargets read a list of instance IDs and names from stdin when
+	// it is not a terminal, for commands that act on several instances without a prompt.
+	batchStdin bool
+
+	// fs is the flag set the options were parsed from, used to tell flags that were
+	// given explicitly apart from defaults.
+	fs *flag.FlagSet
+
+	// restored names the flags --last or --history filled in from the remembered
+	// connection, which a preset must not override either.
+	restored []string
+	// targetAccount is the account of a target restored by --last or --history that was
+	// reached through --accounts.
+	targetAccount string
+}
+
+// stringList is a flag.Value for repeatable flags such as --tag.
+type stringList []string
+
+func (s *stringList) String() string     { return strings.Join(*s, ",") }
+func (s *stringList) Set(v string) error { *s = append(*s, v); return nil }
+
+// newFlagSet creates the flag set for a subcommand with the flags every command shares.
+func newFlagSet(cmd *command, opts *options) *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	opts.fs = fs
+	fs.Usage = func() {
+		if describeFlags != nil {
+			describeFlags(fs)
+			return
 		}
-		fmt.Printf("\nSelection Error: %v\n", err)
-		os.Exit(1)
+		fmt.Fprintf(fs.Output(), "Usage: aws-ssm-connect %s\n\n%s.\n\nFlags:\n", cmd.usage, cmd.summary)
+		printFlagDefaults(fs)
 	}
-
-	// 4. Start the SSM Session to the selected instance
-	// We no longer need to find the full instance object, just the ID and profile.
-	startSSMSession(selectedID, profile)
+	fs.StringVar(&opts.Profile, "profile", "", "AWS `profile` to use (default: the active environment)")
+	fs.StringVar(&opts.Region, "region", "", "AWS `region` to use (default: AWS_REGION or the profile's region)")
+	fs.StringVar(&opts.RoleARN, "role-arn", "", "assume this IAM role `arn` with the profile's credentials, e.g. to reach another account")
+	fs.BoolVar(&opts.SSOPick, "sso-pick", false, "pick the account and role from your IAM Identity Center (SSO) assignments")
+	fs.StringVar(&opts.SSOAccount, "sso-account", "", "use this SSO `account` ID instead of the profile's")
+	fs.StringVar(&opts.SSORole, "sso-role", "", "use this SSO permission set `role` instead of the profile's")
+	fs.StringVar(&opts.MFASerial, "mfa-serial", "", "ARN (or serial number) of the MFA `device` the role requires; the code is prompted for")
+	fs.StringVar(&opts.Env, "env", "", "use the profile, region, filters and document of this preset `name` from the config file")
+	addEndpointFlags(fs)
+	addProxyFlags(fs)
+	addRetryFlags(fs)
+	addColorFlags(fs)
+	addPlainFlags(fs)
+	addDebugFlags(fs)
+	return fs
 }
 
-// getProfileFromArgs extracts the --profile argument from command line arguments.
-func getProfileFromArgs() string {
-	args := os.Args[1:]
-	for i, arg := range args {
-		if arg == "--profile" && i+1 < len(args) {
-			return args[i+1]
+// printFlagDefaults is fs.PrintDefaults without the internal flags, which have no usage
+// text.
+func printFlagDefaults(fs *flag.FlagSet) {
+	visible := flag.NewFlagSet(fs.Name(), flag.ContinueOnError)
+	visible.SetOutput(fs.Output())
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Usage != "" {
+			visible.Var(f.Value, f.Name, f.Usage)
 		}
+	})
+	visible.PrintDefaults()
+}
+
+// addDiscoveryFlags registers the flags that control which instances are listed.
+func addDiscoveryFlags(fs *flag.FlagSet, opts *options) {
+	fs.BoolVar(&opts.AllRegions, "all-regions", false, "search every enabled region in parallel")
+	fs.BoolVar(&opts.Hybrid, "hybrid", false, "also list on-premises servers and VMs registered through SSM hybrid activations (mi- IDs)")
+	fs.Var(&opts.Sources, "source", "list targets from these `sources` (comma-separated or repeatable): "+strings.Join(inventory.SourceNames(), ", ")+" (default ec2)")
+	fs.Var(&opts.Accounts, "accounts", "search these account `IDs` instead of the profile's (comma-separated or repeatable; 'org' for every account in the organization)")
+	fs.StringVar(&opts.AccountRole, "account-role", "", "`role` name to assume in each --accounts account (default "+defaultAccountRole+")")
+	fs.BoolVar(&opts.ASG, "asg", false, "pick an Auto Scaling group first and list only its instances (or --tag "+asgTagKey+"=name)")
+	fs.BoolVar(&opts.TargetGroup, "target-group", false, "pick a load balancer target group first and list only its registered instances, with their health")
+	fs.Var(&opts.Tags, "tag", "only list instances tagged `Key=Value` (repeatable; a bare Key matches any value)")
+	fs.Var(&opts.States, "state", "only list instances in this `state` (repeatable or comma-separated; default running)")
+	fs.BoolVar(&opts.AllStates, "all-states", false, "list instances in every state")
+	fs.BoolVar(&opts.SSMOnly, "ssm-only", false, "hide instances whose SSM agent is not online")
+	fs.StringVar(&opts.Name, "name", "", "select the instance with this Name `tag` (wildcards allowed)")
+	fs.StringVar(&opts.IP, "ip", "", "select the instance with this private `address`")
+	fs.Var(&opts.VpcIDs, "vpc-id", "only list instances in this `VPC` (repeatable)")
+	fs.Var(&opts.SubnetIDs, "subnet-id", "only list instances in this `subnet` (repeatable)")
+	fs.Var(&opts.Groups, "security-group", "only list instances attached to this security `group`, by ID (sg-...) or name (repeatable)")
+	fs.Var(&opts.Columns, "columns", "show these table `columns`, comma-separated: "+strings.Join(columnKeys(), ","))
+	fs.Var(&opts.Query, "query-filter", "only list instances matching this `expression`, e.g. \"name contains web and ip prefix 10.1.\" (operators: "+strings.Join(queryOperators, " ")+"; fields: the column keys and tag:Key)")
+	fs.StringVar(&opts.GroupBy, "group-by", "", "group the listing by this tag `key` ('stack' for the CloudFormation stack) and pick a group first")
+	opts.Sort = "name"
+	fs.Var(&opts.Sort, "sort", "sort the listing by `key`: "+strings.Join(sortKeys, ", "))
+	fs.BoolVar(&opts.Refresh, "refresh", false, "ignore the cached instance list and fetch it again")
+	fs.DurationVar(&opts.CacheTTL, "cache-ttl", defaultCacheTTL, "reuse an instance list fetched less than this `duration` ago (0 disables the cache)")
+	fs.IntVar(&opts.FetchConcurrency, "fetch-concurrency", inventory.DefaultConcurrency, "search at most `n` regions or accounts at once")
+	fs.DurationVar(&opts.FetchTimeout, "fetch-timeout", defaultFetchTimeout, "skip a region or account that takes longer than this `duration` to list (0 waits indefinitely)")
+}
+
+// addPickerFlags registers the flags of the commands that prompt for an instance.
+func addPickerFlags(fs *flag.FlagSet, opts *options) {
+	fs.StringVar(&opts.Target, "target", "", "connect to this `instanceId` without listing")
+	fs.BoolVar(&opts.Numbered, "numbered", false, "use the numbered menu instead of the fuzzy finder")
+	fs.BoolVar(&opts.Last, "last", false, "connect to the most recently used instance")
+	fs.BoolVar(&opts.History, "history", false, "pick from recently used instances")
+	fs.BoolVar(&opts.Start, "start", false, "start the instance without asking if it is stopped")
+	fs.BoolVar(&opts.Wait, "wait", false, "if the SSM agent is not connected yet (e.g. still booting), wait for it and connect")
+	addReasonFlag(fs, opts)
+}
+
+// addShellFlags registers the flags of the commands that open an interactive shell.
+func addShellFlags(fs *flag.FlagSet, opts *options) {
+	fs.BoolVar(&opts.LogSession, "log-session", false, "also write the session output to a transcript under ~/.aws-ssm-connect/logs")
+	fs.StringVar(&opts.Record, "record", "", "record the session as an asciicast `file` for asciinema play; given a directory, a file named after the instance is created in it")
+	fs.StringVar(&opts.Document, "document-name", "", "start the session with this SSM session `document` instead of the account default")
+	fs.Var(&opts.Parameters, "parameter", "pass `key=value` to the session document (repeatable)")
+	fs.StringVar(&opts.User, "user", "", "start a login shell as this OS `user` (via sudo) instead of ssm-user")
+	fs.StringVar(&opts.User, "as", "", "alias for --user")
+	fs.BoolVar(&opts.Native, "native", false, "use the built-in Session Manager client even if session-manager-plugin is installed")
+	addReconnectFlag(fs, opts)
+	addDryRunFlag(fs, opts)
+}
+
+// isSet reports whether the named flag was given on the command line.
+func (o *options) isSet(name string) bool {
+	set := false
+	if o.fs != nil {
+		o.fs.Visit(func(f *flag.Flag) {
+			if f.Name == name {
+				set = true
+			}
+		})
 	}
-	return ""
+	return set
 }
 
-// promptForSelection lists instances with numbered options and asks the user to input the option number.
-func promptForSelection(instances []Instance) (string, error) {
-	fmt.Println("\nAvailable EC2 Instances:")
-	fmt.Println("-----------------------------------------------------------------------------------------")
-	// Header formatting: 8 chars for Option, 20 for ID, 30 for Name, 15 for IP
-	fmt.Printf("%-8s %-20s %-30s %-15s\n", "OPTION", "INSTANCE ID", "NAME", "PRIVATE IP")
-	fmt.Println("-----------------------------------------------------------------------------------------")
+// isPinned reports whether the flag name was given on the command line or restored from
+// the connection history, so presets leave it alone.
+func (o *options) isPinned(name string) bool {
+	return o.isSet(name) || slices.Contains(o.restored, name)
+}
 
-	for i, inst := range instances {
-		name := inst.Name
-		if name == "" {
-			name = "N/A"
+// parseFlags parses args into fs, allowing flags and positional arguments to be mixed
+// (e.g. "connect i-0abc --profile prod"). Everything after "--" is positional.
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := fs.Args()
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+			return append(positional, rest...), nil
 		}
-		// Print the 1-based index (i+1) as the option number
-		fmt.Printf("%-8d %-20s %-30s %-15s\n", i+1, inst.InstanceID, name, inst.PrivateIPAddress)
+		if len(rest) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
 	}
-	fmt.Println("-----------------------------------------------------------------------------------------")
+}
 
-	// Read user input
-	reader := bufio.NewReader(os.Stdin)
-	// Updated prompt to include the quit option
-	fmt.Print("Enter the option number to start an SSM Session (or 'q' to quit): ")
+// flagErrorCode maps a flag parsing error to an exit code; the flag package has already
+// printed the error and usage.
+func flagErrorCode(err error) int {
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+	return exitUsage
+}
 
-	input, err := reader.ReadString('\n')
+// applyFileConfig fills unset options from the AWS_SSM_CONNECT_* environment variables, the
+// project's .aws-ssm-connect.yaml and config.yaml, in that order of precedence.
+func (o *options) applyFileConfig() error {
+	fileCfg, err := loadFileConfig()
 	if err != nil {
-		return "", fmt.Errorf("failed to read input: %w", err)
+		return err
+	}
+	if err := applyEnvConfig(&fileCfg); err != nil {
+		return err
+	}
+	if err := applyTheme(fileCfg.Theme); err != nil {
+		return fmt.Errorf("config theme: %w", err)
+	}
+	if fileCfg.NoColor {
+		noColor = true
+	}
+	if fileCfg.Plain {
+		setPlainOutput()
+	}
+	if o.Profile == "" {
+		o.Profile = fileCfg.Profile
+	}
+	if o.Region == "" {
+		o.Region = fileCfg.Region
+	}
+	if len(o.Tags) == 0 {
+		o.Tags = fileCfg.Tags
+	}
+	if len(o.States) == 0 {
+		o.States = fileCfg.States
 	}
+	if len(o.Accounts) == 0 {
+		o.Accounts = fileCfg.Accounts
+	}
+	if o.AccountRole == "" {
+		o.AccountRole = fileCfg.AccountRole
+	}
+	if o.Document == "" {
+		o.Document = fileCfg.Document
+	}
+	if len(o.Parameters) == 0 {
+		for key, value := range fileCfg.Parameters {
+			o.Parameters = append(o.Parameters, key+"="+value)
+		}
+	}
+	if !o.isSet("log-session") {
+		o.LogSession = fileCfg.LogSession
+	}
+	if !o.isSet("hybrid") {
+		o.Hybrid = fileCfg.Hybrid
+	}
+	if len(o.Sources) == 0 {
+		o.Sources = fileCfg.Sources
+	}
+	if len(o.Columns) == 0 && len(fileCfg.Columns) > 0 {
+		if err := o.Columns.Set(strings.Join(fileCfg.Columns, ",")); err != nil {
+			return fmt.Errorf("invalid columns in config.yaml: %w", err)
+		}
+	}
+	if o.GroupBy == "" {
+		o.GroupBy = fileCfg.GroupBy
+	}
+	if !o.isSet("sort") && fileCfg.Sort != "" {
+		if err := o.Sort.Set(fileCfg.Sort); err != nil {
+			return fmt.Errorf("invalid sort '%s' in config.yaml: %w", fileCfg.Sort, err)
+		}
+	}
+	if !o.isSet("reconnect") {
+		o.Reconnect = fileCfg.Reconnect
+	}
+	if !o.isSet("cache-ttl") && fileCfg.CacheTTL != nil {
+		o.CacheTTL = *fileCfg.CacheTTL
+	}
+	if !o.isSet("fetch-concurrency") && fileCfg.FetchConcurrency > 0 {
+		o.FetchConcurrency = fileCfg.FetchConcurrency
+	}
+	if !o.isSet("fetch-timeout") && fileCfg.FetchTimeout != nil {
+		o.FetchTimeout = *fileCfg.FetchTimeout
+	}
+	if o.guard, err = newGuardPolicy(fileCfg.Guard); err != nil {
+		return fmt.Errorf("config guard: %w", err)
+	}
+	o.notify = fileCfg.Notify
+	o.presets = fileCfg.Presets
+	if o.Env == "" {
+		o.Env = fileCfg.Env
+	}
+	if o.Env != "" {
+		return o.applyPreset(o.Env)
+	}
+	return nil
+}
+
+// instanceIDPattern matches EC2 (i-) and hybrid managed (mi-) instance IDs.
+var instanceIDPattern = regexp.MustCompile(`^m?i-[0-9a-f]{8,17}$`)
+
+// errQuit is returned by the pickers when the user chooses to quit.
+var errQuit = picker.ErrQuit
+
+// cliError is an error with troubleshooting hints to print below it.
+type cliError struct {
+	err   error
+	hints []string
+}
+
+func (e *cliError) Error() string { return e.err.Error() }
+func (e *cliError) Unwrap() error { return e.err }
+
+// withHints attaches troubleshooting hints to err.
+func withHints(err error, hints ...string) error {
+	return &cliError{err: err, hints: hints}
+}
 
-	trimmedInput := strings.ToLower(strings.TrimSpace(input))
+// exitStatusError reports that a session exited with a non-zero status, which the program
+// then exits with too, so wrappers and CI scripts can tell a failed connection apart.
+type exitStatusError struct {
+	err  error
+	code int
+}
+
+func (e *exitStatusError) Error() string { return e.err.Error() }
+func (e *exitStatusError) Unwrap() error { return e.err }
+
+// reportError prints err, and any hints attached to it, to stderr and returns the exit code:
+// the status carried by an exitStatusError, the code of the error's kind, and exitError
+// otherwise. Classified errors are labelled with their kind, e.g. "Error (permission-denied):".
+func reportError(err error) int {
+	kind := errorKindOf(err)
+	prefix := "Error"
+	if kind != nil {
+		prefix += " (" + kind.name + ")"
+	}
+	fmt.Fprintf(os.Stderr, "\n%s: %v\n", paint(os.Stderr, "error", prefix), err)
+	var ce *cliError
+	if errors.As(err, &ce) && len(ce.hints) > 0 {
+		fmt.Fprintln(os.Stderr, "\nPossible issues:")
+		for i, hint := range ce.hints {
+			fmt.Fprintf(os.Stderr, "%d. %s\n", i+1, hint)
+		}
+	}
+	var se *exitStatusError
+	if errors.As(err, &se) && se.code > 0 {
+		return se.code
+	}
+	if kind != nil {
+		return kind.code
+	}
+	return exitError
+}
 
-	// Check for quit signal
-	if trimmedInput == "q" {
-		return "", fmt.Errorf("quit signal")
+// resolveAWSConfig resolves credentials and region the same way the AWS CLI does
+// (environment, shared config/credentials files, SSO cache, IMDS). An explicit
+// --region (or one from the config file) wins over the environment and profile.
+func resolveAWSConfig(ctx context.Context, opts *options) (aws.Config, error) {
+	if opts.Profile != "" {
+		fmt.Fprintf(os.Stderr, "Using AWS Profile: %s\n", opts.Profile)
+	} else {
+		fmt.Fprintln(os.Stderr, "No profile specified. Using the default profile/active environment.")
 	}
 
-	selectedNum, err := strconv.Atoi(trimmedInput)
+	cfg, err := loadAWSConfig(ctx, opts.Profile, opts.Region)
 	if err != nil {
-		return "", fmt.Errorf("invalid input: '%s' is not a valid number or 'q'", trimmedInput)
+		return cfg, withKind(kindCredentials, withHints(fmt.Errorf("loading AWS configuration: %w", err),
+			"Does the specified profile exist in ~/.aws/config?",
+			"Is the specified profile configured for SSO and active (run 'aws sso login')?"))
 	}
 
-	// Validate the selected number is within bounds (1 to length)
-	if selectedNum < 1 || selectedNum > len(instances) {
-		return "", fmt.Errorf("invalid option number: %d. Must be between 1 and %d", selectedNum, len(instances))
+	if cfg.Region == "" && opts.AllRegions {
+		// Any region will do to discover the others.
+		cfg.Region = "us-east-1"
+	}
+	if cfg.Region == "" {
+		return cfg, withHints(errors.New("no AWS region configured"),
+			"Pass --region, set AWS_REGION, or add 'region = ...' to the profile in ~/.aws/config.")
 	}
 
-	// Get the InstanceID using the 0-based index (selectedNum - 1)
-	return instances[selectedNum-1].InstanceID, nil
+	// Resolve credentials now, so an expired SSO session can be renewed before any work
+	// is done rather than failing halfway through.
+	if _, err := cfg.Credentials.Retrieve(ctx); err != nil && isSSOTokenError(err) {
+		if err := renewSSOSession(ctx, opts.Profile, err); err != nil {
+			return cfg, err
+		}
+		if cfg, err = loadAWSConfig(ctx, opts.Profile, cfg.Region); err != nil {
+			return cfg, err
+		}
+	}
+	if cfg, err = applySSORole(ctx, cfg, opts); err != nil {
+		return cfg, err
+	}
+	if opts.RoleARN != "" {
+		return assumeRole(ctx, cfg, opts)
+	}
+	return cfg, nil
 }
 
-// startSSMSession executes 'aws ssm start-session' with the selected Instance ID.
-func startSSMSession(instanceID string, profile string) {
-	fmt.Printf("\nAttempting to start SSM session for Instance ID: %s...\n", instanceID)
+// loadAWSConfig loads the shared AWS configuration, optionally for a named profile and region.
+// When no region is given, the SDK resolves it from AWS_REGION and the profile's config;
+// AWS_DEFAULT_REGION is checked last for parity with the AWS CLI.
+func loadAWSConfig(ctx context.Context, profile, region string) (aws.Config, error) {
+	var opts []func(*config.LoadOptions) error
+	if profile != "" {
+		opts = append(opts, config.WithSharedConfigProfile(profile))
+	}
+	if region != "" {
+		opts = append(opts, config.WithRegion(region))
+	}
+	// Role profiles with mfa_serial prompt for the code, as the AWS CLI does.
+	opts = append(opts, config.WithAssumeRoleCredentialOptions(func(o *stscreds.AssumeRoleOptions) {
+		o.TokenProvider = promptMFACode
+	}))
+	opts = append(opts, endpointConfigOptions()...)
+	opts = append(opts, proxyConfigOptions()...)
+	opts = append(opts, retryConfigOptions()...)
+	opts = append(opts, debugConfigOptions()...)
 
-	args := []string{
-		"ssm",
-		"start-session",
-		"--target", instanceID,
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return cfg, err
+	}
+	if cfg.Region == "" {
+		cfg.Region = os.Getenv("AWS_DEFAULT_REGION")
 	}
+	return cfg, nil
+}
 
-	if profile != "" {
-		args = append(args, "--profile", profile)
-	}
-
-	cmd := exec.Command("aws", args...)
-
-	// Crucial: Connect the command's I/O to the current process's I/O
-	// This allows the user to interact with the SSM session directly.
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	// Start the command and wait for it to complete
-	if err := cmd.Run(); err != nil {
-		fmt.Printf("\nError starting SSM session: %v\n", err)
-		fmt.Println("\nCheck if:")
-		fmt.Println("1. The SSM Plugin is installed for the AWS CLI.")
-		fmt.Println("2. The instance is running and the SSM Agent is healthy.")
-		fmt.Println("3. The instance's IAM role has the necessary SSM permissions (e.g., AmazonSSMManagedInstanceCore).")
-		// The exit code of the SSM session is propagated
-		if exitError, ok := err.(*exec.ExitError); ok {
-			fmt.Printf("SSM session terminated with exit code: %d\n", exitError.ExitCode())
-		}
-	} else {
-		fmt.Println("\nSSM Session terminated successfully.")
+// describeAPIError unwraps an SDK error into its AWS error code and message where possible,
+// so users see e.g. "UnauthorizedOperation: ..." instead of the full request trace. The
+// original error stays reachable through errors.As.
+func describeAPIError(err error) error {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return &apiError{msg: fmt.Sprintf("%s: %s", apiErr.ErrorCode(), apiErr.ErrorMessage()), err: err}
 	}
+	return err
 }
+
+// apiError is the short form of an SDK error produced by describeAPIError.
+type apiError struct {
+	msg string
+	err error
+}
+
+func (e *apiError) Error() string { return e.msg }
+func (e *apiError) Unwrap() error { return e.err }
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// readBatchTargets reads a newline-separated list of instance IDs and Name tags. Blank
+// lines and lines starting with # are skipped, as is anything after the first field, so
+// the output of 'list --output tsv' (header included) works too.
+func readBatchTargets(r io.Reader) ([]string, error) {
+	var targets []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if field := strings.Fields(line)[0]; field != instanceRecordHeader[0] {
+			targets = append(targets, field)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading targets from stdin: %w", err)
+	}
+	return targets, nil
+}
+
+// resolveBatchTargets turns a batch list into instances. Instance IDs are used as given;
+// names are looked up in the listing (with the usual filters) and may match several
+// instances. A name that matches nothing is an error, so that a typo doesn't silently
+// shrink the batch.
+func resolveBatchTargets(ctx context.Context, cfg aws.Config, opts *options, batch []string) ([]Instance, error) {
+	var targets []Instance
+	var names []string
+	seen := map[string]bool{}
+	for _, target := range batch {
+		switch {
+		case !instanceIDPattern.MatchString(target):
+			names = append(names, target)
+		case !seen[target]:
+			seen[target] = true
+			targets = append(targets, Instance{InstanceID: target, Region: cfg.Region})
+		}
+	}
+
+	if len(names) > 0 {
+		instances, err := discoverInstances(ctx, cfg, opts)
+		if err != nil {
+			return nil, err
+		}
+		var missing []string
+		for _, name := range names {
+			found := false
+			for _, inst := range instances {
+				if inst.Name != name {
+					continue
+				}
+				found = true
+				if !seen[inst.InstanceID] {
+					seen[inst.InstanceID] = true
+					targets = append(targets, inst)
+				}
+			}
+			if !found {
+				missing = append(missing, name)
+			}
+		}
+		if len(missing) > 0 {
+			return nil, withHints(fmt.Errorf("no instance named %s", strings.Join(missing, ", ")),
+				"Names are matched exactly against the Name tag of the instances your filters list.")
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Read %d targets from stdin.\n", len(targets))
+	return targets, nil
+}
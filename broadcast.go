@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/nkarisa/homebrew-aws-ssm-connect/pkg/picker"
+)
+
+// broadcastQueueSize is how many lines of input a broadcast session may fall behind by.
+const broadcastQueueSize = 256
+
+// runBroadcast implements the broadcast command, cluster-ssh style: open a shell on every
+// picked instance and send each line typed to all of them at once, printing their output
+// prefixed with the host it came from. Ctrl+D closes every session.
+//
+// The sessions use the built-in client, since session-manager-plugin can only drive one
+// terminal. Input is line-buffered: full-screen programs such as editors won't work.
+func runBroadcast(ctx context.Context, args []string) int {
+	var opts options
+	fs := newFlagSet(findCommand("broadcast"), &opts)
+	addDiscoveryFlags(fs, &opts)
+	addPickerFlags(fs, &opts)
+	fs.BoolVar(&opts.All, "all", false, "broadcast to every matching instance without prompting")
+	fs.StringVar(&opts.Document, "document-name", "", "start the sessions with this SSM session `document` instead of the account default")
+	fs.Var(&opts.Parameters, "parameter", "pass `key=value` to the session document (repeatable)")
+	fs.StringVar(&opts.User, "user", "", "start login shells as this OS `user` (via sudo) instead of ssm-user")
+	addDryRunFlag(fs, &opts)
+
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return flagErrorCode(err)
+	}
+	if len(positional) > 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	opts.Multi = !opts.All
+	cfg, targets, err := resolveTargets(ctx, &opts)
+	if err != nil {
+		return targetErrorCode(err, &opts)
+	}
+	if opts.DryRun {
+		for _, target := range targets {
+			input, err := shellSessionInput(&opts, target.InstanceID)
+			if err != nil {
+				return reportError(err)
+			}
+			if err := printStartSessionDryRun(targetConfig(ctx, cfg, &opts, target), &opts, input); err != nil {
+				return reportError(err)
+			}
+		}
+		return exitOK
+	}
+
+	var out sync.Mutex
+	inputs := make([]chan []byte, len(targets))
+	errs := make([]error, len(targets))
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		// Each host gets its own queue, so that a slow session doesn't hold up the others.
+		reader, writer := io.Pipe()
+		inputs[i] = make(chan []byte, broadcastQueueSize)
+		go func(queue <-chan []byte) {
+			for line := range queue {
+				writer.Write(line) // Fails only once the session has ended.
+			}
+			writer.Close()
+		}(inputs[i])
+		wg.Add(1)
+		go func(i int, target Instance) {
+			defer wg.Done()
+			// Stop taking input for a host whose session is over.
+			defer reader.Close()
+			prefix := "[" + hostLabel(target) + "] "
+			stdout := &prefixWriter{w: os.Stdout, prefix: prefix, mu: &out}
+			stderr := &prefixWriter{w: os.Stderr, prefix: prefix, mu: &out}
+			errs[i] = broadcastSession(ctx, targetConfig(ctx, cfg, &opts, target), &opts, target.InstanceID, reader, stdout, stderr)
+			stdout.Flush()
+			stderr.Flush()
+		}(i, target)
+		recordHistory(&opts, target)
+	}
+
+	fmt.Fprintf(os.Stderr, "Broadcasting to %d instances: every line you type is sent to all of them. Press Ctrl+D to end.\n", len(targets))
+	lines := make(chan []byte)
+	go func() {
+		scanner := bufio.NewScanner(picker.Stdin)
+		for scanner.Scan() {
+			lines <- append([]byte(scanner.Text()), '\n')
+		}
+		close(lines)
+	}()
+
+	// Once every session is over there is nobody left to type to.
+	finished := make(chan struct{})
+	go func() { wg.Wait(); close(finished) }()
+	for done := false; !done; {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				done = true
+				continue
+			}
+			for i, input := range inputs {
+				select {
+				case input <- line:
+				default:
+					fmt.Fprintf(os.Stderr, "[%s] not keeping up; input dropped\n", hostLabel(targets[i]))
+				}
+			}
+		case <-finished:
+			done = true
+		}
+	}
+	for _, input := range inputs {
+		close(input)
+	}
+	wg.Wait()
+
+	failed := 0
+	for i, target := range targets {
+		if errs[i] != nil {
+			fmt.Fprintf(os.Stderr, "[%s] %v\n", hostLabel(target), errs[i])
+			failed++
+		}
+	}
+	if failed > 0 {
+		return exitError
+	}
+	return exitOK
+}
+
+// broadcastSession runs one shell session of a broadcast with the built-in client.
+func broadcastSession(ctx context.Context, cfg aws.Config, opts *options, instanceID string, stdin io.Reader, stdout, stderr io.Writer) error {
+	input, err := shellSessionInput(opts, instanceID)
+	if err != nil {
+		return err
+	}
+	client := ssm.NewFromConfig(cfg)
+	output, err := client.StartSession(ctx, input)
+	if err != nil {
+		return fmt.Errorf("starting SSM session: %w", describeAPIError(err))
+	}
+	defer client.TerminateSession(context.WithoutCancel(ctx), &ssm.TerminateSessionInput{SessionId: output.SessionId})
+	return runNativeSession(ctx, cfg, output, instanceID, stdin, stdout, stderr, false)
+}
+
+// prefixWriter writes whole lines to w, each prefixed, so that output from concurrent
+// sessions interleaves line by line rather than mid-line.
+type prefixWriter struct {
+	w       io.Writer
+	prefix  string
+	mu      *sync.Mutex // shared by the writers of one output
+	partial []byte
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.partial = append(w.partial, bytes.ReplaceAll(p, []byte("\r"), nil)...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		w.mu.Lock()
+		fmt.Fprintf(w.w, "%s%s\n", w.prefix, w.partial[:i])
+		w.mu.Unlock()
+		w.partial = w.partial[i+1:]
+	}
+}
+
+// Flush writes out a final line without a newline, such as a shell prompt.
+func (w *prefixWriter) Flush() {
+	if len(w.partial) > 0 {
+		w.Write([]byte("\n"))
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// defaultCacheTTL is how long a cached instance listing is used before it is fetched again.
+const defaultCacheTTL = 5 * time.Minute
+
+// cacheDir returns the XDG-compliant cache directory for the tool:
+// $XDG_CACHE_HOME/aws-ssm-connect, falling back to ~/.cache/aws-ssm-connect.
+func cacheDir() (string, error) {
+	if dir := os.Getenv("XDG_CACHE_HOME"); dir != "" {
+		return filepath.Join(dir, "aws-ssm-connect"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".cache", "aws-ssm-connect"), nil
+}
+
+// inventoryCache is a cached instance listing as stored on disk.
+type inventoryCache struct {
+	FetchedAt time.Time  `json:"fetched_at"`
+	Instances []Instance `json:"instances"`
+}
+
+// inventoryCachePath returns where the listing for a profile, region (or "all-regions")
+// and set of filters is cached: <cache dir>/<profile>/<region>-<filters hash>.json.
+func inventoryCachePath(profile, region string, filters []types.Filter) (string, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return "", err
+	}
+	profile = strings.ReplaceAll(profileName(profile), string(filepath.Separator), "_")
+
+	key, _ := json.Marshal(filters)
+	sum := sha256.Sum256(key)
+	return filepath.Join(dir, profile, region+"-"+hex.EncodeToString(sum[:6])+".json"), nil
+}
+
+// loadInventoryCache returns the cached listing at path if it is younger than ttl, along
+// with its age.
+func loadInventoryCache(path string, ttl time.Duration) ([]Instance, time.Duration, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, 0, false
+	}
+	var cache inventoryCache
+	if json.Unmarshal(data, &cache) != nil {
+		return nil, 0, false
+	}
+	age := time.Since(cache.FetchedAt)
+	if age < 0 || age >= ttl {
+		return nil, 0, false
+	}
+	return cache.Instances, age, true
+}
+
+// saveInventoryCache stores a listing at path. The cache is best effort: failing to write
+// it must never get in the way of connecting.
+func saveInventoryCache(path string, instances []Instance) {
+	data, err := json.Marshal(inventoryCache{FetchedAt: time.Now(), Instances: instances})
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return
+	}
+	os.WriteFile(path, data, 0o600)
+}
+
+// knownInstances returns every instance in the cache, whatever its age, de-duplicated and
+// sorted by name. Shell completion offers these.
+func knownInstances() []Instance {
+	dir, err := cacheDir()
+	if err != nil {
+		return nil
+	}
+
+	seen := map[string]bool{}
+	var instances []Instance
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(path) != ".json" {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+		var cache inventoryCache
+		if json.Unmarshal(data, &cache) != nil {
+			return nil
+		}
+		for _, inst := range cache.Instances {
+			if !seen[inst.InstanceID] {
+				seen[inst.InstanceID] = true
+				instances = append(instances, inst)
+			}
+		}
+		return nil
+	})
+	sort.Slice(instances, func(i, j int) bool { return instances[i].Name < instances[j].Name })
+	return instances
+}
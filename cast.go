@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// castRecorder writes the output of a session as an asciicast v2 file, which asciinema
+// (asciinema play, or the web player) replays with the original timing:
+//
+//	{"version": 2, "width": 120, "height": 40, "timestamp": 1760000000, ...}
+//	[0.412, "o", "[ssm-user@ip-10-0-1-5 ~]$ "]
+//
+// It is an io.Writer, meant to be teed with the terminal like the --log-session transcript.
+type castRecorder struct {
+	mu      sync.Mutex
+	f       *os.File
+	w       *bufio.Writer
+	started time.Time
+	// partial holds the start of a UTF-8 sequence split across writes, since every event
+	// must be valid UTF-8.
+	partial []byte
+}
+
+// castHeader is the first line of an asciicast v2 file.
+type castHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// openRecording creates the --record file for a session on instanceID. When path is an
+// existing directory, the recording is named after the time and instance inside it, so
+// tui and tmux sessions each get their own.
+func openRecording(path, instanceID string) (*castRecorder, error) {
+	now := time.Now()
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		path = filepath.Join(path, fmt.Sprintf("%s-%s.cast", now.Format("20060102-150405"), instanceID))
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("creating the session recording: %w", err)
+	}
+
+	header := castHeader{Version: 2, Width: 80, Height: 24, Timestamp: now.Unix(),
+		Title: "aws-ssm-connect session to " + instanceID,
+		Env:   map[string]string{"TERM": os.Getenv("TERM"), "SHELL": os.Getenv("SHELL")}}
+	if w, h, err := term.GetSize(int(os.Stdout.Fd())); err == nil {
+		header.Width, header.Height = w, h
+	}
+	rec := &castRecorder{f: f, w: bufio.NewWriter(f), started: now}
+	if err := rec.writeLine(header); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("writing the session recording: %w", err)
+	}
+	return rec, nil
+}
+
+// Name returns the path of the recording.
+func (r *castRecorder) Name() string { return r.f.Name() }
+
+// Write records p as an output event.
+func (r *castRecorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data := append(r.partial, p...)
+	// Hold back an incomplete UTF-8 sequence at the end until the rest of it arrives.
+	end := len(data)
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				end = i
+			}
+			break
+		}
+	}
+	r.partial = append([]byte(nil), data[end:]...)
+	if end == 0 {
+		return len(p), nil
+	}
+	event := []any{time.Since(r.started).Seconds(), "o", string(data[:end])}
+	if err := r.writeLine(event); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// writeLine appends v as one JSON line.
+func (r *castRecorder) writeLine(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	r.w.Write(data)
+	return r.w.WriteByte('\n')
+}
+
+// Close flushes and closes the recording.
+func (r *castRecorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.w.Flush(); err != nil {
+		r.f.Close()
+		return err
+	}
+	return r.f.Close()
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// clipboardTools are the programs tried, in order, to put text on the clipboard.
+func clipboardTools() [][]string {
+	switch runtime.GOOS {
+	case "darwin":
+		return [][]string{{"pbcopy"}}
+	case "windows":
+		return [][]string{{"clip"}}
+	}
+	tools := [][]string{{"xclip", "-selection", "clipboard"}, {"xsel", "--clipboard", "--input"}}
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		tools = append([][]string{{"wl-copy"}}, tools...)
+	}
+	return tools
+}
+
+// copyToClipboard puts text on the system clipboard with the platform's tool. Without one,
+// e.g. over SSH, it asks the terminal to do it with an OSC 52 sequence, which most modern
+// terminals honour. It returns what was used.
+func copyToClipboard(ctx context.Context, text string) (string, error) {
+	for _, tool := range clipboardTools() {
+		path, err := executor.LookPath(tool[0])
+		if err != nil {
+			continue
+		}
+		debugCommand(path, tool[1:])
+		if err := executor.Run(ctx, path, tool[1:], strings.NewReader(text), nil, nil); err != nil {
+			return "", fmt.Errorf("copying to the clipboard with %s: %w", tool[0], err)
+		}
+		return tool[0], nil
+	}
+	if !term.IsTerminal(int(os.Stdout.Fd())) {
+		return "", errors.New("no clipboard tool was found (install xclip, xsel or wl-copy)")
+	}
+	fmt.Printf("\033]52;c;%s\a", base64.StdEncoding.EncodeToString([]byte(text)))
+	return "the terminal", nil
+}
+
+// copyTarget implements connect --copy: pick an instance as usual, but copy the value of
+// one of its columns (e.g. id or ip) to the clipboard instead of connecting. Nothing is
+// opened on the instance, so the guard policy isn't consulted.
+func copyTarget(ctx context.Context, opts *options, key string) int {
+	_, targets, err := findTargets(ctx, opts)
+	if err != nil {
+		return targetErrorCode(err, opts)
+	}
+	value := findColumn(key).value(targets[0])
+	if value == "" {
+		return reportError(fmt.Errorf("%s has no %s", hostLabel(targets[0]), key))
+	}
+	how, err := copyToClipboard(ctx, value)
+	if err != nil {
+		return reportError(err)
+	}
+	fmt.Printf("\nCopied %s to the clipboard (via %s).\n", value, how)
+	return exitOK
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// codeSSHConfigBlock names the managed block of ~/.ssh/config that holds the hosts opened
+// with connect --code.
+const codeSSHConfigBlock = "connect --code"
+
+// openInCode implements connect --code: pick an instance as usual, make sure ~/.ssh/config
+// has a host ssm-<instance ID> that reaches it over SSM, and open a VS Code Remote-SSH
+// window on it (on folder, if given).
+//
+// The host authenticates with a key kept in the state directory, which the proxy command
+// pushes with EC2 Instance Connect on every connection, so VS Code can reconnect later on
+// its own. The host entries stay in the block for that reason.
+func openInCode(ctx context.Context, opts *options, user, folder string) int {
+	cfg, target, err := resolveTarget(ctx, opts)
+	if err != nil {
+		return targetErrorCode(err, opts)
+	}
+	if strings.HasPrefix(target.InstanceID, "ecs:") {
+		return reportError(fmt.Errorf("%s is an ECS task; SSH, and so VS Code, can't be proxied to it", target.InstanceID))
+	}
+	if err := ensureRunning(ctx, cfg, opts, target); err != nil {
+		return targetErrorCode(err, opts)
+	}
+
+	proxy, err := proxyCommand(opts, cfg.Region)
+	if err != nil {
+		return reportError(err)
+	}
+	key, err := codeKey()
+	if err != nil {
+		return reportError(err)
+	}
+	if strings.HasPrefix(target.InstanceID, "i-") {
+		// %r is the login; OpenSSH expands it in the ProxyCommand.
+		proxy += " --push-key " + shellQuote(key+".pub") + " --push-user %r"
+	}
+	host := "ssm-" + target.InstanceID
+	entry := fmt.Sprintf("Host %s\n    HostName %s\n    User %s\n    IdentityFile \"%s\"\n    ProxyCommand %s\n\n",
+		host, target.InstanceID, user, key, proxy)
+
+	args := []string{"--remote", "ssh-remote+" + host}
+	if folder != "" {
+		args = []string{"--folder-uri", "vscode-remote://ssh-remote+" + host + "/" + strings.TrimPrefix(folder, "/")}
+	}
+	if opts.DryRun {
+		fmt.Printf("\n# Host added to ~/.ssh/config:\n%s", entry)
+		printDryRun("code", args...)
+		return exitOK
+	}
+
+	code, err := executor.LookPath("code")
+	if err != nil {
+		return reportError(withKind(kindMissingTool, withHints(errors.New("the VS Code 'code' command was not found in your PATH"),
+			"In VS Code, run 'Shell Command: Install 'code' command in PATH' from the command palette.")))
+	}
+
+	file, err := updateSSHConfig("", codeSSHConfigBlock, func(entries string) string {
+		var kept []string
+		for _, e := range strings.SplitAfter(entries, "\n\n") {
+			if e != "" && !strings.HasPrefix(e, "Host "+host+"\n") {
+				kept = append(kept, e)
+			}
+		}
+		return strings.Join(kept, "") + entry
+	})
+	if err != nil {
+		return reportError(err)
+	}
+	recordHistory(opts, target)
+	fmt.Printf("\nOpening %s in VS Code as SSH host %s (in %s).\n", hostLabel(target), host, file)
+	debugCommand(code, args)
+	if err := executor.Run(ctx, code, args, nil, nil, nil); err != nil {
+		return reportError(fmt.Errorf("starting VS Code: %w", err))
+	}
+	return exitOK
+}
+
+// codeKey returns the private key file of the key pair connect --code authenticates with,
+// generating the pair the first time.
+func codeKey() (string, error) {
+	dir, err := stateDir()
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, "code", "id_ed25519")
+	if _, err := os.Stat(path + ".pub"); err == nil {
+		return path, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return "", err
+	}
+	if _, err := writeKeyPair(path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
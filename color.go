@@ -0,0 +1,126 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// noColor is the --no-color value. Color is also off when NO_COLOR is set (no-color.org),
+// when TERM is dumb and when the output is not a terminal, e.g. piped into a log.
+var noColor bool
+
+// addColorFlags registers --no-color. Like --debug it takes effect while the flags are parsed.
+func addColorFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&noColor, "no-color", false, "don't color tables and messages (also NO_COLOR=1)")
+}
+
+// colorEnabled reports whether output to f may be colored.
+func colorEnabled(f *os.File) bool {
+	if noColor || plainOutput || os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return term.IsTerminal(int(f.Fd()))
+}
+
+// colorCodes are the color names a theme may use, with their SGR parameters.
+var colorCodes = map[string]string{
+	"bold":    "1",
+	"dim":     "2",
+	"red":     "31",
+	"green":   "32",
+	"yellow":  "33",
+	"blue":    "34",
+	"magenta": "35",
+	"cyan":    "36",
+	"white":   "37",
+	"none":    "",
+}
+
+// theme maps what is shown to the color it is shown in. The config file's theme section
+// overrides entries, e.g.
+//
+//	theme:
+//	  good: cyan
+//	  header: bold blue
+var theme = map[string]string{
+	"header": "bold",      // table headings
+	"good":   "green",     // running instances, online agents, healthy targets
+	"bad":    "red",       // stopped instances, offline agents, failures
+	"warn":   "yellow",    // instances and agents in transition
+	"muted":  "dim",       // unknown or missing values
+	"error":  "bold red",  // the "Error" prefix of messages
+	"cursor": "bold cyan", // the selected row of the browser
+}
+
+// applyTheme overrides theme entries with the config file's. Each value is one or more of
+// the names in colorCodes, separated by spaces.
+func applyTheme(overrides map[string]string) error {
+	for role, value := range overrides {
+		if _, ok := theme[role]; !ok {
+			return fmt.Errorf("unknown theme entry '%s'; available: %s", role, strings.Join(sortedKeys(theme), ", "))
+		}
+		for _, name := range strings.Fields(value) {
+			if _, ok := colorCodes[name]; !ok {
+				return fmt.Errorf("unknown color '%s' for theme entry '%s'; available: %s", name, role, strings.Join(sortedKeys(colorCodes), ", "))
+			}
+		}
+		theme[role] = value
+	}
+	return nil
+}
+
+// sgr returns the escape sequence that starts role's color, or "" for none.
+func sgr(role string) string {
+	var params []string
+	for _, name := range strings.Fields(theme[role]) {
+		if code := colorCodes[name]; code != "" {
+			params = append(params, code)
+		}
+	}
+	if len(params) == 0 {
+		return ""
+	}
+	return "\033[" + strings.Join(params, ";") + "m"
+}
+
+// paint wraps s in role's color when color is on for f.
+func paint(f *os.File, role, s string) string {
+	if role == "" || !colorEnabled(f) {
+		return s
+	}
+	start := sgr(role)
+	if start == "" {
+		return s
+	}
+	return start + s + "\033[0m"
+}
+
+// statusRole returns the theme role for an instance state, SSM ping status or target
+// health, or "" to leave it uncolored.
+func statusRole(status string) string {
+	switch strings.ToLower(status) {
+	case "running", "online", "healthy", "success":
+		return "good"
+	case "stopped", "terminated", "connectionlost", "inactive", "not registered", "unhealthy", "failed":
+		return "bad"
+	case "pending", "stopping", "shutting-down", "initial", "draining", "in progress":
+		return "warn"
+	case "unknown", "":
+		return "muted"
+	}
+	return ""
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/nkarisa/homebrew-aws-ssm-connect/pkg/inventory"
+	"golang.org/x/term"
+)
+
+// column is one column of the instance table.
+type column struct {
+	key    string
+	header string
+	width  int
+	value  func(inst Instance) string
+	// role, if set, returns the theme role the value is colored with.
+	role func(inst Instance) string
+}
+
+// tableColumns lists every column --columns can choose from, by key.
+var tableColumns = []column{
+	{key: "id", header: "INSTANCE ID", width: 20, value: func(inst Instance) string { return inst.InstanceID }},
+	{key: "name", header: "NAME", width: 30, value: func(inst Instance) string {
+		if inst.Name == "" {
+			return "N/A"
+		}
+		return inst.Name
+	}},
+	{key: "ip", header: "PRIVATE IP", width: 15, value: func(inst Instance) string { return inst.PrivateIPAddress }},
+	{key: "public-ip", header: "PUBLIC IP", width: 15, value: func(inst Instance) string { return inst.PublicIPAddress }},
+	{key: "dns", header: "PRIVATE DNS", width: 44, value: func(inst Instance) string { return inst.PrivateDNSName }},
+	{key: "state", header: "STATE", width: 13, value: func(inst Instance) string { return inst.State },
+		role: func(inst Instance) string { return statusRole(inst.State) }},
+	{key: "ssm", header: "SSM", width: 14, value: func(inst Instance) string { return inst.SSMStatus },
+		role: func(inst Instance) string { return statusRole(inst.SSMStatus) }},
+	{key: "agent", header: "AGENT", width: 16, value: func(inst Instance) string {
+		if inst.AgentOutdated {
+			return inst.AgentVersion + " (old)"
+		}
+		return inst.AgentVersion
+	}, role: func(inst Instance) string {
+		if inst.AgentOutdated {
+			return "warn"
+		}
+		return ""
+	}},
+	{key: "last-ping", header: "LAST PING", width: 10, value: func(inst Instance) string {
+		if inst.LastPing.IsZero() {
+			return ""
+		}
+		return formatAge(time.Since(inst.LastPing))
+	}},
+	{key: "type", header: "TYPE", width: 12, value: func(inst Instance) string { return inst.InstanceType }},
+	{key: "lifecycle", header: "LIFECYCLE", width: 14, value: func(inst Instance) string { return inst.Lifecycle },
+		role: func(inst Instance) string {
+			if inst.Lifecycle == inventory.LifecycleSpot {
+				return "warn"
+			}
+			return ""
+		}},
+	{key: "az", header: "AZ", width: 15, value: func(inst Instance) string { return inst.AvailabilityZone }},
+	{key: "vpc", header: "VPC", width: 21, value: func(inst Instance) string { return inst.VpcID }},
+	{key: "subnet", header: "SUBNET", width: 24, value: func(inst Instance) string { return inst.SubnetID }},
+	{key: "launch-time", header: "LAUNCHED", width: 16, value: func(inst Instance) string {
+		if inst.LaunchTime.IsZero() {
+			return ""
+		}
+		return inst.LaunchTime.Local().Format("2006-01-02 15:04")
+	}},
+	{key: "age", header: "AGE", width: 10, value: func(inst Instance) string {
+		if inst.LaunchTime.IsZero() {
+			return ""
+		}
+		return formatAge(time.Since(inst.LaunchTime))
+	}},
+	{key: "platform", header: "PLATFORM", width: 20, value: func(inst Instance) string { return inst.Platform }},
+	{key: "os", header: "OS", width: 8, value: func(inst Instance) string { return inst.OS() }},
+	{key: "region", header: "REGION", width: 15, value: func(inst Instance) string { return inst.Region }},
+	{key: "account", header: "ACCOUNT", width: 12, value: func(inst Instance) string { return inst.Account }},
+	{key: "health", header: "HEALTH", width: 12, value: func(inst Instance) string { return inst.Health },
+		role: func(inst Instance) string { return statusRole(inst.Health) }},
+	{key: "source", header: "SOURCE", width: 7, value: func(inst Instance) string {
+		if inst.Source == "" {
+			return inventory.SourceEC2
+		}
+		return inst.Source
+	}},
+}
+
+// defaultColumns is the table layout used unless --columns or the config file picks one.
+var defaultColumns = []string{"id", "name", "ip", "state", "ssm"}
+
+// findColumn returns the column with the given key, or nil.
+func findColumn(key string) *column {
+	for i := range tableColumns {
+		if tableColumns[i].key == key {
+			return &tableColumns[i]
+		}
+	}
+	return nil
+}
+
+// columnList is a flag.Value for --columns: a comma-separated list of column keys.
+type columnList []string
+
+func (c *columnList) String() string { return strings.Join(*c, ",") }
+
+func (c *columnList) Set(v string) error {
+	var keys []string
+	for _, key := range strings.Split(v, ",") {
+		key = strings.TrimSpace(strings.ToLower(key))
+		if key == "" {
+			continue
+		}
+		if findColumn(key) == nil {
+			return fmt.Errorf("unknown column '%s'; available: %s", key, strings.Join(columnKeys(), ", "))
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("no columns given")
+	}
+	*c = keys
+	return nil
+}
+
+func columnKeys() []string {
+	keys := make([]string, len(tableColumns))
+	for i, col := range tableColumns {
+		keys[i] = col.key
+	}
+	return keys
+}
+
+// tableColumns returns the columns to show: the chosen ones, or the default layout with
+// REGION, ACCOUNT, SOURCE and HEALTH columns added for --all-regions, --accounts, sources
+// other than EC2 and --target-group.
+func (o *options) tableColumns() []column {
+	keys := []string(o.Columns)
+	if len(keys) == 0 {
+		keys = defaultColumns
+		if o.AllRegions {
+			keys = append(keys[:len(keys):len(keys)], "region")
+		}
+		if len(o.Accounts) > 0 {
+			keys = append(keys[:len(keys):len(keys)], "account")
+		}
+		if !slices.Equal(o.instanceSources(), []string{inventory.SourceEC2}) {
+			keys = append(keys[:len(keys):len(keys)], "source")
+		}
+		if o.TargetGroup {
+			keys = append(keys[:len(keys):len(keys)], "health")
+		}
+	}
+	cols := make([]column, 0, len(keys))
+	for _, key := range keys {
+		if col := findColumn(key); col != nil {
+			cols = append(cols, *col)
+		}
+	}
+	return cols
+}
+
+// tableWidth is the width of a table row with the given columns.
+func tableWidth(cols []column) int {
+	width := 0
+	for _, col := range cols {
+		width += col.width + 1
+	}
+	return width - 1
+}
+
+// minFlexibleWidth is the narrowest a free-text column is squeezed to on a small terminal.
+const minFlexibleWidth = 10
+
+// flexibleColumns are shrunk, in this order, when the table is wider than the terminal.
+var flexibleColumns = []string{"name", "platform"}
+
+// fitToTerminal narrows the free-text columns so that a table indented by indent columns
+// fits the terminal. When the width is unknown the full layout is kept.
+func fitToTerminal(cols []column, indent int) []column {
+	available := terminalWidth() - indent
+	if available <= 0 {
+		return cols
+	}
+
+	fitted := append([]column(nil), cols...)
+	for _, key := range flexibleColumns {
+		excess := tableWidth(fitted) - available
+		if excess <= 0 {
+			break
+		}
+		for i := range fitted {
+			if fitted[i].key == key && fitted[i].width > minFlexibleWidth {
+				fitted[i].width = max(minFlexibleWidth, fitted[i].width-excess)
+			}
+		}
+	}
+	return fitted
+}
+
+// terminalWidth returns the width of the terminal on stdout, or of $COLUMNS, or 0 when
+// it is unknown.
+func terminalWidth() int {
+	if width, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil && width > 0 {
+		return width
+	}
+	if width, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil {
+		return width
+	}
+	return 0
+}
+
+// padCell fits s into width terminal cells: padded with spaces, or cut with an ellipsis
+// ("..." in plain output). Widths are measured in cells, so wide characters such as CJK
+// and emoji line up.
+func padCell(s string, width int) string {
+	if runewidth.StringWidth(s) > width {
+		ellipsis := "…"
+		if plainOutput {
+			ellipsis = "..."
+		}
+		s = runewidth.Truncate(s, width, ellipsis)
+	}
+	return runewidth.FillRight(s, width)
+}
@@ -0,0 +1,610 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/nkarisa/homebrew-aws-ssm-connect/pkg/inventory"
+	"github.com/nkarisa/homebrew-aws-ssm-connect/pkg/picker"
+	"golang.org/x/term"
+)
+
+// banner is printed by the interactive commands.
+const banner = "--- AWS EC2 Instance Lister (Interactive Selection) ---"
+
+// runConnect implements the connect command (and the default, argument-less invocation).
+func runConnect(ctx context.Context, args []string) int {
+	var opts options
+	var tmux, tmuxPanes, tmuxSync bool
+	var copyKey string
+	var console, code bool
+	var codeUser, codeFolder string
+	fs := newFlagSet(findCommand("connect"), &opts)
+	addDiscoveryFlags(fs, &opts)
+	addPickerFlags(fs, &opts)
+	addShellFlags(fs, &opts)
+	fs.BoolVar(&tmux, "tmux", false, "pick several instances and open each session in its own tmux window")
+	fs.BoolVar(&tmuxPanes, "tmux-panes", false, "with --tmux: tile the sessions as panes of one window instead")
+	fs.BoolVar(&tmuxSync, "tmux-sync", false, "with --tmux-panes: type into every pane at once")
+	fs.BoolVar(&opts.All, "all", false, "with --tmux: open every matching instance without prompting")
+	fs.StringVar(&copyKey, "copy", "", "copy this `column` of the picked instance (e.g. id or ip) to the clipboard instead of connecting")
+	fs.BoolVar(&console, "console", false, "open the picked instance in the AWS console in your browser instead of connecting")
+	fs.BoolVar(&code, "code", false, "open the picked instance in a VS Code Remote-SSH window instead of a shell")
+	fs.StringVar(&codeUser, "code-user", defaultSSHUser, "with --code: remote SSH `login` name")
+	fs.StringVar(&codeFolder, "code-folder", "", "with --code: open this remote `directory`")
+
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return flagErrorCode(err)
+	}
+	if len(positional) > 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	if len(positional) == 1 {
+		opts.Target = positional[0]
+	}
+	if copyKey != "" && findColumn(copyKey) == nil {
+		fmt.Fprintf(os.Stderr, "Error: unknown column '%s' for --copy; available: %s\n", copyKey, strings.Join(columnKeys(), ", "))
+		return exitUsage
+	}
+
+	fmt.Println(banner)
+	if copyKey != "" {
+		return copyTarget(ctx, &opts, copyKey)
+	}
+	if console {
+		return openConsole(ctx, &opts)
+	}
+	if code {
+		if len(opts.Accounts) > 0 {
+			fmt.Fprintln(os.Stderr, "Error: --code can't be combined with --accounts.")
+			return exitUsage
+		}
+		return openInCode(ctx, &opts, codeUser, codeFolder)
+	}
+	if tmux || tmuxPanes || tmuxSync {
+		if len(opts.Accounts) > 0 {
+			fmt.Fprintln(os.Stderr, "Error: --tmux can't be combined with --accounts.")
+			return exitUsage
+		}
+		if info, err := os.Stat(opts.Record); opts.Record != "" && (err != nil || !info.IsDir()) {
+			fmt.Fprintln(os.Stderr, "Error: with --tmux, --record must be an existing directory to hold one recording per window.")
+			return exitUsage
+		}
+		opts.Multi = !opts.All
+		_, targets, err := resolveTargets(ctx, &opts)
+		if err != nil {
+			return targetErrorCode(err, &opts)
+		}
+		return openInTmux(ctx, &opts, targets, tmuxPanes || tmuxSync, tmuxSync)
+	}
+	return pickAndConnect(ctx, &opts, nil)
+}
+
+// runForward implements the forward command: like connect, but tunnels a local port
+// instead of opening a shell.
+func runForward(ctx context.Context, args []string) int {
+	var opts options
+	var specs stringList
+	var background bool
+	var socksPort int
+	var user, identity string
+	var instanceConnect bool
+	fs := newFlagSet(findCommand("forward"), &opts)
+	addDiscoveryFlags(fs, &opts)
+	addPickerFlags(fs, &opts)
+	fs.Var(&specs, "L", "forward `localPort:[remoteHost:]remotePort` (repeatable, e.g. web, database and cache through one instance; a localPort of 0 picks a free one)")
+	fs.BoolVar(&background, "background", false, "run the tunnel in the background; manage it with the tunnels command")
+	fs.IntVar(&socksPort, "socks", 0, "instead of -L, run a SOCKS5 proxy on this local `port` through the instance (SSH over SSM)")
+	fs.StringVar(&user, "user", defaultSSHUser, "with --socks: remote SSH `login` name")
+	fs.StringVar(&identity, "i", "", "with --socks: SSH private key `file` to authenticate with")
+	addInstanceConnectFlag(fs, &instanceConnect)
+	addReconnectFlag(fs, &opts)
+	addDryRunFlag(fs, &opts)
+
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return flagErrorCode(err)
+	}
+	if len(positional) > 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	if len(positional) == 1 {
+		opts.Target = positional[0]
+	}
+
+	if socksPort != 0 {
+		if len(specs) > 0 || background {
+			fmt.Fprintln(os.Stderr, "Error: --socks can't be combined with -L or --background.")
+			return exitUsage
+		}
+		forwards := []portForward{{LocalPort: socksPort}}
+		if err := assignLocalPorts(forwards); err != nil {
+			return reportError(err)
+		}
+		fmt.Println(banner)
+		return startSocksProxy(ctx, &opts, forwards[0].LocalPort, user, identity, instanceConnect)
+	}
+
+	// Parse the specs up front so a typo doesn't cost an API round-trip.
+	if len(specs) == 0 {
+		specs = stringList{""}
+	}
+	var forwards []portForward
+	for _, spec := range specs {
+		forward, err := parsePortForward(spec)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+			fs.Usage()
+			return exitUsage
+		}
+		forwards = append(forwards, forward)
+	}
+	if err := assignLocalPorts(forwards); err != nil {
+		return reportError(err)
+	}
+
+	fmt.Println(banner)
+	if background {
+		return startBackgroundTunnel(ctx, &opts, forwards)
+	}
+	return pickAndConnect(ctx, &opts, forwards)
+}
+
+// runList implements the list command, printing the matching instances without prompting,
+// as a table or, with --output, as JSON, CSV or TSV for other scripts.
+func runList(ctx context.Context, args []string) int {
+	var opts options
+	var watch time.Duration
+	output := outputFormat("table")
+	fs := newFlagSet(findCommand("list"), &opts)
+	addDiscoveryFlags(fs, &opts)
+	fs.Var(&output, "output", "print the listing as `format`: "+strings.Join(outputFormats, ", "))
+	fs.DurationVar(&watch, "watch", 0, "refetch and print the table every `interval` (e.g. 10s), marking new and gone instances")
+
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return flagErrorCode(err)
+	}
+	if len(positional) > 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	if err := opts.applyFileConfig(); err != nil {
+		return reportError(err)
+	}
+
+	if watch > 0 && (output != "table" || opts.GroupBy != "") {
+		fmt.Fprintln(os.Stderr, "Error: --watch prints a plain table; it can't be combined with --output or --group-by.")
+		return exitUsage
+	}
+
+	cfg, err := resolveAWSConfig(ctx, &opts)
+	if err != nil {
+		return reportError(err)
+	}
+	if watch > 0 {
+		return watchList(ctx, cfg, &opts, watch)
+	}
+	instances, err := discoverInstances(ctx, cfg, &opts)
+	if err != nil {
+		return reportError(err)
+	}
+	if output != "table" {
+		if err := writeInstances(os.Stdout, instances, output); err != nil {
+			return reportError(err)
+		}
+		return exitOK
+	}
+	if len(instances) == 0 {
+		printNoInstances(&opts)
+		return exitOK
+	}
+
+	if opts.GroupBy != "" {
+		printGroupedTable(instances, &opts)
+		return exitOK
+	}
+	cols := fitToTerminal(opts.tableColumns(), 0)
+	fmt.Println(paintTableHeader(cols))
+	for _, inst := range instances {
+		fmt.Println(paintInstanceRow(inst, cols))
+	}
+	return exitOK
+}
+
+// runProxy implements the proxy command, meant to be used from ~/.ssh/config:
+//
+//	Host i-* mi-*
+//	    ProxyCommand aws-ssm-connect proxy %h %p --profile my-profile
+//
+// Nothing but the SSH stream may be written to stdout here.
+func runProxy(ctx context.Context, args []string) int {
+	var opts options
+	var pushKey, pushUser string
+	fs := newFlagSet(findCommand("proxy"), &opts)
+	addReasonFlag(fs, &opts)
+	fs.StringVar(&pushKey, "push-key", "", "push this public key `file` to the instance with EC2 Instance Connect before connecting")
+	fs.StringVar(&pushUser, "push-user", defaultSSHUser, "with --push-key: the `login` the key is pushed for (use %r in ~/.ssh/config)")
+
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return flagErrorCode(err)
+	}
+	if len(positional) < 1 || len(positional) > 2 {
+		fs.Usage()
+		return exitUsage
+	}
+	instanceID := positional[0]
+
+	port := 22
+	if len(positional) == 2 {
+		if port, err = parsePort(positional[1]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitUsage
+		}
+	}
+
+	if err := opts.applyFileConfig(); err != nil {
+		return reportError(err)
+	}
+	cfg, err := loadAWSConfig(ctx, opts.Profile, opts.Region)
+	if err != nil {
+		return reportError(fmt.Errorf("loading AWS configuration: %w", err))
+	}
+	if cfg.Region == "" {
+		return reportError(errors.New("no AWS region configured. Pass --region or set AWS_REGION"))
+	}
+	if cfg, err = applySSORole(ctx, cfg, &opts); err != nil {
+		return reportError(err)
+	}
+	if opts.RoleARN != "" {
+		if cfg, err = assumeRole(ctx, cfg, &opts); err != nil {
+			return reportError(err)
+		}
+	}
+	// ssh runs us without a terminal on stdin, so a protected instance has to have been
+	// confirmed by the aws-ssm-connect that started ssh.
+	if err := checkGuard(ctx, cfg, &opts, []Instance{{InstanceID: instanceID, Region: cfg.Region}}); err != nil {
+		return reportError(err)
+	}
+
+	if pushKey != "" && strings.HasPrefix(instanceID, "i-") {
+		public, err := os.ReadFile(pushKey)
+		if err == nil {
+			err = sendPublicKey(ctx, cfg, pushUser, instanceID, string(public))
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v; trying your other SSH keys.\n", err)
+		}
+	}
+
+	if err := startProxySession(ctx, cfg, &opts, instanceID, port); err != nil {
+		return reportError(err)
+	}
+	return exitOK
+}
+
+// runHelp implements the help command.
+func runHelp(ctx context.Context, args []string) int {
+	if len(args) == 0 {
+		printUsage(os.Stdout)
+		return exitOK
+	}
+	cmd := findCommand(args[0])
+	if cmd == nil || cmd.name == "help" {
+		fmt.Fprintf(os.Stderr, "Unknown command %q.\n\n", args[0])
+		printUsage(os.Stderr)
+		return exitUsage
+	}
+	return cmd.run(ctx, []string{"-h"})
+}
+
+// errNoInstances is returned by resolveTarget when nothing matches the filters.
+var errNoInstances = errors.New("no instances found")
+
+// pickAndConnect lets the user choose an instance and opens a shell or, when forwards are
+// given, port forwarding sessions to it.
+func pickAndConnect(ctx context.Context, opts *options, forwards []portForward) int {
+	cfg, target, err := resolveTarget(ctx, opts)
+	if err != nil {
+		return targetErrorCode(err, opts)
+	}
+	if err := ensureRunning(ctx, cfg, opts, target); err != nil {
+		return targetErrorCode(err, opts)
+	}
+	if !opts.DryRun {
+		recordHistory(opts, target)
+	}
+	return startSelectedSession(ctx, cfg, opts, target, forwards)
+}
+
+// resolveTarget returns the instance to act on and the AWS configuration for its region:
+// the instance given on the command line, the single match of a --name/--ip lookup, or
+// the user's pick from the listing, or a remembered connection.
+func resolveTarget(ctx context.Context, opts *options) (aws.Config, Instance, error) {
+	cfg, targets, err := resolveTargets(ctx, opts)
+	if err != nil {
+		return cfg, Instance{}, err
+	}
+	return targetConfig(ctx, cfg, opts, targets[0]), targets[0], nil
+}
+
+// resolveTargets is resolveTarget for commands that can act on several instances: with
+// --all every matching instance is returned, and with --multi the user may pick a list of
+// options (e.g. 1,3,5-9). Each instance carries the region it was found in. Instances
+// protected by the config file's guard policy must be confirmed, except for a dry run.
+func resolveTargets(ctx context.Context, opts *options) (aws.Config, []Instance, error) {
+	cfg, targets, err := findTargets(ctx, opts)
+	if err != nil || opts.DryRun {
+		return cfg, targets, err
+	}
+	if err := checkGuard(ctx, cfg, opts, targets); err != nil {
+		return cfg, nil, err
+	}
+	return cfg, targets, nil
+}
+
+// findTargets finds the instances resolveTargets returns.
+func findTargets(ctx context.Context, opts *options) (aws.Config, []Instance, error) {
+	// --last and --history come first, so the remembered profile beats the config file's.
+	if err := opts.applyHistory(); err != nil {
+		return aws.Config{}, nil, err
+	}
+	if err := opts.applyFileConfig(); err != nil {
+		return aws.Config{}, nil, err
+	}
+	if err := opts.applyAlias(); err != nil {
+		return aws.Config{}, nil, err
+	}
+
+	// A target given on the command line skips the listing and prompt entirely,
+	// so the tool can be used from scripts and shell aliases.
+	if opts.Target != "" {
+		cfg, err := resolveAWSConfig(ctx, opts)
+		if err != nil {
+			return cfg, nil, err
+		}
+		fmt.Fprintf(os.Stderr, "Using AWS Region: %s\n", cfg.Region)
+		return cfg, []Instance{{InstanceID: opts.Target, Region: cfg.Region, Account: opts.targetAccount}}, nil
+	}
+
+	// Piped targets (cat hosts.txt | aws-ssm-connect exec -- uptime) skip every prompt.
+	var batch []string
+	if opts.batchStdin && !opts.All && !term.IsTerminal(int(os.Stdin.Fd())) {
+		var err error
+		if batch, err = readBatchTargets(picker.Stdin); err != nil {
+			return aws.Config{}, nil, err
+		}
+	}
+	if len(batch) > 0 {
+		cfg, err := resolveAWSConfig(ctx, opts)
+		if err != nil {
+			return cfg, nil, err
+		}
+		targets, err := resolveBatchTargets(ctx, cfg, opts, batch)
+		return cfg, targets, err
+	}
+
+	// Rather than silently falling back to default credentials, let the user choose.
+	if err := pickProfile(opts); err != nil {
+		return aws.Config{}, nil, err
+	}
+	cfg, err := resolveAWSConfig(ctx, opts)
+	if err != nil {
+		return cfg, nil, err
+	}
+
+	instances, err := discoverInstances(ctx, cfg, opts)
+	if err != nil {
+		return cfg, nil, err
+	}
+	if len(instances) == 0 {
+		return cfg, nil, errNoInstances
+	}
+	if opts.All {
+		return cfg, instances, nil
+	}
+
+	// --name and --ip lookups skip the prompt when they resolve to one instance.
+	lookup := opts.Name != "" || opts.IP != ""
+	if lookup && len(instances) == 1 {
+		fmt.Fprintf(os.Stderr, "Found %s (%s).\n", instances[0].InstanceID, instances[0].Name)
+		return cfg, instances, nil
+	}
+	if lookup {
+		fmt.Printf("\n%d instances match; choose one.\n", len(instances))
+	}
+
+	// With --group-by the user first narrows the listing to one group.
+	if opts.GroupBy != "" {
+		if instances, err = pickGroup(instances, opts); err != nil {
+			return cfg, nil, err
+		}
+	}
+
+	if opts.Multi {
+		selected, err := promptForMultiSelection(instances, fitToTerminal(opts.tableColumns(), 9))
+		return cfg, selected, err
+	}
+	selected, err := selectInstance(instances, opts, func() ([]Instance, error) {
+		opts.Refresh = true
+		return discoverInstances(ctx, cfg, opts)
+	})
+	if err != nil {
+		return cfg, nil, err
+	}
+	return cfg, []Instance{selected}, nil
+}
+
+// targetErrorCode reports a resolveTarget error and returns the exit code for it. Quitting
+// the picker is not a failure, and an empty listing gets the no-instances exit code without
+// an error message.
+func targetErrorCode(err error, opts *options) int {
+	switch {
+	case errors.Is(err, errQuit):
+		fmt.Println("\nExiting program.")
+		return exitOK // Graceful exit on 'q'
+	case errors.Is(err, errNoInstances):
+		printNoInstances(opts)
+		return exitNoInstances
+	}
+	return reportError(err)
+}
+
+// startSelectedSession opens either a shell or, in forward mode, port forwarding sessions.
+func startSelectedSession(ctx context.Context, cfg aws.Config, opts *options, target Instance, forwards []portForward) int {
+	var err error
+	if len(forwards) > 0 {
+		err = startPortForwardSessions(ctx, cfg, opts, target.InstanceID, forwards)
+	} else {
+		err = startSSMSession(ctx, cfg, opts, target)
+	}
+	if err != nil {
+		return reportError(err)
+	}
+	return exitOK
+}
+
+// discoverInstances lists the instances matching opts, either in the configured region or
+// in every enabled region.
+func discoverInstances(ctx context.Context, cfg aws.Config, opts *options) ([]Instance, error) {
+	if opts.ASG {
+		if err := opts.applyASG(ctx, cfg); err != nil {
+			return nil, err
+		}
+	}
+	if opts.TargetGroup && opts.targetHealth == nil {
+		if err := opts.applyTargetGroup(ctx, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	// Tag filters are applied server-side by DescribeInstances.
+	filters, err := inventory.ParseTagFilters(opts.Tags)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only running instances can accept sessions, so hide the rest unless asked otherwise.
+	if !opts.AllStates {
+		states := opts.States
+		if len(states) == 0 {
+			states = []string{"running"}
+		}
+		filters = append(filters, inventory.StateFilter(states))
+	}
+
+	// --name and --ip narrow the listing server-side to the instance the user has in mind.
+	if opts.Name != "" {
+		filters = append(filters, types.Filter{Name: aws.String("tag:Name"), Values: []string{opts.Name}})
+	}
+	if opts.IP != "" {
+		filters = append(filters, types.Filter{Name: aws.String("private-ip-address"), Values: []string{opts.IP}})
+	}
+	if len(opts.VpcIDs) > 0 {
+		filters = append(filters, types.Filter{Name: aws.String("vpc-id"), Values: opts.VpcIDs})
+	}
+	if len(opts.SubnetIDs) > 0 {
+		filters = append(filters, types.Filter{Name: aws.String("subnet-id"), Values: opts.SubnetIDs})
+	}
+	filters = append(filters, inventory.SecurityGroupFilters(opts.Groups)...)
+	if opts.WindowsOnly {
+		filters = append(filters, types.Filter{Name: aws.String("platform"), Values: []string{"windows"}})
+	}
+	if opts.targetHealth != nil {
+		ids := slices.Sorted(maps.Keys(opts.targetHealth))
+		filters = append(filters, types.Filter{Name: aws.String("instance-id"), Values: ids})
+	}
+
+	// Repeated runs reuse a recent listing instead of waiting for the API again.
+	region := cfg.Region
+	if opts.AllRegions {
+		region = "all-regions"
+	}
+	scope := opts.credentialScope()
+	if sources := opts.instanceSources(); !slices.Equal(sources, []string{inventory.SourceEC2}) {
+		scope += "+" + strings.Join(sources, "+")
+	}
+	cachePath, cacheErr := inventoryCachePath(scope, region, filters)
+	if cacheErr == nil && !opts.Refresh && opts.CacheTTL > 0 {
+		if instances, age, ok := loadInventoryCache(cachePath, opts.CacheTTL); ok {
+			fmt.Fprintf(os.Stderr, "Using the instance list cached %s ago for %s (pass --refresh to update).\n", age.Round(time.Second), region)
+			return finishDiscovery(instances, opts), nil
+		}
+	}
+
+	var instances []Instance
+	switch {
+	case len(opts.Accounts) > 0:
+		instances, err = listInstancesAllAccounts(ctx, cfg, opts, filters)
+	case opts.AllRegions:
+		fmt.Fprintln(os.Stderr, "Searching all enabled regions...")
+		instances, err = listInstancesAllRegions(ctx, cfg, filters, opts, printRegionProgress)
+	default:
+		fmt.Fprintf(os.Stderr, "Using AWS Region: %s\n", cfg.Region)
+		instances, err = listInstancesWithSSMStatus(ctx, cfg, filters, opts.instanceSources(), printFetchProgress)
+		fmt.Fprintln(os.Stderr)
+	}
+	if err != nil {
+		return nil, withHints(fmt.Errorf("describing EC2 instances: %w", err),
+			"Is the specified profile configured for SSO and active (run 'aws sso login')?",
+			"Are your instances in a different region (try --region or --all-regions)?",
+			"Do you have the necessary EC2 permissions and SSM Agent running on the instances?")
+	}
+
+	if cacheErr == nil {
+		saveInventoryCache(cachePath, instances)
+	}
+	return finishDiscovery(instances, opts), nil
+}
+
+// finishDiscovery sorts the listing and applies the filters that work on the listing
+// itself rather than on the DescribeInstances call.
+func finishDiscovery(instances []Instance, opts *options) []Instance {
+	sortInstances(instances, opts.Sort)
+
+	// Target health changes too quickly to be cached with the listing.
+	if opts.targetHealth != nil {
+		for i := range instances {
+			instances[i].Health = opts.targetHealth[instances[i].InstanceID]
+		}
+	}
+
+	// Hide instances that would fail with TargetNotConnected if asked to.
+	if opts.SSMOnly {
+		instances = inventory.FilterOnline(instances)
+	}
+	if opts.Query.text != "" {
+		instances = filterQuery(instances, &opts.Query)
+	}
+	return instances
+}
+
+// printNoInstances explains an empty listing.
+func printNoInstances(opts *options) {
+	switch {
+	case opts.SSMOnly:
+		fmt.Println("\nNo SSM-reachable EC2 instances found.")
+	case opts.WindowsOnly:
+		fmt.Println("\nNo Windows EC2 instances found.")
+	case len(opts.Tags) > 0 || opts.Name != "" || opts.IP != "" || len(opts.VpcIDs) > 0 || len(opts.SubnetIDs) > 0 ||
+		len(opts.Groups) > 0 || opts.Query.text != "" || !opts.AllStates:
+		fmt.Println("\nNo EC2 instances found matching the filters.")
+		if !opts.AllStates {
+			fmt.Println("Only running instances are listed by default; pass --all-states to include the rest.")
+		}
+	default:
+		fmt.Println("\nNo EC2 instances found.")
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// The completion scripts are thin: they pass the words typed so far to the hidden
+// "__complete" command and offer whatever it prints, one candidate per line.
+
+const bashCompletion = `# bash completion for aws-ssm-connect
+# Add to ~/.bashrc:  source <(aws-ssm-connect completion bash)
+_aws_ssm_connect() {
+    local IFS=$'\n'
+    COMPREPLY=($(compgen -W "$(aws-ssm-connect __complete "${COMP_WORDS[@]:1:COMP_CWORD}")" -- "${COMP_WORDS[COMP_CWORD]}"))
+}
+complete -o default -F _aws_ssm_connect aws-ssm-connect
+`
+
+const zshCompletion = `#compdef aws-ssm-connect
+# zsh completion for aws-ssm-connect
+# Add to ~/.zshrc (after compinit):  source <(aws-ssm-connect completion zsh)
+_aws_ssm_connect() {
+    local -a candidates
+    candidates=(${(f)"$(aws-ssm-connect __complete "${(@)words[2,CURRENT]}")"})
+    compadd -a candidates
+}
+compdef _aws_ssm_connect aws-ssm-connect
+`
+
+const fishCompletion = `# fish completion for aws-ssm-connect
+# Save as ~/.config/fish/completions/aws-ssm-connect.fish:
+#   aws-ssm-connect completion fish > ~/.config/fish/completions/aws-ssm-connect.fish
+function __aws_ssm_connect_complete
+    aws-ssm-connect __complete (commandline -opc)[2..-1] (commandline -ct)
+end
+complete -c aws-ssm-connect -f -a '(__aws_ssm_connect_complete)'
+`
+
+// awsRegions are the commercial regions offered for --region. Completion has to be
+// instant, so it can't ask DescribeRegions.
+var awsRegions = []string{
+	"af-south-1", "ap-east-1", "ap-east-2", "ap-northeast-1", "ap-northeast-2", "ap-northeast-3",
+	"ap-south-1", "ap-south-2", "ap-southeast-1", "ap-southeast-2", "ap-southeast-3",
+	"ap-southeast-4", "ap-southeast-5", "ap-southeast-7", "ca-central-1", "ca-west-1",
+	"eu-central-1", "eu-central-2", "eu-north-1", "eu-south-1", "eu-south-2", "eu-west-1",
+	"eu-west-2", "eu-west-3", "il-central-1", "me-central-1", "me-south-1", "mx-central-1",
+	"sa-east-1", "us-east-1", "us-east-2", "us-west-1", "us-west-2",
+}
+
+// instanceStates are the values accepted by --state.
+var instanceStates = []string{"pending", "running", "shutting-down", "stopped", "stopping", "terminated"}
+
+// runCompletion implements the completion command, printing the script for a shell.
+func runCompletion(ctx context.Context, args []string) int {
+	cmd := findCommand("completion")
+	usage := func(w io.Writer) {
+		fmt.Fprintf(w, "Usage: aws-ssm-connect %s\n\n%s.\n", cmd.usage, cmd.summary)
+	}
+	if len(args) != 1 {
+		usage(os.Stderr)
+		return exitUsage
+	}
+	switch args[0] {
+	case "bash":
+		fmt.Print(bashCompletion)
+	case "zsh":
+		fmt.Print(zshCompletion)
+	case "fish":
+		fmt.Print(fishCompletion)
+	case "-h", "--help":
+		usage(os.Stdout)
+	default:
+		fmt.Fprintf(os.Stderr, "Unsupported shell %q: expected bash, zsh or fish.\n", args[0])
+		return exitUsage
+	}
+	return exitOK
+}
+
+// runComplete implements the hidden __complete command used by the completion scripts.
+// args are the words after the program name; the last one is the word being completed.
+func runComplete(ctx context.Context, args []string) int {
+	for _, candidate := range completeWords(ctx, args) {
+		fmt.Println(candidate)
+	}
+	return exitOK
+}
+
+// completeWords returns the completion candidates for the last of words. Filtering by
+// prefix is left to the shell.
+func completeWords(ctx context.Context, words []string) []string {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	current := words[len(words)-1]
+	cmd := findCommand("connect")
+	if len(words) > 1 && findCommand(words[0]) != nil {
+		cmd = findCommand(words[0])
+	}
+
+	// The value of a flag given as a separate word.
+	if len(words) > 1 {
+		switch strings.TrimLeft(words[len(words)-2], "-") {
+		case "profile":
+			return listAWSProfiles()
+		case "region":
+			return awsRegions
+		case "state":
+			return instanceStates
+		case "name":
+			var names []string
+			for _, inst := range knownInstances() {
+				if inst.Name != "" {
+					names = append(names, inst.Name)
+				}
+			}
+			return names
+		case "target":
+			return knownInstanceIDs()
+		case "vpc-id":
+			return knownValues(func(inst Instance) string { return inst.VpcID })
+		case "subnet-id":
+			return knownValues(func(inst Instance) string { return inst.SubnetID })
+		}
+	}
+
+	switch {
+	case strings.HasPrefix(current, "-"):
+		return commandFlags(ctx, cmd)
+	case len(words) == 1:
+		return append(append(commandNames(), aliasNames()...), knownInstanceIDs()...)
+	case cmd.name == "help":
+		return commandNames()
+	case cmd.name == "completion":
+		return []string{"bash", "zsh", "fish"}
+	case cmd.name == "tunnels" && len(words) == 2:
+		return []string{"list", "stop"}
+	case cmd.name == "tunnels":
+		return tunnelIDs()
+	}
+	return append(aliasNames(), knownInstanceIDs()...)
+}
+
+// aliasNames returns the aliases of every profile.
+func aliasNames() []string {
+	aliases, _ := loadAliases()
+	var names []string
+	for _, byName := range aliases {
+		for name := range byName {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func commandNames() []string {
+	names := make([]string, 0, len(commands))
+	for _, cmd := range commands {
+		names = append(names, cmd.name)
+	}
+	return names
+}
+
+// knownValues returns the distinct non-empty values of a field of the cached instances.
+func knownValues(field func(Instance) string) []string {
+	seen := map[string]bool{}
+	var values []string
+	for _, inst := range knownInstances() {
+		if v := field(inst); v != "" && !seen[v] {
+			seen[v] = true
+			values = append(values, v)
+		}
+	}
+	sort.Strings(values)
+	return values
+}
+
+// knownInstanceIDs returns the IDs of the cached instances.
+func knownInstanceIDs() []string {
+	var ids []string
+	for _, inst := range knownInstances() {
+		ids = append(ids, inst.InstanceID)
+	}
+	return ids
+}
+
+// describeFlags, when set, receives the flag set of a command asked for -h instead of
+// printing its usage. It lets completion discover each command's flags from the command
+// itself.
+var describeFlags func(fs *flag.FlagSet)
+
+// commandFlags returns the flags of cmd as "--name". Commands whose usage has no [flags]
+// don't parse any, and are not run.
+func commandFlags(ctx context.Context, cmd *command) []string {
+	if !strings.Contains(cmd.usage, "[flags]") {
+		return nil
+	}
+	var names []string
+	describeFlags = func(fs *flag.FlagSet) {
+		fs.VisitAll(func(f *flag.Flag) {
+			if f.Usage != "" { // Internal flags are not offered.
+				names = append(names, "--"+f.Name)
+			}
+		})
+	}
+	defer func() { describeFlags = nil }()
+	cmd.run(ctx, []string{"-h"})
+	return names
+}
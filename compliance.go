@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// runCompliance implements the compliance command: a summary of what Systems Manager knows
+// about one instance — its patch state, its compliance by type (Patch, Association and
+// custom types), and the OS and agent packages from its inventory:
+//
+//	aws-ssm-connect compliance i-0abc
+//
+// It only reads, so unlike the session commands it doesn't ask for the guard policy's
+// confirmation.
+func runCompliance(ctx context.Context, args []string) int {
+	var opts options
+	fs := newFlagSet(findCommand("compliance"), &opts)
+	addDiscoveryFlags(fs, &opts)
+	addPickerFlags(fs, &opts)
+
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return flagErrorCode(err)
+	}
+	if len(positional) > 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	if len(positional) == 1 {
+		opts.Target = positional[0]
+	}
+
+	fmt.Println(banner)
+	cfg, targets, err := findTargets(ctx, &opts)
+	if err != nil {
+		return targetErrorCode(err, &opts)
+	}
+	target := targets[0]
+	cfg = targetConfig(ctx, cfg, &opts, target)
+	client := ssm.NewFromConfig(cfg)
+
+	fmt.Printf("\n%s\n", paint(os.Stdout, "header", "Instance "+hostLabel(target)))
+	// Each section is reported on its own, so missing permissions for one don't hide the
+	// others.
+	failed := false
+	for _, section := range []struct {
+		title string
+		print func(context.Context, *ssm.Client, string) error
+	}{
+		{"Patches", printPatchState},
+		{"Compliance", printComplianceSummary},
+		{"Inventory", printInventorySummary},
+	} {
+		fmt.Printf("\n%s\n", paint(os.Stdout, "header", section.title))
+		if err := section.print(ctx, client, target.InstanceID); err != nil {
+			fmt.Fprintf(os.Stderr, "  %v\n", describeAPIError(err))
+			failed = true
+		}
+	}
+	if failed {
+		return exitError
+	}
+	return exitOK
+}
+
+// printPatchState prints the instance's patch counts from its last Patch Manager scan or
+// install.
+func printPatchState(ctx context.Context, client *ssm.Client, instanceID string) error {
+	out, err := client.DescribeInstancePatchStates(ctx, &ssm.DescribeInstancePatchStatesInput{InstanceIds: []string{instanceID}})
+	if err != nil {
+		return err
+	}
+	if len(out.InstancePatchStates) == 0 {
+		fmt.Println("  No Patch Manager scan has been reported for this instance.")
+		return nil
+	}
+	state := out.InstancePatchStates[0]
+	missing := fmt.Sprint(state.MissingCount)
+	if state.MissingCount > 0 || aws.ToInt32(state.CriticalNonCompliantCount) > 0 {
+		missing = paint(os.Stdout, "bad", missing)
+	}
+	fmt.Printf("  %-26s %s, %s\n", "Last operation", state.Operation, aws.ToTime(state.OperationEndTime).Local().Format("2006-01-02 15:04"))
+	fmt.Printf("  %-26s %s\n", "Baseline", aws.ToString(state.BaselineId))
+	fmt.Printf("  %-26s %d\n", "Installed", state.InstalledCount)
+	fmt.Printf("  %-26s %s\n", "Missing", missing)
+	fmt.Printf("  %-26s %d\n", "Failed", state.FailedCount)
+	fmt.Printf("  %-26s %d\n", "Installed, pending reboot", aws.ToInt32(state.InstalledPendingRebootCount))
+	fmt.Printf("  %-26s %d critical, %d security\n", "Non-compliant", aws.ToInt32(state.CriticalNonCompliantCount), aws.ToInt32(state.SecurityNonCompliantCount))
+	return nil
+}
+
+// printComplianceSummary prints the compliant and non-compliant item counts of each
+// compliance type reported for the instance, naming the non-compliant items.
+func printComplianceSummary(ctx context.Context, client *ssm.Client, instanceID string) error {
+	type counts struct {
+		compliant    int
+		noncompliant []string
+	}
+	byType := map[string]*counts{}
+	paginator := ssm.NewListComplianceItemsPaginator(client, &ssm.ListComplianceItemsInput{
+		ResourceIds:   []string{instanceID},
+		ResourceTypes: []string{"ManagedInstance"},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		for _, item := range page.ComplianceItems {
+			c := byType[aws.ToString(item.ComplianceType)]
+			if c == nil {
+				c = &counts{}
+				byType[aws.ToString(item.ComplianceType)] = c
+			}
+			if item.Status == ssmtypes.ComplianceStatusCompliant {
+				c.compliant++
+				continue
+			}
+			name := aws.ToString(item.Title)
+			if name == "" {
+				name = aws.ToString(item.Id)
+			}
+			if item.Severity != "" && item.Severity != ssmtypes.ComplianceSeverityUnspecified {
+				name += " (" + strings.ToLower(string(item.Severity)) + ")"
+			}
+			c.noncompliant = append(c.noncompliant, name)
+		}
+	}
+	if len(byType) == 0 {
+		fmt.Println("  No compliance data has been reported for this instance.")
+		return nil
+	}
+
+	types := make([]string, 0, len(byType))
+	for t := range byType {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	for _, t := range types {
+		c := byType[t]
+		status := paint(os.Stdout, "good", "COMPLIANT")
+		if len(c.noncompliant) > 0 {
+			status = paint(os.Stdout, "bad", "NON_COMPLIANT")
+		}
+		fmt.Printf("  %-26s %s (%d compliant, %d non-compliant)\n", t, status, c.compliant, len(c.noncompliant))
+		for _, name := range c.noncompliant {
+			fmt.Printf("    - %s\n", name)
+		}
+	}
+	return nil
+}
+
+// agentPackageMarkers pick the agent packages out of the instance's application inventory.
+var agentPackageMarkers = []string{"agent", "aws-cfn-bootstrap", "ecs-init"}
+
+// printInventorySummary prints the OS and agent entries of the instance's inventory, as
+// collected by an AWS-GatherSoftwareInventory association.
+func printInventorySummary(ctx context.Context, client *ssm.Client, instanceID string) error {
+	info, captured, err := listInventoryEntries(ctx, client, instanceID, "AWS:InstanceInformation")
+	if err != nil {
+		return err
+	}
+	if len(info) == 0 {
+		fmt.Println("  No inventory has been collected for this instance.")
+		return nil
+	}
+	entry := info[0]
+	fmt.Printf("  %-26s %s %s\n", "OS", entry["PlatformName"], entry["PlatformVersion"])
+	fmt.Printf("  %-26s %s\n", "Computer name", entry["ComputerName"])
+	fmt.Printf("  %-26s %s\n", "SSM agent", entry["AgentVersion"])
+
+	apps, _, err := listInventoryEntries(ctx, client, instanceID, "AWS:Application")
+	if err != nil {
+		return err
+	}
+	var agents []string
+	for _, app := range apps {
+		name := strings.ToLower(app["Name"])
+		for _, marker := range agentPackageMarkers {
+			if strings.Contains(name, marker) {
+				agents = append(agents, fmt.Sprintf("%s %s", app["Name"], app["Version"]))
+				break
+			}
+		}
+	}
+	sort.Strings(agents)
+	for _, agent := range agents {
+		fmt.Printf("  %-26s %s\n", "Installed", agent)
+	}
+	if at, err := time.Parse(time.RFC3339, captured); err == nil {
+		fmt.Printf("  %-26s %s\n", "Collected", formatAge(time.Since(at)))
+	}
+	return nil
+}
+
+// listInventoryEntries returns every entry of one inventory type for the instance, and
+// when it was collected.
+func listInventoryEntries(ctx context.Context, client *ssm.Client, instanceID, typeName string) ([]map[string]string, string, error) {
+	var entries []map[string]string
+	input := &ssm.ListInventoryEntriesInput{InstanceId: aws.String(instanceID), TypeName: aws.String(typeName)}
+	for {
+		page, err := client.ListInventoryEntries(ctx, input)
+		if err != nil {
+			return nil, "", err
+		}
+		entries = append(entries, page.Entries...)
+		if page.NextToken == nil {
+			return entries, aws.ToString(page.CaptureTime), nil
+		}
+		input.NextToken = page.NextToken
+	}
+}
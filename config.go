@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fileConfig holds the defaults read from config.yaml and the project's
+// .aws-ssm-connect.yaml. Every field is optional and any value given on the command line
+// or in the environment takes precedence over the files.
+//
+// Example ~/.config/aws-ssm-connect/config.yaml:
+//
+//	profile: prod
+//	region: eu-west-1
+//	tags:
+//	  - Team=platform
+//	states: [running, stopped]
+//	accounts: ["111111111111", "222222222222"]
+//	account_role: ReadOnlyOperator
+//	document: My-Hardened-Shell
+//	parameters:
+//	  shellProfile: bash
+//	log_session: true
+//	hybrid: true
+//	sources: [ec2, ecs]
+//	reconnect: 3
+//	sort: launch-time
+//	group_by: stack
+//	columns: [id, name, ip, type, az]
+//	cache_ttl: 10m
+//	fetch_concurrency: 4
+//	fetch_timeout: 1m
+//	no_color: false
+//	plain: false
+//	theme:
+//	  good: cyan
+//	  header: bold blue
+//	env: prod-eu
+//	presets:
+//	  prod-eu:
+//	    profile: prod
+//	    region: eu-west-1
+//	    tags: [Env=prod]
+//	guard:
+//	  tags: [Env=prod]
+//	  confirm: name
+//	  reason: true
+//	notify:
+//	  slack: https://hooks.slack.com/services/T000/B000/XXXX
+type fileConfig struct {
+	Profile     string            `yaml:"profile"`
+	Region      string            `yaml:"region"`
+	Tags        []string          `yaml:"tags"`
+	States      []string          `yaml:"states"`
+	Accounts    []string          `yaml:"accounts"`
+	AccountRole string            `yaml:"account_role"`
+	Document    string            `yaml:"document"`
+	Parameters  map[string]string `yaml:"parameters"`
+	LogSession  bool              `yaml:"log_session"`
+	Hybrid      bool              `yaml:"hybrid"`
+	Sources     []string          `yaml:"sources"`
+	Reconnect   int               `yaml:"reconnect"`
+	Sort        string            `yaml:"sort"`
+	GroupBy     string            `yaml:"group_by"`
+	Columns     []string          `yaml:"columns"`
+	NoColor     bool              `yaml:"no_color"`
+	Plain       bool              `yaml:"plain"`
+	Theme       map[string]string `yaml:"theme"`
+	Env         string            `yaml:"env"`
+	Presets     map[string]preset `yaml:"presets"`
+	Guard       guardConfig       `yaml:"guard"`
+	Notify      notifyConfig      `yaml:"notify"`
+
+	FetchConcurrency int `yaml:"fetch_concurrency"`
+
+	// CacheTTL is a pointer so that an explicit 0 (no caching) differs from unset.
+	CacheTTL *time.Duration `yaml:"cache_ttl"`
+	// FetchTimeout is a pointer for the same reason: 0 means no timeout.
+	FetchTimeout *time.Duration `yaml:"fetch_timeout"`
+}
+
+// configDir returns the XDG-compliant configuration directory for the tool:
+// $XDG_CONFIG_HOME/aws-ssm-connect, falling back to ~/.config/aws-ssm-connect.
+func configDir() (string, error) {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "aws-ssm-connect"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", "aws-ssm-connect"), nil
+}
+
+// projectConfigName is the per-project config file, looked for in the current directory
+// and its parents.
+const projectConfigName = ".aws-ssm-connect.yaml"
+
+// loadFileConfig reads config.yaml from the config directory, then the nearest
+// .aws-ssm-connect.yaml, whose keys take precedence, so that e.g. a service's repository
+// can scope the tool to its profile, region and tags. Missing files are not an error;
+// they simply yield empty defaults.
+func loadFileConfig() (fileConfig, error) {
+	var cfg fileConfig
+
+	if dir, err := configDir(); err == nil {
+		if err := readConfigFile(filepath.Join(dir, "config.yaml"), &cfg); err != nil {
+			return cfg, err
+		}
+	}
+	if path := findProjectConfig(); path != "" {
+		if err := readConfigFile(path, &cfg); err != nil {
+			return cfg, err
+		}
+	}
+	return cfg, nil
+}
+
+// readConfigFile decodes the YAML file at path over cfg: the keys it sets replace those
+// already in cfg, and the others are kept. A missing file is skipped.
+func readConfigFile(path string, cfg *fileConfig) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", path, err)
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return nil
+}
+
+// findProjectConfig returns the path of the .aws-ssm-connect.yaml in the current directory
+// or the closest of its parents, or "" if there is none.
+func findProjectConfig() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	for {
+		path := filepath.Join(dir, projectConfigName)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
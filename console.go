@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"runtime"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+)
+
+// consoleHost returns the AWS Management Console host of region's partition.
+func consoleHost(region string) string {
+	switch regionPartition(region) {
+	case "aws-cn":
+		return "console.amazonaws.cn"
+	case "aws-us-gov":
+		return "console.amazonaws-us-gov.com"
+	}
+	return region + ".console.aws.amazon.com"
+}
+
+// consoleURL returns the console page of inst: the EC2 instance details, the Fleet Manager
+// node of a hybrid server, or the ECS task.
+func consoleURL(inst Instance) string {
+	base := "https://" + consoleHost(inst.Region)
+	region := url.QueryEscape(inst.Region)
+	switch {
+	case strings.HasPrefix(inst.InstanceID, "mi-"):
+		return fmt.Sprintf("%s/systems-manager/fleet-manager/managed-nodes/%s/general?region=%s", base, inst.InstanceID, region)
+	case strings.HasPrefix(inst.InstanceID, "ecs:"):
+		// ecs:<cluster>_<task>_<runtime id>; cluster names may contain underscores too.
+		if parts := strings.Split(strings.TrimPrefix(inst.InstanceID, "ecs:"), "_"); len(parts) >= 3 {
+			cluster := strings.Join(parts[:len(parts)-2], "_")
+			return fmt.Sprintf("%s/ecs/v2/clusters/%s/tasks/%s?region=%s", base, cluster, parts[len(parts)-2], region)
+		}
+	}
+	return fmt.Sprintf("%s/ec2/home?region=%s#InstanceDetails:instanceId=%s", base, region, inst.InstanceID)
+}
+
+// consoleLink returns the link that opens inst in the console. For an IAM Identity Center
+// (SSO) profile it goes through the AWS access portal, which signs the browser in to the
+// profile's account and role first.
+func consoleLink(ctx context.Context, opts *options, inst Instance) string {
+	destination := consoleURL(inst)
+	profile, err := config.LoadSharedConfigProfile(ctx, profileName(opts.Profile))
+	if err != nil {
+		return destination
+	}
+	startURL := profile.SSOStartURL
+	if profile.SSOSession != nil {
+		startURL = profile.SSOSession.SSOStartURL
+	}
+	account, role := profile.SSOAccountID, profile.SSORoleName
+	if opts.SSOAccount != "" {
+		account, role = opts.SSOAccount, opts.SSORole
+	}
+	// Instances of other --accounts are reached through --account-role, not the portal.
+	if startURL == "" || account == "" || role == "" || (inst.Account != "" && inst.Account != account) {
+		return destination
+	}
+	return fmt.Sprintf("%s/#/console?account_id=%s&role_name=%s&destination=%s", strings.TrimRight(startURL, "/#"),
+		url.QueryEscape(account), url.QueryEscape(role), url.QueryEscape(destination))
+}
+
+// openBrowser opens link in the default web browser.
+func openBrowser(ctx context.Context, link string) error {
+	var name string
+	var args []string
+	switch runtime.GOOS {
+	case "darwin":
+		name, args = "open", []string{link}
+	case "windows":
+		name, args = "rundll32", []string{"url.dll,FileProtocolHandler", link}
+	default:
+		name, args = "xdg-open", []string{link}
+	}
+	path, err := executor.LookPath(name)
+	if err != nil {
+		return fmt.Errorf("no way to open a browser was found (%s); open %s yourself", name, link)
+	}
+	debugCommand(path, args)
+	if err := executor.Run(ctx, path, args, nil, nil, nil); err != nil {
+		return fmt.Errorf("opening the browser: %w", err)
+	}
+	return nil
+}
+
+// openConsole implements connect --console: pick an instance as usual, but open its console
+// page in the browser instead of connecting.
+func openConsole(ctx context.Context, opts *options) int {
+	_, targets, err := findTargets(ctx, opts)
+	if err != nil {
+		return targetErrorCode(err, opts)
+	}
+	link := consoleLink(ctx, opts, targets[0])
+	fmt.Printf("\nOpening %s in the console:\n  %s\n", hostLabel(targets[0]), link)
+	if err := openBrowser(ctx, link); err != nil {
+		return reportError(err)
+	}
+	return exitOK
+}
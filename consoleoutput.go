@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/smithy-go"
+	"golang.org/x/term"
+)
+
+// runConsoleOutput implements the console-output command: show what an instance wrote to
+// its serial console while booting (kernel messages, cloud-init, the SSM Agent's start),
+// which explains most instances that run but never come online in SSM:
+//
+//	aws-ssm-connect console-output i-0abc
+//
+// In a terminal the output is shown in $PAGER (less by default), starting at the end.
+func runConsoleOutput(ctx context.Context, args []string) int {
+	var opts options
+	var noPager bool
+	fs := newFlagSet(findCommand("console-output"), &opts)
+	addDiscoveryFlags(fs, &opts)
+	addPickerFlags(fs, &opts)
+	fs.BoolVar(&noPager, "no-pager", false, "print the output instead of opening it in $PAGER")
+
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return flagErrorCode(err)
+	}
+	if len(positional) > 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	if len(positional) == 1 {
+		opts.Target = positional[0]
+	}
+
+	fmt.Fprintln(os.Stderr, banner)
+	// Reading the console changes nothing, so the guard policy isn't consulted.
+	cfg, targets, err := findTargets(ctx, &opts)
+	if err != nil {
+		return targetErrorCode(err, &opts)
+	}
+	target := targets[0]
+	if !strings.HasPrefix(target.InstanceID, "i-") {
+		return reportError(fmt.Errorf("%s is not an EC2 instance; only EC2 instances have a console", target.InstanceID))
+	}
+
+	output, err := consoleOutput(ctx, ec2.NewFromConfig(targetConfig(ctx, cfg, &opts, target)), target.InstanceID)
+	if err != nil {
+		return reportError(err)
+	}
+	if output == "" {
+		fmt.Fprintf(os.Stderr, "%s has no console output yet. EC2 keeps it only after the instance has booted.\n", hostLabel(target))
+		return exitOK
+	}
+	if noPager || plainOutput || !term.IsTerminal(int(os.Stdout.Fd())) {
+		fmt.Print(output)
+		return exitOK
+	}
+	if err := showInPager(ctx, output); err != nil {
+		return reportError(err)
+	}
+	return exitOK
+}
+
+// consoleOutput returns the decoded console output of an instance: the latest output where
+// the instance type supports it (Nitro), otherwise the last 64 KB EC2 captured.
+func consoleOutput(ctx context.Context, client *ec2.Client, instanceID string) (string, error) {
+	out, err := client.GetConsoleOutput(ctx, &ec2.GetConsoleOutputInput{InstanceId: aws.String(instanceID), Latest: aws.Bool(true)})
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == "UnsupportedOperation" {
+		out, err = client.GetConsoleOutput(ctx, &ec2.GetConsoleOutputInput{InstanceId: aws.String(instanceID)})
+	}
+	if err != nil {
+		return "", withHints(fmt.Errorf("getting the console output of %s: %w", instanceID, describeAPIError(err)),
+			"You are not allowed to call ec2:GetConsoleOutput on the instance.")
+	}
+	data, err := base64.StdEncoding.DecodeString(aws.ToString(out.Output))
+	if err != nil {
+		return "", fmt.Errorf("decoding the console output: %w", err)
+	}
+	return string(data), nil
+}
+
+// showInPager shows text in the user's $PAGER, or less, scrolled to the end. Without
+// either it is printed.
+func showInPager(ctx context.Context, text string) error {
+	pager := strings.Fields(os.Getenv("PAGER"))
+	if len(pager) == 0 {
+		pager = []string{"less"}
+	}
+	path, err := executor.LookPath(pager[0])
+	if err != nil {
+		fmt.Print(text)
+		return nil
+	}
+	args := pager[1:]
+	if filepath.Base(pager[0]) == "less" && len(args) == 0 {
+		args = []string{"-R", "+G"}
+	}
+	debugCommand(path, args)
+	if err := executor.Run(ctx, path, args, strings.NewReader(text), os.Stdout, os.Stderr); err != nil {
+		if _, ok := exitCode(err); ok {
+			return nil // Quitting some pagers early is not a failure.
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	"github.com/nkarisa/homebrew-aws-ssm-connect/pkg/picker"
+)
+
+// database is an RDS instance or Aurora cluster endpoint that db can tunnel to.
+type database struct {
+	ID       string
+	Kind     string // "writer", "reader" or "instance"
+	Engine   string
+	Host     string
+	Port     int
+	DBName   string
+	Username string
+}
+
+// runDb implements the db command: pick a jump instance and an RDS or Aurora endpoint in
+// its region, forward a local port to the endpoint through the instance, and print a
+// connection command for the database's client.
+func runDb(ctx context.Context, args []string) int {
+	var opts options
+	var dbID string
+	var localPort int
+	fs := newFlagSet(findCommand("db"), &opts)
+	addDiscoveryFlags(fs, &opts)
+	addPickerFlags(fs, &opts)
+	fs.StringVar(&dbID, "db", "", "tunnel to the database or cluster with this `identifier` without prompting")
+	fs.IntVar(&localPort, "local-port", 0, "local `port` to listen on (default: the database's port, or a free one if that is taken)")
+	addReconnectFlag(fs, &opts)
+	addDryRunFlag(fs, &opts)
+
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return flagErrorCode(err)
+	}
+	if len(positional) > 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	if len(positional) == 1 {
+		opts.Target = positional[0]
+	}
+
+	fmt.Println(banner)
+	cfg, target, err := resolveTarget(ctx, &opts)
+	if err != nil {
+		return targetErrorCode(err, &opts)
+	}
+
+	databases, err := listDatabases(ctx, cfg)
+	if err != nil {
+		return reportError(err)
+	}
+	db, err := selectDatabase(databases, dbID, cfg.Region, opts.Numbered)
+	if err != nil {
+		return targetErrorCode(err, &opts)
+	}
+
+	if localPort == 0 {
+		localPort = db.Port
+	}
+	forwards := []portForward{{LocalPort: localPort, RemoteHost: db.Host, RemotePort: db.Port}}
+	if err := assignLocalPorts(forwards); err != nil {
+		return reportError(err)
+	}
+	if err := ensureRunning(ctx, cfg, &opts, target); err != nil {
+		return targetErrorCode(err, &opts)
+	}
+	if !opts.DryRun {
+		recordHistory(&opts, target)
+		if command := databaseClientCommand(db, forwards[0].LocalPort); command != "" {
+			fmt.Printf("\nOnce the tunnel is up, connect with:\n  %s\n", command)
+		}
+	}
+	return startSelectedSession(ctx, cfg, &opts, target, forwards)
+}
+
+// listDatabases returns the Aurora cluster endpoints and the RDS instances that are not
+// part of a cluster, in the region of cfg.
+func listDatabases(ctx context.Context, cfg aws.Config) ([]database, error) {
+	client := rds.NewFromConfig(cfg)
+	var databases []database
+
+	clusters := rds.NewDescribeDBClustersPaginator(client, &rds.DescribeDBClustersInput{})
+	for clusters.HasMorePages() {
+		page, err := clusters.NextPage(ctx)
+		if err != nil {
+			return nil, withHints(fmt.Errorf("listing Aurora clusters: %w", describeAPIError(err)),
+				"You are not allowed to call rds:DescribeDBClusters.")
+		}
+		for _, c := range page.DBClusters {
+			db := database{
+				ID:       aws.ToString(c.DBClusterIdentifier),
+				Engine:   aws.ToString(c.Engine),
+				Port:     int(aws.ToInt32(c.Port)),
+				DBName:   aws.ToString(c.DatabaseName),
+				Username: aws.ToString(c.MasterUsername),
+			}
+			if c.Endpoint != nil {
+				db.Kind, db.Host = "writer", aws.ToString(c.Endpoint)
+				databases = append(databases, db)
+			}
+			if c.ReaderEndpoint != nil {
+				db.Kind, db.Host = "reader", aws.ToString(c.ReaderEndpoint)
+				databases = append(databases, db)
+			}
+		}
+	}
+
+	instances := rds.NewDescribeDBInstancesPaginator(client, &rds.DescribeDBInstancesInput{})
+	for instances.HasMorePages() {
+		page, err := instances.NextPage(ctx)
+		if err != nil {
+			return nil, withHints(fmt.Errorf("listing RDS instances: %w", describeAPIError(err)),
+				"You are not allowed to call rds:DescribeDBInstances.")
+		}
+		for _, i := range page.DBInstances {
+			// Cluster members are reached through the cluster endpoints above.
+			if i.DBClusterIdentifier != nil || i.Endpoint == nil {
+				continue
+			}
+			databases = append(databases, database{
+				ID:       aws.ToString(i.DBInstanceIdentifier),
+				Kind:     "instance",
+				Engine:   aws.ToString(i.Engine),
+				Host:     aws.ToString(i.Endpoint.Address),
+				Port:     int(aws.ToInt32(i.Endpoint.Port)),
+				DBName:   aws.ToString(i.DBName),
+				Username: aws.ToString(i.MasterUsername),
+			})
+		}
+	}
+
+	sort.SliceStable(databases, func(a, b int) bool { return databases[a].ID < databases[b].ID })
+	return databases, nil
+}
+
+// selectDatabase returns the database named by --db or lets the user pick one. A cluster
+// name picks its writer endpoint.
+func selectDatabase(databases []database, id, region string, numbered bool) (database, error) {
+	if len(databases) == 0 {
+		return database{}, fmt.Errorf("no RDS or Aurora databases found in %s", region)
+	}
+	if id != "" {
+		for _, db := range databases {
+			if db.ID == id && db.Kind != "reader" {
+				return db, nil
+			}
+		}
+		return database{}, fmt.Errorf("no database '%s' in %s", id, region)
+	}
+
+	rows := make([]string, len(databases))
+	for i, db := range databases {
+		rows[i] = fmt.Sprintf("%-30s %-8s %-18s %s:%d", db.ID, db.Kind, db.Engine, db.Host, db.Port)
+	}
+	index, err := picker.Choose("Select a database", rows, numbered)
+	if err != nil {
+		return database{}, err
+	}
+	return databases[index], nil
+}
+
+// databaseClientCommand returns a command line that connects the engine's usual client to
+// the tunnel, or "" for engines without a well-known one.
+func databaseClientCommand(db database, port int) string {
+	user := db.Username
+	if user == "" {
+		user = "admin"
+	}
+	p := strconv.Itoa(port)
+	switch engine := db.Engine; {
+	case strings.Contains(engine, "postgres"):
+		name := db.DBName
+		if name == "" {
+			name = "postgres"
+		}
+		return fmt.Sprintf("psql \"host=localhost port=%s dbname=%s user=%s\"", p, name, user)
+	case strings.Contains(engine, "mysql"), strings.Contains(engine, "mariadb"):
+		// 127.0.0.1 rather than localhost, which mysql takes to mean its Unix socket.
+		command := fmt.Sprintf("mysql -h 127.0.0.1 -P %s -u %s -p", p, user)
+		if db.DBName != "" {
+			command += " " + db.DBName
+		}
+		return command
+	case strings.HasPrefix(engine, "sqlserver"):
+		return fmt.Sprintf("sqlcmd -S localhost,%s -U %s", p, user)
+	case strings.HasPrefix(engine, "oracle"):
+		name := db.DBName
+		if name == "" {
+			name = "ORCL"
+		}
+		return fmt.Sprintf("sqlplus %s@//localhost:%s/%s", user, p, name)
+	}
+	return ""
+}
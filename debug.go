@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/smithy-go/logging"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// debugOut receives the --debug log; nil while debugging is off.
+var (
+	debugOut io.Writer
+	debugMu  sync.Mutex
+)
+
+// addDebugFlags registers --debug and --debug-file. They take effect while the flags are
+// parsed, so nothing has to pass them around.
+func addDebugFlags(fs *flag.FlagSet) {
+	fs.BoolFunc("debug", "log AWS API calls, raw responses and external commands to stderr", func(string) error {
+		if debugOut == nil {
+			debugOut = os.Stderr
+		}
+		return nil
+	})
+	fs.Func("debug-file", "write the --debug log to `file` instead of stderr (it may contain session tokens)", func(path string) error {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return err
+		}
+		debugOut = f
+		return nil
+	})
+}
+
+// debugf writes a timestamped line to the debug log, if enabled.
+func debugf(format string, args ...any) {
+	if debugOut == nil {
+		return
+	}
+	debugMu.Lock()
+	defer debugMu.Unlock()
+	fmt.Fprintf(debugOut, "[debug %s] %s\n", time.Now().Format("15:04:05.000"), fmt.Sprintf(format, args...))
+}
+
+// debugCommand logs an external command line, quoted so it can be pasted into a shell.
+func debugCommand(name string, args []string) {
+	if debugOut == nil {
+		return
+	}
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shellQuote(arg)
+	}
+	debugf("exec %s %s", shellQuote(name), strings.Join(quoted, " "))
+}
+
+// debugConfigOptions returns the SDK options that log every API call with its parameters
+// and timing, plus the raw HTTP responses, when --debug is on.
+func debugConfigOptions() []func(*config.LoadOptions) error {
+	if debugOut == nil {
+		return nil
+	}
+	logger := logging.LoggerFunc(func(classification logging.Classification, format string, v ...interface{}) {
+		debugf("sdk %s: %s", strings.ToLower(string(classification)), fmt.Sprintf(format, v...))
+	})
+	return []func(*config.LoadOptions) error{
+		config.WithLogger(logger),
+		config.WithClientLogMode(aws.LogResponseWithBody | aws.LogRetries),
+		config.WithAPIOptions([]func(*middleware.Stack) error{addDebugMiddleware}),
+	}
+}
+
+// addDebugMiddleware logs each operation's input before it is sent, and its duration.
+func addDebugMiddleware(stack *middleware.Stack) error {
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("DebugLog",
+		func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+			operation := awsmiddleware.GetServiceID(ctx) + "." + awsmiddleware.GetOperationName(ctx)
+			params, err := json.Marshal(in.Parameters)
+			if err != nil {
+				params = []byte(fmt.Sprintf("%T", in.Parameters))
+			}
+			debugf("call %s %s", operation, params)
+
+			start := time.Now()
+			out, metadata, err := next.HandleInitialize(ctx, in)
+			elapsed := time.Since(start).Round(time.Millisecond)
+			if err != nil {
+				debugf("call %s failed after %s: %v", operation, elapsed, err)
+			} else {
+				debugf("call %s done in %s", operation, elapsed)
+			}
+			return out, metadata, err
+		}), middleware.After)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/nkarisa/homebrew-aws-ssm-connect/pkg/session"
+)
+
+// Doctor check outcomes.
+const (
+	checkPass = "PASS"
+	checkWarn = "WARN"
+	checkFail = "FAIL"
+)
+
+// doctorActions are the permissions the connect flow needs.
+var doctorActions = []string{"ec2:DescribeInstances", "ssm:DescribeInstanceInformation", "ssm:StartSession"}
+
+// runDoctor implements the doctor command: verify the local tools, credentials, region
+// and permissions needed to start a session, printing a pass/fail line per check.
+func runDoctor(ctx context.Context, args []string) int {
+	var opts options
+	fs := newFlagSet(findCommand("doctor"), &opts)
+
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return flagErrorCode(err)
+	}
+	if len(positional) > 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	if err := opts.applyFileConfig(); err != nil {
+		return reportError(err)
+	}
+
+	failed := false
+	report := func(status, check, detail string) {
+		if status == checkFail {
+			failed = true
+		}
+		fmt.Printf("[%s] %-26s %s\n", status, check, detail)
+	}
+
+	// Local tools
+	if out, err := executor.Output(ctx, session.PluginName, "--version"); err != nil {
+		report(checkWarn, "session-manager-plugin", "not found in PATH; shells use the built-in client, but port forwarding needs the plugin")
+	} else {
+		report(checkPass, "session-manager-plugin", "version "+strings.TrimSpace(string(out)))
+	}
+	if out, err := executor.Output(ctx, "aws", "--version"); err != nil {
+		report(checkWarn, "AWS CLI", "not found in PATH; only needed for 'aws sso login'")
+	} else {
+		report(checkPass, "AWS CLI", strings.TrimSpace(string(out)))
+	}
+	if _, err := executor.LookPath("ssh"); err != nil {
+		report(checkWarn, "OpenSSH client", "not found in PATH; needed for proxy and cp")
+	} else {
+		report(checkPass, "OpenSSH client", "found")
+	}
+
+	// Configuration and credentials
+	if path := findProjectConfig(); path != "" {
+		report(checkPass, "Project config", path)
+	}
+	cfg, err := loadAWSConfig(ctx, opts.Profile, opts.Region)
+	if err != nil {
+		report(checkFail, "AWS configuration", err.Error())
+		return doctorExitCode(true)
+	}
+	profile := opts.Profile
+	if profile == "" {
+		profile = "(default)"
+	}
+	report(checkPass, "AWS configuration", "profile "+profile)
+
+	if cfg.Region == "" {
+		report(checkFail, "Region", "none configured; pass --region, set AWS_REGION, or add 'region = ...' to the profile")
+		return doctorExitCode(true)
+	}
+	report(checkPass, "Region", cfg.Region)
+
+	identity, err := sts.NewFromConfig(cfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		detail := describeAPIError(err).Error()
+		if isSSOTokenError(err) {
+			detail = "SSO session expired; run 'aws sso login'"
+		}
+		report(checkFail, "Credentials", detail)
+		return doctorExitCode(true)
+	}
+	report(checkPass, "Credentials", aws.ToString(identity.Arn))
+
+	// Permissions, as far as IAM policy simulation can tell. Simulation needs
+	// iam:SimulatePrincipalPolicy itself, so a failure here is only a warning.
+	denied, err := simulatePermissions(ctx, iam.NewFromConfig(cfg), aws.ToString(identity.Arn))
+	switch {
+	case err != nil:
+		report(checkWarn, "Permissions", "could not be verified: "+err.Error())
+	case len(denied) > 0:
+		report(checkFail, "Permissions", "denied: "+strings.Join(denied, ", "))
+	default:
+		report(checkPass, "Permissions", strings.Join(doctorActions, ", "))
+	}
+
+	return doctorExitCode(failed)
+}
+
+// doctorExitCode returns exitError if any check failed.
+func doctorExitCode(failed bool) int {
+	if failed {
+		return exitError
+	}
+	return exitOK
+}
+
+// simulatePermissions returns the doctorActions that IAM policy simulation denies for the
+// caller. Assumed-role sessions (including SSO) are simulated against their role.
+func simulatePermissions(ctx context.Context, client *iam.Client, callerARN string) ([]string, error) {
+	principal, err := principalARN(ctx, client, callerARN)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := client.SimulatePrincipalPolicy(ctx, &iam.SimulatePrincipalPolicyInput{
+		PolicySourceArn: aws.String(principal),
+		ActionNames:     doctorActions,
+	})
+	if err != nil {
+		return nil, describeAPIError(err)
+	}
+
+	var denied []string
+	for _, result := range out.EvaluationResults {
+		if result.EvalDecision != "allowed" {
+			denied = append(denied, aws.ToString(result.EvalActionName))
+		}
+	}
+	return denied, nil
+}
+
+// principalARN maps an STS caller ARN to the IAM ARN that policy simulation accepts:
+// arn:aws:sts::123:assumed-role/Name/session becomes the role's ARN, path included.
+func principalARN(ctx context.Context, client *iam.Client, callerARN string) (string, error) {
+	parts := strings.Split(callerARN, ":")
+	if len(parts) < 6 || !strings.HasPrefix(parts[5], "assumed-role/") {
+		return callerARN, nil
+	}
+	roleName := strings.Split(strings.TrimPrefix(parts[5], "assumed-role/"), "/")[0]
+
+	role, err := client.GetRole(ctx, &iam.GetRoleInput{RoleName: aws.String(roleName)})
+	if err != nil {
+		return "", describeAPIError(err)
+	}
+	return aws.ToString(role.Role.Arn), nil
+}
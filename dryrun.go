@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+// addDryRunFlag registers --dry-run for the commands that start sessions or run commands.
+func addDryRunFlag(fs *flag.FlagSet, opts *options) {
+	fs.BoolVar(&opts.DryRun, "dry-run", false, "print the AWS CLI (or ssh/scp) commands that would be run instead of running them")
+}
+
+// printDryRun prints a command line that --dry-run skipped, quoted so it can be pasted
+// into a shell or piped to one. Instance discovery still runs, as it changes nothing.
+func printDryRun(name string, args ...string) {
+	quoted := []string{shellQuote(name)}
+	for _, arg := range args {
+		quoted = append(quoted, shellQuote(arg))
+	}
+	fmt.Println(strings.Join(quoted, " "))
+}
+
+// awsCLIArgs returns the global AWS CLI options selecting the profile and region of cfg.
+func awsCLIArgs(cfg aws.Config, opts *options) []string {
+	var args []string
+	if opts.Profile != "" {
+		args = append(args, "--profile", opts.Profile)
+	}
+	if endpointURL != "" {
+		args = append(args, "--endpoint-url", endpointURL)
+	}
+	return append(args, "--region", cfg.Region)
+}
+
+// printStartSessionDryRun prints the 'aws ssm start-session' equivalent of input.
+func printStartSessionDryRun(cfg aws.Config, opts *options, input *ssm.StartSessionInput) error {
+	opts.applyReason(input)
+	args := []string{"ssm", "start-session", "--target", aws.ToString(input.Target)}
+	if input.DocumentName != nil {
+		args = append(args, "--document-name", aws.ToString(input.DocumentName))
+	}
+	if len(input.Parameters) > 0 {
+		params, err := json.Marshal(input.Parameters)
+		if err != nil {
+			return fmt.Errorf("encoding session parameters: %w", err)
+		}
+		args = append(args, "--parameters", string(params))
+	}
+	if input.Reason != nil {
+		args = append(args, "--reason", aws.ToString(input.Reason))
+	}
+	printDryRun("aws", append(args, awsCLIArgs(cfg, opts)...)...)
+	return nil
+}
+
+// printSendCommandDryRun prints the 'aws ssm send-command' equivalent of running command on
+// targets, one line per region and document.
+func printSendCommandDryRun(cfg aws.Config, opts *options, targets []Instance, command remoteCommand) error {
+	// One call per region and document, as Windows instances get PowerShell.
+	type batch struct{ region, document string }
+	batches := map[batch][]string{}
+	texts := map[string]string{} // the command text of each document
+	for _, target := range targets {
+		targetCommand := command.forTarget(target)
+		b := batch{target.Region, targetCommand.document}
+		batches[b] = append(batches[b], target.InstanceID)
+		texts[b.document] = targetCommand.text
+	}
+	keys := make([]batch, 0, len(batches))
+	for b := range batches {
+		keys = append(keys, b)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].region != keys[j].region {
+			return keys[i].region < keys[j].region
+		}
+		return keys[i].document < keys[j].document
+	})
+
+	for _, b := range keys {
+		params, err := json.Marshal(map[string][]string{"commands": {texts[b.document]}})
+		if err != nil {
+			return fmt.Errorf("encoding command parameters: %w", err)
+		}
+		regionCfg := cfg.Copy()
+		regionCfg.Region = b.region
+		args := []string{"ssm", "send-command",
+			"--document-name", b.document,
+			"--instance-ids"}
+		args = append(args, batches[b]...)
+		args = append(args, "--parameters", string(params), "--comment", command.comment)
+		if command.output.logGroup != "" {
+			args = append(args, "--cloud-watch-output-config", "CloudWatchOutputEnabled=true,CloudWatchLogGroupName="+command.output.logGroup)
+		}
+		if command.output.s3Bucket != "" {
+			args = append(args, "--output-s3-bucket-name", command.output.s3Bucket)
+			if command.output.s3Prefix != "" {
+				args = append(args, "--output-s3-key-prefix", command.output.s3Prefix)
+			}
+		}
+		printDryRun("aws", append(args, awsCLIArgs(regionCfg, opts)...)...)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+)
+
+// endpointURL and useFIPS are the --endpoint-url and --fips values. The SDK also honors
+// AWS_ENDPOINT_URL, AWS_USE_FIPS_ENDPOINT and the profile's endpoint_url and
+// use_fips_endpoint settings; the flags take precedence.
+var (
+	endpointURL string
+	useFIPS     bool
+)
+
+// addEndpointFlags registers --endpoint-url and --fips. Like --debug they take effect while
+// the flags are parsed, since every AWS configuration loaded afterwards needs them.
+func addEndpointFlags(fs *flag.FlagSet) {
+	fs.Func("endpoint-url", "send every AWS API call to this `url`, e.g. http://localhost:4566 for LocalStack", func(value string) error {
+		u, err := url.Parse(value)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("expected a URL such as https://host:port, got '%s'", value)
+		}
+		endpointURL = value
+		return nil
+	})
+	fs.BoolVar(&useFIPS, "fips", false, "use the FIPS 140-validated endpoints of the region")
+}
+
+// endpointConfigOptions returns the SDK options for --endpoint-url and --fips.
+func endpointConfigOptions() []func(*config.LoadOptions) error {
+	var opts []func(*config.LoadOptions) error
+	if endpointURL != "" {
+		opts = append(opts, config.WithBaseEndpoint(endpointURL))
+	}
+	if useFIPS {
+		opts = append(opts, config.WithUseFIPSEndpoint(aws.FIPSEndpointStateEnabled))
+	}
+	return opts
+}
+
+// regionPartition returns the partition region belongs to, as used in ARNs.
+func regionPartition(region string) string {
+	switch {
+	case strings.HasPrefix(region, "cn-"):
+		return "aws-cn"
+	case strings.HasPrefix(region, "us-gov-"):
+		return "aws-us-gov"
+	case strings.HasPrefix(region, "us-isob-"):
+		return "aws-iso-b"
+	case strings.HasPrefix(region, "us-iso-"):
+		return "aws-iso"
+	}
+	return "aws"
+}
+
+// regionDNSSuffix returns the domain of the service endpoints in region.
+func regionDNSSuffix(region string) string {
+	switch regionPartition(region) {
+	case "aws-cn":
+		return "amazonaws.com.cn"
+	case "aws-iso":
+		return "c2s.ic.gov"
+	case "aws-iso-b":
+		return "sc2s.sgov.gov"
+	}
+	return "amazonaws.com"
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// envPrefix starts the name of every environment variable we read.
+const envPrefix = "AWS_SSM_CONNECT_"
+
+// envSetting is a config.yaml key that can also be set from the environment, as
+// AWS_SSM_CONNECT_<NAME>.
+type envSetting struct {
+	name  string
+	usage string
+	apply func(cfg *fileConfig, value string) error
+}
+
+// envSettings lists the environment variables, in the order the help shows them. Lists are
+// comma-separated and parameters are key=value pairs, e.g.
+// AWS_SSM_CONNECT_FILTERS=Team=platform,Env=prod.
+var envSettings = []envSetting{
+	{"ENV", "preset to use", func(cfg *fileConfig, v string) error { cfg.Env = v; return nil }},
+	{"PROFILE", "AWS profile", func(cfg *fileConfig, v string) error { cfg.Profile = v; return nil }},
+	{"REGION", "AWS region", func(cfg *fileConfig, v string) error { cfg.Region = v; return nil }},
+	{"FILTERS", "tag filters, Key=Value", func(cfg *fileConfig, v string) error { cfg.Tags = splitEnvList(v); return nil }},
+	{"STATES", "instance states", func(cfg *fileConfig, v string) error { cfg.States = splitEnvList(v); return nil }},
+	{"SOURCES", "instance sources", func(cfg *fileConfig, v string) error { cfg.Sources = splitEnvList(v); return nil }},
+	{"HYBRID", "list hybrid servers too (true/false)", func(cfg *fileConfig, v string) error { return parseEnvBool(v, &cfg.Hybrid) }},
+	{"ACCOUNTS", "account IDs to search", func(cfg *fileConfig, v string) error { cfg.Accounts = splitEnvList(v); return nil }},
+	{"ACCOUNT_ROLE", "role assumed in each account", func(cfg *fileConfig, v string) error { cfg.AccountRole = v; return nil }},
+	{"DOCUMENT", "session document", func(cfg *fileConfig, v string) error { cfg.Document = v; return nil }},
+	{"PARAMETERS", "session document parameters, key=value", func(cfg *fileConfig, v string) error {
+		cfg.Parameters = map[string]string{}
+		for _, pair := range splitEnvList(v) {
+			key, value, ok := strings.Cut(pair, "=")
+			if !ok {
+				return fmt.Errorf("expected key=value, got '%s'", pair)
+			}
+			cfg.Parameters[key] = value
+		}
+		return nil
+	}},
+	{"LOG_SESSION", "write session transcripts (true/false)", func(cfg *fileConfig, v string) error { return parseEnvBool(v, &cfg.LogSession) }},
+	{"RECONNECT", "reconnect attempts", func(cfg *fileConfig, v string) error { return parseEnvInt(v, &cfg.Reconnect) }},
+	{"SORT", "sort key", func(cfg *fileConfig, v string) error { cfg.Sort = v; return nil }},
+	{"GROUP_BY", "tag key to group by", func(cfg *fileConfig, v string) error { cfg.GroupBy = v; return nil }},
+	{"COLUMNS", "table columns", func(cfg *fileConfig, v string) error { cfg.Columns = splitEnvList(v); return nil }},
+	{"CACHE_TTL", "instance list cache duration", func(cfg *fileConfig, v string) error { return parseEnvDuration(v, &cfg.CacheTTL) }},
+	{"FETCH_CONCURRENCY", "regions or accounts searched at once", func(cfg *fileConfig, v string) error { return parseEnvInt(v, &cfg.FetchConcurrency) }},
+	{"FETCH_TIMEOUT", "time limit per region or account", func(cfg *fileConfig, v string) error { return parseEnvDuration(v, &cfg.FetchTimeout) }},
+	{"NO_COLOR", "disable color (true/false)", func(cfg *fileConfig, v string) error { return parseEnvBool(v, &cfg.NoColor) }},
+	{"PLAIN", "plain output (true/false)", func(cfg *fileConfig, v string) error { return parseEnvBool(v, &cfg.Plain) }},
+}
+
+// applyEnvConfig overrides cfg, read from the config files, with the AWS_SSM_CONNECT_*
+// variables that are set, so the precedence is flags, then environment, then file.
+// An empty variable counts as unset.
+func applyEnvConfig(cfg *fileConfig) error {
+	for _, setting := range envSettings {
+		value := strings.TrimSpace(os.Getenv(envPrefix + setting.name))
+		if value == "" {
+			continue
+		}
+		if err := setting.apply(cfg, value); err != nil {
+			return fmt.Errorf("invalid %s%s: %w", envPrefix, setting.name, err)
+		}
+	}
+	return nil
+}
+
+// printEnvUsage lists the environment variables for the top-level help.
+func printEnvUsage(w io.Writer) {
+	fmt.Fprintln(w, "Environment (flags take precedence, then these, then .aws-ssm-connect.yaml, then config.yaml):")
+	for _, setting := range envSettings {
+		fmt.Fprintf(w, "  %-34s %s\n", envPrefix+setting.name, setting.usage)
+	}
+}
+
+func splitEnvList(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func parseEnvBool(v string, dst *bool) error {
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return fmt.Errorf("expected true or false, got '%s'", v)
+	}
+	*dst = b
+	return nil
+}
+
+func parseEnvInt(v string, dst *int) error {
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return fmt.Errorf("expected a number, got '%s'", v)
+	}
+	*dst = n
+	return nil
+}
+
+func parseEnvDuration(v string, dst **time.Duration) error {
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return fmt.Errorf("expected a duration such as 10m, got '%s'", v)
+	}
+	*dst = &d
+	return nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/aws/smithy-go"
+)
+
+// errorKind is a class of failure with its own exit code, so that wrapper scripts and
+// monitoring can branch on the reason instead of matching stderr.
+type errorKind struct {
+	name        string // printed as "Error (name): ..."
+	code        int
+	description string // for the exit code list in the help
+}
+
+var (
+	kindCredentials   = &errorKind{"credentials", exitCredentials, "AWS credentials are missing, expired or rejected"}
+	kindMissingTool   = &errorKind{"missing-tool", exitMissingTool, "session-manager-plugin or another required program is not installed"}
+	kindNoInstances   = &errorKind{"no-instances", exitNoInstances, "no instances match the filters"}
+	kindPermission    = &errorKind{"permission-denied", exitPermission, "IAM denied an API call"}
+	kindTargetOffline = &errorKind{"target-offline", exitTargetOffline, "the instance is stopped or its SSM agent is not connected"}
+)
+
+// errorKinds lists the kinds in exit code order.
+var errorKinds = []*errorKind{kindCredentials, kindMissingTool, kindNoInstances, kindPermission, kindTargetOffline}
+
+// kindError marks err as a failure of kind.
+type kindError struct {
+	kind *errorKind
+	err  error
+}
+
+func (e *kindError) Error() string { return e.err.Error() }
+func (e *kindError) Unwrap() error { return e.err }
+
+// withKind classifies err explicitly, for failures errorKindOf can't recognize by itself.
+func withKind(kind *errorKind, err error) error {
+	return &kindError{kind: kind, err: err}
+}
+
+// errorKindOf classifies err, or returns nil for failures of no particular kind. Errors
+// marked withKind keep their kind; AWS API errors are classified by their error code.
+func errorKindOf(err error) *errorKind {
+	var ke *kindError
+	if errors.As(err, &ke) {
+		return ke.kind
+	}
+	if errors.Is(err, errNoInstances) {
+		return kindNoInstances
+	}
+	if isSSOTokenError(err) {
+		return kindCredentials
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "ExpiredToken", "ExpiredTokenException", "InvalidClientTokenId", "UnrecognizedClientException",
+			"SignatureDoesNotMatch", "AuthFailure", "MissingAuthenticationToken":
+			return kindCredentials
+		case "AccessDenied", "AccessDeniedException", "UnauthorizedOperation", "UnauthorizedAccess", "AuthorizationError":
+			return kindPermission
+		case "TargetNotConnected", "InvalidInstanceId", "IncorrectInstanceState":
+			return kindTargetOffline
+		}
+		return nil
+	}
+
+	// The SDK reports failures to obtain credentials as plain wrapped errors.
+	msg := err.Error()
+	if strings.Contains(msg, "get identity: ") || strings.Contains(msg, "failed to refresh cached credentials") {
+		return kindCredentials
+	}
+	return nil
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// runShellScriptDocument is the SSM Run Command document used by exec.
+const runShellScriptDocument = "AWS-RunShellScript"
+
+// commandPollInterval is how often exec polls for the command result.
+const commandPollInterval = 2 * time.Second
+
+// execCommandComment labels the commands exec sends, in the Run Command history.
+const execCommandComment = "aws-ssm-connect exec"
+
+// defaultExecConcurrency caps how many instances exec runs a command on at once.
+const defaultExecConcurrency = 10
+
+// runExec implements the exec command: run a command on one instance through SSM Run
+// Command, print its output and exit with the remote exit code. With --all or --multi the
+// command fans out to several instances concurrently, like a lightweight pssh. Piped into,
+// it reads the instances from stdin instead (cat hosts.txt | aws-ssm-connect exec -- uptime).
+func runExec(ctx context.Context, args []string) int {
+	var opts options
+	var timeout time.Duration
+	var concurrency int
+	var output commandOutput
+	fs := newFlagSet(findCommand("exec"), &opts)
+	addDiscoveryFlags(fs, &opts)
+	addPickerFlags(fs, &opts)
+	fs.BoolVar(&opts.All, "all", false, "run on every matching instance without prompting")
+	fs.BoolVar(&opts.Multi, "multi", false, "pick several instances from the numbered menu (e.g. 1,3,5-9)")
+	fs.IntVar(&concurrency, "concurrency", defaultExecConcurrency, "run on at most `n` instances at once")
+	fs.DurationVar(&timeout, "timeout", 10*time.Minute, "give up waiting for the command after this `duration`")
+	addCommandOutputFlags(fs, &output)
+	addDryRunFlag(fs, &opts)
+
+	// Everything after "--" is the remote command, so it may contain its own flags.
+	var remote []string
+	for i, arg := range args {
+		if arg == "--" {
+			args, remote = args[:i], args[i+1:]
+			break
+		}
+	}
+
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return flagErrorCode(err)
+	}
+	if len(positional) > 0 && instanceIDPattern.MatchString(positional[0]) {
+		opts.Target, positional = positional[0], positional[1:]
+	}
+	remote = append(positional, remote...)
+	if len(remote) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: no command given.")
+		fs.Usage()
+		return exitUsage
+	}
+	command := remoteCommand{document: runShellScriptDocument, words: remote, comment: execCommandComment, output: output}
+	opts.batchStdin = true
+
+	cfg, targets, err := resolveTargets(ctx, &opts)
+	if err != nil {
+		return targetErrorCode(err, &opts)
+	}
+	// The guard policy may have asked for the reason.
+	command.comment = opts.commentWithReason(command.comment)
+	if opts.DryRun {
+		if err := printSendCommandDryRun(cfg, &opts, targets, command); err != nil {
+			return reportError(err)
+		}
+		return exitOK
+	}
+	if len(targets) > 1 {
+		return fanOutCommand(ctx, cfg, &opts, targets, command, timeout, concurrency)
+	}
+
+	cfg = targetConfig(ctx, cfg, &opts, targets[0])
+	if err := ensureRunning(ctx, cfg, &opts, targets[0]); err != nil {
+		return targetErrorCode(err, &opts)
+	}
+	instanceID := targets[0].InstanceID
+	result, err := runRemoteCommand(ctx, cfg, instanceID, command.forTarget(targets[0]), timeout, os.Stdout, os.Stderr)
+	if err != nil {
+		return reportError(err)
+	}
+
+	if !result.Streamed {
+		fmt.Print(result.Stdout)
+		fmt.Fprint(os.Stderr, result.Stderr)
+	}
+	if result.Status != string(ssmtypes.CommandInvocationStatusSuccess) {
+		fmt.Fprintf(os.Stderr, "Command %s on %s (exit code %d).\n", strings.ToLower(result.Status), instanceID, result.ExitCode)
+	}
+	if result.ExitCode < 0 {
+		return exitError
+	}
+	return result.ExitCode
+}
+
+// remoteCommandText returns the script that runs the remote command given as arguments,
+// in PowerShell or else the shell. A single argument is taken as is, so it may be a whole
+// script ('cd /app && make test'); several are quoted word by word, so each reaches the
+// command as it was typed.
+func remoteCommandText(remote []string, powerShell bool) string {
+	if len(remote) == 1 {
+		return remote[0]
+	}
+	quoted := make([]string, len(remote))
+	for i, arg := range remote {
+		if powerShell {
+			quoted[i] = powerShellWord(arg)
+		} else {
+			quoted[i] = shellQuote(arg)
+		}
+	}
+	text := strings.Join(quoted, " ")
+	if powerShell && quoted[0] != remote[0] {
+		// A quoted command name is a string to PowerShell unless it is invoked.
+		text = "& " + text
+	}
+	return text
+}
+
+// powerShellWord quotes s as a PowerShell literal string unless it is a plain word, which
+// is left bare so that parameter names such as -Name keep their meaning.
+func powerShellWord(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r == '/' || r == '\\' || r == '-' || r == '_' || r == '.' || r == ':' || r == '=' ||
+			('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9'))
+	}) < 0 {
+		return s
+	}
+	return powerShellQuote(s)
+}
+
+// fanOutCommand runs command on every target with at most concurrency invocations in
+// flight, printing each host's output prefixed with its name as soon as it completes,
+// followed by a success/failure summary. It returns exitError if any host failed.
+func fanOutCommand(ctx context.Context, cfg aws.Config, opts *options, targets []Instance, command remoteCommand, timeout time.Duration, concurrency int) int {
+	fmt.Fprintf(os.Stderr, "Running on %d instances...\n", len(targets))
+
+	results := make([]commandResult, len(targets))
+	errs := make([]error, len(targets))
+	var mu sync.Mutex
+	forEachTarget(targets, concurrency, func(i int, target Instance) {
+		prefix := "[" + hostLabel(target) + "] "
+		stdout, stderr := streamWriters(command, prefix, &mu)
+		results[i], errs[i] = runRemoteCommand(ctx, targetConfig(ctx, cfg, opts, target), target.InstanceID, command.forTarget(target), timeout, stdout, stderr)
+
+		// Print whole hosts at a time so lines from different hosts don't interleave.
+		mu.Lock()
+		defer mu.Unlock()
+		if errs[i] != nil {
+			fmt.Fprintf(os.Stderr, "%s%v\n", prefix, errs[i])
+			return
+		}
+		if !results[i].Streamed {
+			printPrefixed(os.Stdout, prefix, results[i].Stdout)
+			printPrefixed(os.Stderr, prefix, results[i].Stderr)
+		}
+	})
+
+	var failed []string
+	for i, target := range targets {
+		switch {
+		case errs[i] != nil:
+			failed = append(failed, fmt.Sprintf("%s (%v)", hostLabel(target), errs[i]))
+		case results[i].Status != string(ssmtypes.CommandInvocationStatusSuccess):
+			failed = append(failed, fmt.Sprintf("%s (%s, exit code %d)", hostLabel(target), strings.ToLower(results[i].Status), results[i].ExitCode))
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "\nSummary: %d succeeded, %d failed.\n", len(targets)-len(failed), len(failed))
+	for _, f := range failed {
+		fmt.Fprintf(os.Stderr, "  FAILED %s\n", f)
+	}
+	if len(failed) > 0 {
+		return exitError
+	}
+	return exitOK
+}
+
+// forEachTarget calls fn for every target, with at most concurrency calls running at once,
+// and returns when all of them have.
+func forEachTarget(targets []Instance, concurrency int, fn func(i int, target Instance)) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, concurrency)
+	for i, target := range targets {
+		wg.Add(1)
+		go func(i int, target Instance) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			fn(i, target)
+		}(i, target)
+	}
+	wg.Wait()
+}
+
+// streamWriters returns the writers that print one host's streamed output with prefix,
+// or nils if command doesn't log to CloudWatch.
+func streamWriters(command remoteCommand, prefix string, mu *sync.Mutex) (io.Writer, io.Writer) {
+	if command.output.logGroup == "" {
+		return nil, nil
+	}
+	return &prefixWriter{w: os.Stdout, prefix: prefix, mu: mu}, &prefixWriter{w: os.Stderr, prefix: prefix, mu: mu}
+}
+
+// hostLabel names an instance in prefixed output: its Name tag if it has one, else its ID.
+func hostLabel(inst Instance) string {
+	if inst.Name != "" {
+		return inst.Name
+	}
+	return inst.InstanceID
+}
+
+// printPrefixed writes every line of text to w, prefixed.
+func printPrefixed(w io.Writer, prefix, text string) {
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		if line != "" {
+			fmt.Fprintf(w, "%s%s\n", prefix, line)
+		}
+	}
+}
+
+// commandResult is the outcome of a command run through SSM Run Command.
+type commandResult struct {
+	Status   string
+	ExitCode int
+	Stdout   string
+	Stderr   string
+	Streamed bool // the output has already been printed while the command ran
+}
+
+// remoteCommand is a shell command or script for SSM Run Command.
+type remoteCommand struct {
+	document string // AWS-RunShellScript or AWS-RunPowerShellScript
+	text     string
+	words    []string // the command as arguments, quoted into text by forTarget
+	comment  string   // shown in the Run Command history
+	output   commandOutput
+}
+
+// forTarget returns the command to send to target: exec's shell commands run with
+// PowerShell on Windows instances, with their words quoted for it.
+func (c remoteCommand) forTarget(target Instance) remoteCommand {
+	if c.document == runShellScriptDocument && target.IsWindows() {
+		c.document = runPowerShellScriptDocument
+	}
+	if len(c.words) > 0 {
+		c.text = remoteCommandText(c.words, c.document == runPowerShellScriptDocument)
+	}
+	return c
+}
+
+// runRemoteCommand sends a command to one instance and waits for it to finish.
+// Note that GetCommandInvocation truncates each output stream to 24,000 characters; with an
+// S3 output location the complete output is read from there instead.
+//
+// If the command logs to CloudWatch and stdout is not nil, its output is streamed to stdout
+// and stderr while it runs, and the result is marked Streamed.
+func runRemoteCommand(ctx context.Context, cfg aws.Config, instanceID string, command remoteCommand, timeout time.Duration, stdout, stderr io.Writer) (commandResult, error) {
+	client := ssm.NewFromConfig(cfg)
+	input := &ssm.SendCommandInput{
+		DocumentName: aws.String(command.document),
+		InstanceIds:  []string{instanceID},
+		Parameters:   map[string][]string{"commands": {command.text}},
+		Comment:      aws.String(command.comment),
+	}
+	command.output.apply(input)
+	sent, err := client.SendCommand(ctx, input)
+	if err != nil {
+		return commandResult{}, withHints(fmt.Errorf("sending command: %w", describeAPIError(err)),
+			"The instance is not running or the SSM Agent is not online.",
+			"You are not allowed to call ssm:SendCommand on the instance.")
+	}
+	commandID := aws.ToString(sent.Command.CommandId)
+
+	streamed := command.output.logGroup != "" && stdout != nil
+	stop, stopped := make(chan struct{}), make(chan struct{})
+	if streamed {
+		go func() {
+			defer close(stopped)
+			streamCommandLogs(ctx, cfg, command.output.logGroup, commandID, instanceID, stdout, stderr, stop)
+		}()
+	}
+	result, err := waitForCommand(ctx, client, commandID, instanceID, timeout)
+	if streamed {
+		close(stop)
+		<-stopped
+		result.Streamed = true
+	}
+	if err != nil || command.output.s3Bucket == "" {
+		return result, err
+	}
+
+	full, fullErr, err := readS3Output(ctx, cfg, command.output, commandID, instanceID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v; output may be truncated.\n", err)
+		return result, nil
+	}
+	result.Stdout, result.Stderr = full, fullErr
+	return result, nil
+}
+
+// waitForCommand polls GetCommandInvocation until the command reaches a terminal status.
+func waitForCommand(ctx context.Context, client *ssm.Client, commandID, instanceID string, timeout time.Duration) (commandResult, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		out, err := client.GetCommandInvocation(ctx, &ssm.GetCommandInvocationInput{
+			CommandId:  aws.String(commandID),
+			InstanceId: aws.String(instanceID),
+		})
+		var notYet *ssmtypes.InvocationDoesNotExist
+		switch {
+		case errors.As(err, &notYet):
+			// The invocation is registered asynchronously right after SendCommand.
+		case err != nil:
+			return commandResult{}, fmt.Errorf("waiting for command %s: %w", commandID, describeAPIError(err))
+		default:
+			switch out.Status {
+			case ssmtypes.CommandInvocationStatusPending, ssmtypes.CommandInvocationStatusInProgress, ssmtypes.CommandInvocationStatusDelayed:
+				// Still running
+			default:
+				return commandResult{
+					Status:   string(out.Status),
+					ExitCode: int(out.ResponseCode),
+					Stdout:   aws.ToString(out.StandardOutputContent),
+					Stderr:   aws.ToString(out.StandardErrorContent),
+				}, nil
+			}
+		}
+
+		if time.Now().After(deadline) {
+			return commandResult{}, fmt.Errorf("timed out after %s waiting for command %s", timeout, commandID)
+		}
+		select {
+		case <-ctx.Done():
+			return commandResult{}, ctx.Err()
+		case <-time.After(commandPollInterval):
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import "testing"
+
+func TestRemoteCommandText(t *testing.T) {
+	tests := []struct {
+		remote []string
+		want   string
+	}{
+		{[]string{"uptime"}, "uptime"},
+		{[]string{"cd /app && make test"}, "cd /app && make test"},
+		{[]string{"ls", "-l", "/var/log"}, "ls -l /var/log"},
+		{[]string{"grep", "-r", "two words", "/etc"}, "grep -r 'two words' /etc"},
+		{[]string{"echo", "$HOME", "it's"}, `echo '$HOME' 'it'\''s'`},
+		{[]string{"printf", ""}, "printf ''"},
+	}
+	for _, tt := range tests {
+		if got := remoteCommandText(tt.remote, false); got != tt.want {
+			t.Errorf("remoteCommandText(%q) = %s, want %s", tt.remote, got, tt.want)
+		}
+	}
+}
+
+func TestRemoteCommandTextPowerShell(t *testing.T) {
+	tests := []struct {
+		remote []string
+		want   string
+	}{
+		{[]string{"Get-Service | Where Status -eq Running"}, "Get-Service | Where Status -eq Running"},
+		{[]string{"Get-Service", "-Name", "wuauserv"}, "Get-Service -Name wuauserv"},
+		{[]string{"Get-ChildItem", `C:\Program Files`}, `Get-ChildItem 'C:\Program Files'`},
+		{[]string{"Write-Output", "$env:COMPUTERNAME", "it's"}, `Write-Output '$env:COMPUTERNAME' 'it''s'`},
+		{[]string{`C:\Tools\my tool.exe`, "/quiet"}, `& 'C:\Tools\my tool.exe' /quiet`},
+	}
+	for _, tt := range tests {
+		if got := remoteCommandText(tt.remote, true); got != tt.want {
+			t.Errorf("remoteCommandText(%q) = %s, want %s", tt.remote, got, tt.want)
+		}
+	}
+}
+
+func TestRemoteCommandForTarget(t *testing.T) {
+	command := remoteCommand{document: runShellScriptDocument, words: []string{"echo", "it's"}}
+	linux := command.forTarget(Instance{InstanceID: "i-0aaa", Platform: "Linux/UNIX"})
+	if linux.document != runShellScriptDocument || linux.text != `echo 'it'\''s'` {
+		t.Errorf("Linux command = %s %s", linux.document, linux.text)
+	}
+	windows := command.forTarget(Instance{InstanceID: "i-0bbb", Platform: "Windows"})
+	if windows.document != runPowerShellScriptDocument || windows.text != `echo 'it''s'` {
+		t.Errorf("Windows command = %s %s", windows.document, windows.text)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/nkarisa/homebrew-aws-ssm-connect/pkg/inventory"
+)
+
+// commandExecutor runs the local programs we hand off to: ssh, scp, the AWS CLI, tmux, RDP
+// clients, session-manager-plugin and background copies of this binary. Code goes through
+// executor rather than os/exec so tests can record the calls and answer with canned output
+// instead of needing the tools installed.
+type commandExecutor interface {
+	// LookPath finds name in PATH, like exec.LookPath.
+	LookPath(name string) (string, error)
+	// Output runs name and returns its standard output.
+	Output(ctx context.Context, name string, args ...string) ([]byte, error)
+	// Run runs the program at path with the given I/O and waits for it. A non-zero exit
+	// status is returned as an error with an ExitCode() int method, as *exec.ExitError has.
+	Run(ctx context.Context, path string, args []string, stdin io.Reader, stdout, stderr io.Writer) error
+	// Start starts the program at path with the given I/O and returns without waiting for
+	// it. A detached program keeps running when this process and its terminal are gone.
+	Start(path string, args []string, stdin io.Reader, stdout, stderr io.Writer, detached bool) (process, error)
+}
+
+// process is a program started by commandExecutor.Start.
+type process interface {
+	Pid() int
+	Signal(sig os.Signal) error
+	// Wait waits for the program to exit; its exit status is reported as by Run.
+	Wait() error
+	// Release gives up the process, which is then left running.
+	Release() error
+}
+
+// osExecutor is the commandExecutor that runs real programs.
+type osExecutor struct{}
+
+func (osExecutor) LookPath(name string) (string, error) { return exec.LookPath(name) }
+
+func (osExecutor) Output(ctx context.Context, name string, args ...string) ([]byte, error) {
+	return exec.CommandContext(ctx, name, args...).Output()
+}
+
+func (osExecutor) Run(ctx context.Context, path string, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = stdin, stdout, stderr
+	return cmd.Run()
+}
+
+func (osExecutor) Start(path string, args []string, stdin io.Reader, stdout, stderr io.Writer, detached bool) (process, error) {
+	cmd := exec.Command(path, args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = stdin, stdout, stderr
+	if detached {
+		detach(cmd)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return osProcess{cmd}, nil
+}
+
+// osProcess is the process of a real program.
+type osProcess struct{ cmd *exec.Cmd }
+
+func (p osProcess) Pid() int                   { return p.cmd.Process.Pid }
+func (p osProcess) Signal(sig os.Signal) error { return p.cmd.Process.Signal(sig) }
+func (p osProcess) Wait() error                { return p.cmd.Wait() }
+func (p osProcess) Release() error             { return p.cmd.Process.Release() }
+
+var executor commandExecutor = osExecutor{}
+
+// exitCode returns the exit status carried by an error from commandExecutor.Run.
+func exitCode(err error) (int, bool) {
+	if exitErr, ok := err.(interface{ ExitCode() int }); ok {
+		return exitErr.ExitCode(), true
+	}
+	return 0, false
+}
+
+// sessionAPI is the part of the SSM API that opens and closes sessions. *ssm.Client
+// implements it.
+type sessionAPI interface {
+	StartSession(ctx context.Context, params *ssm.StartSessionInput, optFns ...func(*ssm.Options)) (*ssm.StartSessionOutput, error)
+	TerminateSession(ctx context.Context, params *ssm.TerminateSessionInput, optFns ...func(*ssm.Options)) (*ssm.TerminateSessionOutput, error)
+}
+
+// newSessionClient creates the client sessions are opened with; tests replace it.
+var newSessionClient = func(cfg aws.Config) sessionAPI { return ssm.NewFromConfig(cfg) }
+
+// inventoryClients creates the clients targets are listed with. The zero value talks to
+// AWS; tests set it to fakes that replay recorded responses.
+var inventoryClients inventory.Clients
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/nkarisa/homebrew-aws-ssm-connect/pkg/inventory"
+)
+
+// fakeResponse is the recorded outcome of running a program.
+type fakeResponse struct {
+	output   string // written to stdout
+	code     int    // exit status
+	startErr error  // returned instead of running it
+}
+
+// fakeExecutor is a commandExecutor that records the commands it is asked to run and
+// answers with the recorded response of the program, by base name.
+type fakeExecutor struct {
+	responses map[string]fakeResponse
+	missing   []string   // programs LookPath doesn't find
+	calls     [][]string // program base name followed by the arguments
+}
+
+func (f *fakeExecutor) LookPath(name string) (string, error) {
+	if slices.Contains(f.missing, name) {
+		return "", &os.PathError{Op: "lookpath", Path: name, Err: os.ErrNotExist}
+	}
+	return "/usr/bin/" + name, nil
+}
+
+func (f *fakeExecutor) Output(ctx context.Context, name string, args ...string) ([]byte, error) {
+	var out strings.Builder
+	err := f.Run(ctx, name, args, nil, &out, io.Discard)
+	return []byte(out.String()), err
+}
+
+func (f *fakeExecutor) Run(ctx context.Context, path string, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	p, err := f.Start(path, args, stdin, stdout, stderr, false)
+	if err != nil {
+		return err
+	}
+	return p.Wait()
+}
+
+func (f *fakeExecutor) Start(path string, args []string, stdin io.Reader, stdout, stderr io.Writer, detached bool) (process, error) {
+	name := filepath.Base(path)
+	f.calls = append(f.calls, append([]string{name}, args...))
+	response := f.responses[name]
+	if response.startErr != nil {
+		return nil, response.startErr
+	}
+	return &fakeProcess{response: response, stdout: stdout}, nil
+}
+
+// fakeProcess replays a fakeResponse when waited for.
+type fakeProcess struct {
+	response fakeResponse
+	stdout   io.Writer
+	signals  []os.Signal
+}
+
+func (p *fakeProcess) Pid() int                   { return 4242 }
+func (p *fakeProcess) Signal(sig os.Signal) error { p.signals = append(p.signals, sig); return nil }
+func (p *fakeProcess) Release() error             { return nil }
+
+func (p *fakeProcess) Wait() error {
+	if p.stdout != nil {
+		io.WriteString(p.stdout, p.response.output)
+	}
+	if p.response.code != 0 {
+		return fakeExitError(p.response.code)
+	}
+	return nil
+}
+
+// fakeExitError is a non-zero exit status, as *exec.ExitError reports it.
+type fakeExitError int
+
+func (e fakeExitError) Error() string { return fmt.Sprintf("exit status %d", int(e)) }
+func (e fakeExitError) ExitCode() int { return int(e) }
+
+// useExecutor makes fake the executor for the rest of the test.
+func useExecutor(t *testing.T, fake commandExecutor) {
+	t.Helper()
+	saved := executor
+	executor = fake
+	t.Cleanup(func() { executor = saved })
+}
+
+// loadFixture decodes the recorded API response in testdata/name into v.
+func loadFixture(t *testing.T, name string, v any) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatalf("decoding %s: %v", name, err)
+	}
+}
+
+// fakeEC2 replays a recorded DescribeInstances response and records the requests. Regions
+// listed concurrently share it.
+type fakeEC2 struct {
+	output  *ec2.DescribeInstancesOutput
+	regions []string
+	mu      sync.Mutex
+	inputs  []*ec2.DescribeInstancesInput
+}
+
+func (f *fakeEC2) DescribeInstances(ctx context.Context, params *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.inputs = append(f.inputs, params)
+	return f.output, nil
+}
+
+func (f *fakeEC2) DescribeRegions(ctx context.Context, params *ec2.DescribeRegionsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeRegionsOutput, error) {
+	output := &ec2.DescribeRegionsOutput{}
+	for _, region := range f.regions {
+		output.Regions = append(output.Regions, ec2types.Region{RegionName: aws.String(region)})
+	}
+	return output, nil
+}
+
+// fakeSSM replays a recorded DescribeInstanceInformation response, keeping the entries of
+// the requested resource type as SSM would, or fails with err.
+type fakeSSM struct {
+	output *ssm.DescribeInstanceInformationOutput
+	err    error
+}
+
+func (f *fakeSSM) DescribeInstanceInformation(ctx context.Context, params *ssm.DescribeInstanceInformationInput, optFns ...func(*ssm.Options)) (*ssm.DescribeInstanceInformationOutput, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	output := &ssm.DescribeInstanceInformationOutput{}
+	for _, info := range f.output.InstanceInformationList {
+		keep := true
+		for _, filter := range params.Filters {
+			if aws.ToString(filter.Key) == "ResourceType" {
+				keep = slices.Contains(filter.Values, string(info.ResourceType))
+			}
+		}
+		if keep {
+			output.InstanceInformationList = append(output.InstanceInformationList, info)
+		}
+	}
+	return output, nil
+}
+
+// useInventory makes the inventory list through the fakes for the rest of the test.
+func useInventory(t *testing.T, ec2Client *fakeEC2, ssmClient *fakeSSM) {
+	t.Helper()
+	saved := inventoryClients
+	inventoryClients = inventory.Clients{
+		EC2: func(aws.Config) inventory.EC2API { return ec2Client },
+		SSM: func(aws.Config) inventory.SSMAPI { return ssmClient },
+	}
+	t.Cleanup(func() { inventoryClients = saved })
+}
+
+// fakeSessionClient answers StartSession with a recorded response, or fails with err, and
+// records the sessions it is asked to terminate.
+type fakeSessionClient struct {
+	output     *ssm.StartSessionOutput
+	err        error
+	started    []*ssm.StartSessionInput
+	terminated []string
+}
+
+func (f *fakeSessionClient) StartSession(ctx context.Context, params *ssm.StartSessionInput, optFns ...func(*ssm.Options)) (*ssm.StartSessionOutput, error) {
+	f.started = append(f.started, params)
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.output, nil
+}
+
+func (f *fakeSessionClient) TerminateSession(ctx context.Context, params *ssm.TerminateSessionInput, optFns ...func(*ssm.Options)) (*ssm.TerminateSessionOutput, error) {
+	f.terminated = append(f.terminated, aws.ToString(params.SessionId))
+	return &ssm.TerminateSessionOutput{SessionId: params.SessionId}, nil
+}
+
+// useSessionClient makes sessions open through fake for the rest of the test.
+func useSessionClient(t *testing.T, fake sessionAPI) {
+	t.Helper()
+	saved := newSessionClient
+	newSessionClient = func(aws.Config) sessionAPI { return fake }
+	t.Cleanup(func() { newSessionClient = saved })
+}
+
+func TestRunExternal(t *testing.T) {
+	tests := []struct {
+		name     string
+		executor *fakeExecutor
+		want     int
+	}{
+		{"success", &fakeExecutor{}, exitOK},
+		{"exit status passed through", &fakeExecutor{responses: map[string]fakeResponse{"ssh": {code: 255}}}, 255},
+		{"start failure", &fakeExecutor{responses: map[string]fakeResponse{"ssh": {startErr: errors.New("permission denied")}}}, exitError},
+		{"not installed", &fakeExecutor{missing: []string{"ssh"}}, exitMissingTool},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useExecutor(t, tt.executor)
+			args := []string{"-o", "ProxyCommand=x", "ec2-user@i-0aaa1111aaaa1111a"}
+			if got := runExternal(context.Background(), "ssh", args); got != tt.want {
+				t.Errorf("runExternal = %d, want %d", got, tt.want)
+			}
+			if slices.Contains(tt.executor.missing, "ssh") {
+				if len(tt.executor.calls) != 0 {
+					t.Errorf("ran %v although ssh is missing", tt.executor.calls)
+				}
+				return
+			}
+			if want := append([]string{"ssh"}, args...); len(tt.executor.calls) != 1 || !slices.Equal(tt.executor.calls[0], want) {
+				t.Errorf("calls = %q, want [%q]", tt.executor.calls, want)
+			}
+		})
+	}
+}
+
+func TestRunTmux(t *testing.T) {
+	tests := []struct {
+		name     string
+		response fakeResponse
+		want     string
+		wantErr  string
+	}{
+		{"output trimmed", fakeResponse{output: "@3\n"}, "@3", ""},
+		{"failure carries the output", fakeResponse{output: "no server running\n", code: 1}, "", "tmux new-window: exit status 1: no server running"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeExecutor{responses: map[string]fakeResponse{"tmux": tt.response}}
+			useExecutor(t, fake)
+			got, err := runTmux(&options{}, "new-window", "-P")
+			if got != tt.want {
+				t.Errorf("runTmux = %q, want %q", got, tt.want)
+			}
+			if (err == nil) != (tt.wantErr == "") || (err != nil && err.Error() != tt.wantErr) {
+				t.Errorf("runTmux error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
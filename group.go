@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nkarisa/homebrew-aws-ssm-connect/pkg/inventory"
+	"github.com/nkarisa/homebrew-aws-ssm-connect/pkg/picker"
+)
+
+// stackTagKey is the tag CloudFormation puts on the instances it creates, naming the stack.
+const stackTagKey = "aws:cloudformation:stack-name"
+
+// ungroupedName heads the instances that don't carry the --group-by tag.
+const ungroupedName = "(none)"
+
+// groupTagKey returns the tag key named by --group-by, where "stack" is short for the
+// CloudFormation stack tag.
+func groupTagKey(groupBy string) string {
+	if groupBy == "stack" {
+		return stackTagKey
+	}
+	return groupBy
+}
+
+// instanceGroup is the instances sharing one value of the --group-by tag.
+type instanceGroup struct {
+	name      string
+	instances []Instance
+}
+
+// groupInstances clusters instances by the value of the tag key, keeping the listing order
+// within each group. Groups are sorted by name, with the untagged instances last.
+func groupInstances(instances []Instance, key string) []instanceGroup {
+	var groups []instanceGroup
+	index := map[string]int{}
+	for _, inst := range instances {
+		name := inst.Tags[key]
+		if name == "" {
+			name = ungroupedName
+		}
+		i, ok := index[name]
+		if !ok {
+			i = len(groups)
+			index[name] = i
+			groups = append(groups, instanceGroup{name: name})
+		}
+		groups[i].instances = append(groups[i].instances, inst)
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		if (groups[i].name == ungroupedName) != (groups[j].name == ungroupedName) {
+			return groups[j].name == ungroupedName
+		}
+		return strings.ToLower(groups[i].name) < strings.ToLower(groups[j].name)
+	})
+	return groups
+}
+
+// pickGroup shows the groups collapsed to one line each and returns the instances of the
+// one the user expands. A listing with a single group is returned as is.
+func pickGroup(instances []Instance, opts *options) ([]Instance, error) {
+	groups := groupInstances(instances, groupTagKey(opts.GroupBy))
+	if len(groups) == 1 {
+		return instances, nil
+	}
+
+	rows := make([]string, len(groups))
+	for i, group := range groups {
+		online := 0
+		for _, inst := range group.instances {
+			if inst.SSMStatus == inventory.StatusOnline {
+				online++
+			}
+		}
+		rows[i] = fmt.Sprintf("%-40s %4d instances, %4d SSM online", group.name, len(group.instances), online)
+	}
+	index, err := picker.Choose(fmt.Sprintf("Select a group (by %s)", groupTagKey(opts.GroupBy)), rows, opts.Numbered)
+	if err != nil {
+		return nil, err
+	}
+	return groups[index].instances, nil
+}
+
+// printGroupedTable prints the list table with a heading above each group's rows.
+func printGroupedTable(instances []Instance, opts *options) {
+	cols := fitToTerminal(opts.tableColumns(), 2)
+	fmt.Println("  " + paintTableHeader(cols))
+	for _, group := range groupInstances(instances, groupTagKey(opts.GroupBy)) {
+		fmt.Printf("\n%s (%d)\n", group.name, len(group.instances))
+		for _, inst := range group.instances {
+			fmt.Println("  " + paintInstanceRow(inst, cols))
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/nkarisa/homebrew-aws-ssm-connect/pkg/picker"
+	"golang.org/x/term"
+)
+
+// guardConfig is the config file's guard section: the instances that need an explicit
+// confirmation, and an optional reason, before anything acts on them. For example
+//
+//	guard:
+//	  tags: [Env=prod]
+//	  name: ^prod-
+//	  confirm: name
+//	  reason: true
+type guardConfig struct {
+	// Tags protects instances with any of these tags, as Key=Value or a bare Key.
+	Tags []string `yaml:"tags"`
+	// Name protects instances whose Name tag matches this regular expression.
+	Name string `yaml:"name"`
+	// Confirm is "yes" (the default) to have "yes" typed, or "name" to have the
+	// instance's name typed.
+	Confirm string `yaml:"confirm"`
+	// Reason also asks why the instance is being accessed.
+	Reason bool `yaml:"reason"`
+}
+
+// guardPolicy is a validated guardConfig.
+type guardPolicy struct {
+	tags        []string
+	name        *regexp.Regexp
+	confirmName bool
+	reason      bool
+}
+
+// newGuardPolicy validates cfg. It returns nil if cfg protects nothing.
+func newGuardPolicy(cfg guardConfig) (*guardPolicy, error) {
+	if len(cfg.Tags) == 0 && cfg.Name == "" {
+		return nil, nil
+	}
+	policy := &guardPolicy{tags: cfg.Tags, reason: cfg.Reason}
+	if cfg.Name != "" {
+		re, err := regexp.Compile(cfg.Name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid guard name pattern: %w", err)
+		}
+		policy.name = re
+	}
+	switch cfg.Confirm {
+	case "", "yes":
+	case "name":
+		policy.confirmName = true
+	default:
+		return nil, fmt.Errorf("invalid guard confirm '%s': expected 'yes' or 'name'", cfg.Confirm)
+	}
+	return policy, nil
+}
+
+// protects reports whether inst falls under the policy.
+func (p *guardPolicy) protects(inst Instance) bool {
+	if p.name != nil && inst.Name != "" && p.name.MatchString(inst.Name) {
+		return true
+	}
+	for _, tag := range p.tags {
+		key, value, hasValue := strings.Cut(tag, "=")
+		if got, ok := inst.Tags[key]; ok && (!hasValue || got == value) {
+			return true
+		}
+	}
+	return false
+}
+
+// guardConfirmedEnv is set in the environment of the copies of this program started for
+// targets already checked, such as the ssh proxy command, tmux windows and background
+// tunnels, so they don't ask again: they may have no terminal to ask in, and the user has
+// answered once.
+const guardConfirmedEnv = envPrefix + "GUARD_CONFIRMED"
+
+// guardConfirmed reports whether the program that started this one confirmed the targets.
+// It is read once at startup, as confirming targets here sets the variable for our own
+// children.
+var guardConfirmed = os.Getenv(guardConfirmedEnv) != ""
+
+// guardEnvArgs returns the env(1) prefix of a shell command that runs a copy of this
+// program for targets already checked here. tmux windows need it, as they get the
+// environment of the tmux server rather than ours.
+func guardEnvArgs(opts *options) []string {
+	if opts.guard == nil {
+		return nil
+	}
+	return []string{"env", guardConfirmedEnv + "=1"}
+}
+
+// errGuardDeclined is returned when a protected instance was not confirmed.
+var errGuardDeclined = errors.New("confirmation declined")
+
+// checkGuard asks for the confirmation, and the reason, the guard policy requires before
+// acting on targets. Instances known only by ID are described first, so their tags can
+// be checked. The reason is kept in opts.Reason, and the programs we start afterwards
+// inherit the confirmation through guardConfirmedEnv.
+func checkGuard(ctx context.Context, cfg aws.Config, opts *options, targets []Instance) error {
+	if opts.guard == nil || guardConfirmed {
+		return nil
+	}
+	targets, err := describeBareTargets(ctx, cfg, opts, targets)
+	if err != nil {
+		return fmt.Errorf("checking the guard policy: %w", err)
+	}
+	var protected []Instance
+	for _, target := range targets {
+		if opts.guard.protects(target) {
+			protected = append(protected, target)
+		}
+	}
+	if len(protected) == 0 {
+		os.Setenv(guardConfirmedEnv, "1")
+		return nil
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return withHints(fmt.Errorf("%s is protected by the guard policy and needs confirmation in a terminal", hostLabel(protected[0])),
+			"Run the command interactively, or adjust the guard section of the config file.")
+	}
+
+	fmt.Fprintln(os.Stderr)
+	for _, inst := range protected {
+		fmt.Fprintf(os.Stderr, "%s %s (%s) is protected.\n", paint(os.Stderr, "bad", "!"), hostLabel(inst), inst.InstanceID)
+	}
+	want, prompt := "yes", "Type 'yes' to continue: "
+	switch {
+	case opts.guard.confirmName && len(protected) == 1:
+		want = hostLabel(protected[0])
+		prompt = fmt.Sprintf("Type '%s' to continue: ", want)
+	case opts.guard.confirmName:
+		want = strconv.Itoa(len(protected))
+		prompt = "Type the number of protected instances to continue: "
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	answer, err := picker.Stdin.ReadString('\n')
+	if err != nil || strings.TrimSpace(answer) != want {
+		return errGuardDeclined
+	}
+
+	if opts.guard.reason && opts.Reason == "" {
+		fmt.Fprint(os.Stderr, "Reason for access: ")
+		answer, err := picker.Stdin.ReadString('\n')
+		if err != nil || strings.TrimSpace(answer) == "" {
+			return errors.New("a reason is required to access protected instances")
+		}
+		opts.Reason = strings.TrimSpace(answer)
+	}
+	os.Setenv(guardConfirmedEnv, "1")
+	return nil
+}
+
+// describeBareTargets fills in the name and tags of the EC2 targets given only by ID, e.g.
+// with --target, in place. Other targets are returned as they are.
+func describeBareTargets(ctx context.Context, cfg aws.Config, opts *options, targets []Instance) ([]Instance, error) {
+	for i, target := range targets {
+		if target.Tags != nil || !strings.HasPrefix(target.InstanceID, "i-") {
+			continue
+		}
+		found, err := listInstancesWithSSMStatus(ctx, targetConfig(ctx, cfg, opts, target), []types.Filter{
+			{Name: aws.String("instance-id"), Values: []string{target.InstanceID}},
+		}, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(found) == 1 {
+			targets[i].Name, targets[i].Tags = found[0].Name, found[0].Tags
+		}
+	}
+	return targets, nil
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nkarisa/homebrew-aws-ssm-connect/pkg/picker"
+)
+
+// historyLimit is how many recent connections are remembered.
+const historyLimit = 50
+
+// historyEntry is one remembered connection.
+type historyEntry struct {
+	InstanceID  string    `json:"instance_id"`
+	Name        string    `json:"name,omitempty"`
+	Region      string    `json:"region"`
+	Profile     string    `json:"profile,omitempty"`
+	Reason      string    `json:"reason,omitempty"`
+	ConnectedAt time.Time `json:"connected_at"`
+
+	// The credentials the connection was made with besides the profile: the account
+	// reached through --accounts and its --account-role, --role-arn, or the SSO account
+	// and role picked with --sso-pick.
+	Account     string `json:"account,omitempty"`
+	AccountRole string `json:"account_role,omitempty"`
+	RoleARN     string `json:"role_arn,omitempty"`
+	SSOAccount  string `json:"sso_account,omitempty"`
+	SSORole     string `json:"sso_role,omitempty"`
+}
+
+// stateDir returns the XDG-compliant state directory for the tool:
+// $XDG_STATE_HOME/aws-ssm-connect, falling back to ~/.local/state/aws-ssm-connect.
+func stateDir() (string, error) {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "aws-ssm-connect"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "state", "aws-ssm-connect"), nil
+}
+
+func historyPath() (string, error) {
+	dir, err := stateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "history.json"), nil
+}
+
+// loadHistory returns the remembered connections, most recent first.
+func loadHistory() []historyEntry {
+	path, err := historyPath()
+	if err != nil {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var entries []historyEntry
+	if json.Unmarshal(data, &entries) != nil {
+		return nil
+	}
+	return entries
+}
+
+// recordHistory moves a connection to the top of the history, with the credentials and the
+// --reason it was made with. Like the inventory cache it is best effort.
+func recordHistory(opts *options, inst Instance) {
+	path, err := historyPath()
+	if err != nil {
+		return
+	}
+
+	entry := historyEntry{
+		InstanceID:  inst.InstanceID,
+		Name:        inst.Name,
+		Region:      inst.Region,
+		Profile:     opts.Profile,
+		Reason:      opts.Reason,
+		ConnectedAt: time.Now(),
+		RoleARN:     opts.RoleARN,
+		SSOAccount:  opts.SSOAccount,
+		SSORole:     opts.SSORole,
+	}
+	if len(opts.Accounts) > 0 && inst.Account != "" {
+		entry.Account, entry.AccountRole = inst.Account, opts.AccountRole
+	}
+	entries := []historyEntry{entry}
+	for _, old := range loadHistory() {
+		if old.InstanceID == entry.InstanceID && old.Profile == entry.Profile {
+			// Connecting by ID doesn't look up the name; keep the one we knew.
+			if entries[0].Name == "" {
+				entries[0].Name = old.Name
+			}
+			continue
+		}
+		if len(entries) < historyLimit {
+			entries = append(entries, old)
+		}
+	}
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return
+	}
+	os.WriteFile(path, data, 0o600)
+}
+
+// applyHistory handles --last and --history by targeting a remembered connection, with
+// the credentials and region it was made with unless those are given on the command line.
+func (o *options) applyHistory() error {
+	if !o.Last && !o.History {
+		return nil
+	}
+	entries := loadHistory()
+	if len(entries) == 0 {
+		return errors.New("no connection history yet; connect to an instance first")
+	}
+
+	entry := entries[0]
+	if o.History {
+		rows := make([]string, len(entries))
+		for i, e := range entries {
+			name := e.Name
+			if name == "" {
+				name = "N/A"
+			}
+			rows[i] = fmt.Sprintf("%-20s %-30s %-15s %-15s %s", e.InstanceID, name, e.Region, e.Profile, formatAge(time.Since(e.ConnectedAt)))
+		}
+		index, err := picker.Choose("Recent connections", rows, o.Numbered)
+		if err != nil {
+			return err
+		}
+		entry = entries[index]
+	}
+
+	o.Target = entry.InstanceID
+	if o.Profile == "" && entry.Profile != "" {
+		o.Profile = entry.Profile
+		o.restored = append(o.restored, "profile")
+	}
+	if o.Region == "" && entry.Region != "" {
+		o.Region = entry.Region
+		o.restored = append(o.restored, "region")
+	}
+	if o.RoleARN == "" && entry.RoleARN != "" {
+		o.RoleARN = entry.RoleARN
+		o.restored = append(o.restored, "role-arn")
+	}
+	if o.SSOAccount == "" && o.SSORole == "" && !o.SSOPick && entry.SSOAccount != "" {
+		o.SSOAccount, o.SSORole = entry.SSOAccount, entry.SSORole
+		o.restored = append(o.restored, "sso-account", "sso-role")
+	}
+	if len(o.Accounts) == 0 && entry.Account != "" {
+		o.Accounts, o.targetAccount = stringList{entry.Account}, entry.Account
+		o.restored = append(o.restored, "accounts")
+		if o.AccountRole == "" {
+			o.AccountRole = entry.AccountRole
+			o.restored = append(o.restored, "account-role")
+		}
+	}
+	return nil
+}
+
+// formatAge renders a duration the way people say it: "just now", "5m ago", "3d ago".
+func formatAge(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd ago", int(d.Hours()/24))
+	}
+}
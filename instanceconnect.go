@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2instanceconnect"
+	"golang.org/x/crypto/ssh"
+)
+
+// pushInstanceConnectKey generates a throwaway SSH key pair and pushes its public half to
+// each instance for user with EC2 Instance Connect, which accepts it for 60 seconds. It
+// returns the private key file for ssh -i and a function that deletes it.
+//
+// The instance needs the EC2 Instance Connect agent (preinstalled on Amazon Linux and
+// Ubuntu AMIs), and the caller ec2-instance-connect:SendSSHPublicKey.
+func pushInstanceConnectKey(ctx context.Context, cfg aws.Config, user string, instanceIDs []string) (string, func(), error) {
+	key, err := newTemporaryKey()
+	if err != nil {
+		return "", nil, err
+	}
+
+	for _, id := range instanceIDs {
+		if err := sendPublicKey(ctx, cfg, user, id, key.public); err != nil {
+			key.remove()
+			return "", nil, err
+		}
+	}
+	return key.path, key.remove, nil
+}
+
+// sendPublicKey pushes an authorized_keys line to the instance for user with EC2 Instance
+// Connect.
+func sendPublicKey(ctx context.Context, cfg aws.Config, user, instanceID, public string) error {
+	_, err := ec2instanceconnect.NewFromConfig(cfg).SendSSHPublicKey(ctx, &ec2instanceconnect.SendSSHPublicKeyInput{
+		InstanceId:     aws.String(instanceID),
+		InstanceOSUser: aws.String(user),
+		SSHPublicKey:   aws.String(public),
+	})
+	if err != nil {
+		return fmt.Errorf("sending an SSH key to %s with EC2 Instance Connect: %w", instanceID, describeAPIError(err))
+	}
+	return nil
+}
+
+// temporaryKey is an SSH key pair generated for one run. The private key lives in a
+// private temporary directory until remove is called.
+type temporaryKey struct {
+	path   string // private key file, for ssh -i
+	public string // public key in authorized_keys format
+	remove func()
+}
+
+// newTemporaryKey generates an ed25519 key pair and writes its private key to a new
+// temporary directory.
+func newTemporaryKey() (temporaryKey, error) {
+	dir, err := os.MkdirTemp("", "aws-ssm-connect-")
+	if err != nil {
+		return temporaryKey{}, fmt.Errorf("creating a directory for the SSH key: %w", err)
+	}
+	path := filepath.Join(dir, "id_ed25519")
+	public, err := writeKeyPair(path)
+	if err != nil {
+		os.RemoveAll(dir)
+		return temporaryKey{}, err
+	}
+	return temporaryKey{path: path, public: public, remove: func() { os.RemoveAll(dir) }}, nil
+}
+
+// writeKeyPair generates an ed25519 key pair, writes the private key to path and the public
+// key to path.pub, and returns the public key in authorized_keys format.
+func writeKeyPair(path string) (string, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", fmt.Errorf("generating an SSH key: %w", err)
+	}
+	sshPublic, err := ssh.NewPublicKey(public)
+	if err != nil {
+		return "", fmt.Errorf("encoding the SSH key: %w", err)
+	}
+	block, err := ssh.MarshalPrivateKey(private, "aws-ssm-connect")
+	if err != nil {
+		return "", fmt.Errorf("encoding the SSH key: %w", err)
+	}
+	authorized := string(ssh.MarshalAuthorizedKey(sshPublic))
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+		return "", fmt.Errorf("writing the SSH key: %w", err)
+	}
+	if err := os.WriteFile(path+".pub", []byte(authorized), 0o644); err != nil {
+		return "", fmt.Errorf("writing the SSH key: %w", err)
+	}
+	return authorized, nil
+}
+
+// instanceConnectArgs pushes a key for user with EC2 Instance Connect and returns the
+// ssh/scp options that use it. When that fails a warning says why and no options are
+// returned, so ssh falls back to the user's own keys.
+func instanceConnectArgs(ctx context.Context, cfg aws.Config, user string, instanceIDs ...string) ([]string, func()) {
+	path, cleanup, err := pushInstanceConnectKey(ctx, cfg, user, instanceIDs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v; trying your own SSH keys.\n", err)
+		return nil, func() {}
+	}
+	return []string{"-i", path, "-o", "IdentitiesOnly=yes"}, cleanup
+}
+
+// addInstanceConnectFlag registers --instance-connect for the commands that run ssh or scp.
+func addInstanceConnectFlag(fs *flag.FlagSet, enabled *bool) {
+	fs.BoolVar(enabled, "instance-connect", true, "push a temporary SSH key with EC2 Instance Connect unless -i is given (--instance-connect=false to use only your own keys)")
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/nkarisa/homebrew-aws-ssm-connect/pkg/inventory"
+)
+
+// defaultFetchTimeout is how long one region or account may take to list before it is
+// skipped, so a slow or unreachable one doesn't hold up the rest.
+const defaultFetchTimeout = 45 * time.Second
+
+// Instance is the inventory package's instance, under the name the rest of the program uses.
+type Instance = inventory.Instance
+
+// listInstancesWithSSMStatus lists the targets of sources in a region with their SSM agent
+// status (see inventory.List), reporting what could not be fetched as warnings.
+func listInstancesWithSSMStatus(ctx context.Context, cfg aws.Config, filters []types.Filter, sources []string, onPage func(total int)) ([]Instance, error) {
+	instances, err := inventory.List(ctx, cfg, filters, inventory.ListOptions{Sources: sources, OnPage: onPage, Clients: inventoryClients, Warn: printListWarning})
+	if err != nil {
+		return nil, describeAPIError(err)
+	}
+	return instances, nil
+}
+
+// listInstancesAllRegions queries every region enabled for the account, --fetch-concurrency
+// at a time, and merges the results. Regions that fail (e.g. blocked by an SCP) or take
+// longer than --fetch-timeout are reported and skipped. onRegion, if set, is called as each
+// region finishes.
+func listInstancesAllRegions(ctx context.Context, cfg aws.Config, filters []types.Filter, opts *options, onRegion func(done, total int)) ([]Instance, error) {
+	instances, err := inventory.ListAllRegions(ctx, cfg, filters, inventory.ListOptions{
+		Sources:     opts.instanceSources(),
+		Clients:     inventoryClients,
+		Concurrency: opts.FetchConcurrency,
+		Timeout:     opts.FetchTimeout,
+		OnRegion:    onRegion,
+		Warn:        printListWarning,
+	})
+	if err != nil {
+		return nil, describeAPIError(err)
+	}
+	return instances, nil
+}
+
+// printRegionProgress reports how many regions of the account have been searched on a
+// single, rewritten stderr line. Plain output only gets the total at the end.
+func printRegionProgress(done, total int) {
+	if plainOutput {
+		if done == total {
+			fmt.Fprintf(os.Stderr, "Searched %d regions.\n", total)
+		}
+		return
+	}
+	fmt.Fprintf(os.Stderr, "\rSearched %d/%d regions...", done, total)
+	if done == total {
+		fmt.Fprintln(os.Stderr)
+	}
+}
+
+// instanceSources returns the --source names, split at commas, with hybrid added for
+// --hybrid. The default is EC2 alone.
+func (o *options) instanceSources() []string {
+	var sources []string
+	for _, value := range o.Sources {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" && !slices.Contains(sources, name) {
+				sources = append(sources, name)
+			}
+		}
+	}
+	if len(sources) == 0 {
+		sources = []string{inventory.SourceEC2}
+	}
+	if o.Hybrid && !slices.Contains(sources, inventory.SourceHybrid) {
+		sources = append(sources, inventory.SourceHybrid)
+	}
+	return sources
+}
+
+// printListWarning reports a part of the listing that could not be fetched.
+func printListWarning(err error) {
+	fmt.Fprintf(os.Stderr, "Warning: %v\n", describeAPIError(err))
+}
+
+// printFetchProgress reports the running instance count on a single, rewritten stderr line.
+// Plain output leaves it out.
+func printFetchProgress(total int) {
+	if plainOutput {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "\rFetched %d instances...", total)
+}
+
+// sortKeys are the orders accepted by --sort, in the order the numbered menu cycles them.
+var sortKeys = inventory.SortKeys
+
+// sortOrder is a flag.Value restricted to sortKeys.
+type sortOrder string
+
+func (s *sortOrder) String() string { return string(*s) }
+
+func (s *sortOrder) Set(v string) error {
+	for _, key := range sortKeys {
+		if v == key {
+			*s = sortOrder(v)
+			return nil
+		}
+	}
+	return fmt.Errorf("must be one of %s", strings.Join(sortKeys, ", "))
+}
+
+// sortInstances sorts instances in place by the given key; see inventory.Sort.
+func sortInstances(instances []Instance, key sortOrder) {
+	inventory.Sort(instances, string(key))
+}
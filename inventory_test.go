@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+func TestListInstancesWithSSMStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		sources []string
+		ssmErr  error
+		want    map[string]string // instance ID to SSM status
+	}{
+		{
+			name: "ec2 with agent status",
+			want: map[string]string{
+				"i-0aaa1111aaaa1111a": "Online",
+				"i-0bbb2222bbbb2222b": "ConnectionLost",
+				"i-0ccc3333cccc3333c": "Not Registered",
+			},
+		},
+		{
+			name:   "agent status unavailable",
+			ssmErr: errors.New("AccessDeniedException"),
+			want: map[string]string{
+				"i-0aaa1111aaaa1111a": "Unknown",
+				"i-0bbb2222bbbb2222b": "Unknown",
+				"i-0ccc3333cccc3333c": "Unknown",
+			},
+		},
+		{
+			name:    "ec2 and hybrid",
+			sources: []string{"ec2", "hybrid"},
+			want: map[string]string{
+				"i-0aaa1111aaaa1111a":  "Online",
+				"i-0bbb2222bbbb2222b":  "ConnectionLost",
+				"i-0ccc3333cccc3333c":  "Not Registered",
+				"mi-0ddd4444dddd4444d": "Online",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ec2Client := &fakeEC2{}
+			loadFixture(t, "describe_instances.json", &ec2Client.output)
+			ssmClient := &fakeSSM{err: tt.ssmErr}
+			loadFixture(t, "describe_instance_information.json", &ssmClient.output)
+			useInventory(t, ec2Client, ssmClient)
+
+			filters := []types.Filter{{Name: aws.String("instance-state-name"), Values: []string{"running", "stopped"}}}
+			instances, err := listInstancesWithSSMStatus(context.Background(), aws.Config{Region: "us-east-1"}, filters, tt.sources, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := map[string]string{}
+			for _, inst := range instances {
+				got[inst.InstanceID] = inst.SSMStatus
+				if inst.Region != "us-east-1" {
+					t.Errorf("%s: Region = %q, want us-east-1", inst.InstanceID, inst.Region)
+				}
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("statuses = %v, want %v", got, tt.want)
+			}
+			if len(ec2Client.inputs) != 1 || len(ec2Client.inputs[0].Filters) != 1 || aws.ToString(ec2Client.inputs[0].Filters[0].Name) != "instance-state-name" {
+				t.Errorf("DescribeInstances was not called once with the filters: %+v", ec2Client.inputs)
+			}
+		})
+	}
+}
+
+func TestListInstancesWithSSMStatusFields(t *testing.T) {
+	ec2Client := &fakeEC2{}
+	loadFixture(t, "describe_instances.json", &ec2Client.output)
+	ssmClient := &fakeSSM{output: &ssm.DescribeInstanceInformationOutput{}}
+	useInventory(t, ec2Client, ssmClient)
+
+	instances, err := listInstancesWithSSMStatus(context.Background(), aws.Config{Region: "us-east-1"}, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(instances) != 3 {
+		t.Fatalf("got %d instances, want 3", len(instances))
+	}
+	db := instances[1]
+	if db.Name != "db-1" || db.State != "stopped" || !db.IsWindows() || db.Lifecycle != "spot" || db.AvailabilityZone != "us-east-1b" {
+		t.Errorf("db-1 = %+v", db)
+	}
+	if unnamed := instances[2]; unnamed.Name != "" || unnamed.Lifecycle != "on-demand" {
+		t.Errorf("unnamed instance = %+v", unnamed)
+	}
+}
+
+func TestListInstancesAllRegions(t *testing.T) {
+	ec2Client := &fakeEC2{regions: []string{"us-east-1", "eu-west-1", "ap-southeast-2"}}
+	loadFixture(t, "describe_instances.json", &ec2Client.output)
+	ssmClient := &fakeSSM{}
+	loadFixture(t, "describe_instance_information.json", &ssmClient.output)
+	useInventory(t, ec2Client, ssmClient)
+
+	var calls, last int
+	onRegion := func(done, total int) {
+		calls++
+		last = total
+	}
+	opts := &options{FetchConcurrency: 2}
+	instances, err := listInstancesAllRegions(context.Background(), aws.Config{Region: "us-east-1"}, nil, opts, onRegion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 || last != 3 {
+		t.Errorf("onRegion called %d times with total %d, want 3 times with 3", calls, last)
+	}
+	perRegion := map[string]int{}
+	for _, inst := range instances {
+		perRegion[inst.Region]++
+	}
+	if want := map[string]int{"us-east-1": 3, "eu-west-1": 3, "ap-southeast-2": 3}; !maps.Equal(perRegion, want) {
+		t.Errorf("instances per region = %v, want %v", perRegion, want)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	logstypes "github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+)
+
+// maxLogGroups is how many log groups one logs command may tail; each is polled on its own.
+const maxLogGroups = 20
+
+// runLogs implements the logs command: print the CloudWatch Logs events an instance wrote
+// to the groups matching a pattern, and keep following them, for when the logs are all
+// that's needed and a shell is not:
+//
+//	aws-ssm-connect logs i-0abc --group '/app/*'
+//
+// Streams are those whose name starts with the instance ID, which is how the CloudWatch agent
+// names them by default ({instance_id}); --stream picks another prefix.
+func runLogs(ctx context.Context, args []string) int {
+	var opts options
+	var group, stream, filter string
+	var since time.Duration
+	var noFollow bool
+	fs := newFlagSet(findCommand("logs"), &opts)
+	addDiscoveryFlags(fs, &opts)
+	addPickerFlags(fs, &opts)
+	fs.StringVar(&group, "group", "", "tail the log groups whose name matches this `pattern` (wildcards allowed)")
+	fs.StringVar(&stream, "stream", "", "tail the streams whose name starts with this `prefix` instead of the instance ID")
+	fs.StringVar(&filter, "filter", "", "only show events matching this CloudWatch Logs filter `pattern`")
+	fs.DurationVar(&since, "since", 10*time.Minute, "start with the events of this `duration` back")
+	fs.BoolVar(&noFollow, "no-follow", false, "print the events so far and exit instead of following new ones")
+
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return flagErrorCode(err)
+	}
+	if len(positional) > 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	if len(positional) == 1 {
+		opts.Target = positional[0]
+	}
+	if group == "" {
+		return reportError(withHints(errors.New("no log group given"),
+			"Pass --group with the group's name or a pattern such as '/app/*'."))
+	}
+
+	fmt.Fprintln(os.Stderr, banner)
+	// Reading logs changes nothing, so the guard policy isn't consulted.
+	cfg, targets, err := findTargets(ctx, &opts)
+	if err != nil {
+		return targetErrorCode(err, &opts)
+	}
+	target := targets[0]
+	if stream == "" {
+		stream = target.InstanceID
+	}
+
+	client := cloudwatchlogs.NewFromConfig(targetConfig(ctx, cfg, &opts, target))
+	groups, err := matchLogGroups(ctx, client, group)
+	if err != nil {
+		return reportError(err)
+	}
+	if len(groups) == 0 {
+		return reportError(withHints(fmt.Errorf("no log group matches %s in %s", group, client.Options().Region),
+			"Wildcards in --group don't match '/'; use '/app/*/*' for deeper groups."))
+	}
+	if len(groups) > maxLogGroups {
+		return reportError(withHints(fmt.Errorf("%d log groups match %s; at most %d can be tailed at once", len(groups), group, maxLogGroups),
+			"Narrow the --group pattern."))
+	}
+	fmt.Fprintf(os.Stderr, "Logs of %s (streams starting with %s) in %s.", hostLabel(target), stream, strings.Join(groups, ", "))
+	if !noFollow {
+		fmt.Fprint(os.Stderr, " Press Ctrl+C to stop.")
+	}
+	fmt.Fprintln(os.Stderr)
+
+	tail := &logTail{client: client, groups: groups, stream: stream, filter: filter,
+		start: time.Now().Add(-since).UnixMilli(), seen: map[string]bool{}}
+	for {
+		if err := tail.poll(ctx); err != nil {
+			return reportError(err)
+		}
+		if noFollow {
+			return exitOK
+		}
+		select {
+		case <-ctx.Done():
+			return exitOK
+		case <-time.After(logPollInterval):
+		}
+	}
+}
+
+// matchLogGroups returns the names of the log groups matching pattern, as path.Match
+// matches it. The part before the first wildcard narrows the listing.
+func matchLogGroups(ctx context.Context, client *cloudwatchlogs.Client, pattern string) ([]string, error) {
+	input := &cloudwatchlogs.DescribeLogGroupsInput{}
+	if prefix, _, _ := strings.Cut(pattern, "*"); prefix != "" && !strings.ContainsAny(prefix, "?[\\") {
+		input.LogGroupNamePrefix = aws.String(prefix)
+	}
+	var groups []string
+	paginator := cloudwatchlogs.NewDescribeLogGroupsPaginator(client, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, withHints(fmt.Errorf("listing log groups: %w", describeAPIError(err)),
+				"You are not allowed to call logs:DescribeLogGroups.")
+		}
+		for _, g := range page.LogGroups {
+			name := aws.ToString(g.LogGroupName)
+			if matched, _ := path.Match(pattern, name); matched {
+				groups = append(groups, name)
+			}
+		}
+	}
+	return groups, nil
+}
+
+// logTail follows the events of the streams starting with stream in several log groups.
+type logTail struct {
+	client *cloudwatchlogs.Client
+	groups []string
+	stream string
+	filter string
+	start  int64 // milliseconds since the epoch of the newest event printed
+	seen   map[string]bool
+}
+
+// poll prints the events that arrived since the last poll, oldest first. With more than one
+// group each line is prefixed with its group's name.
+func (t *logTail) poll(ctx context.Context) error {
+	var events []logstypes.FilteredLogEvent
+	var sources []string
+	for _, group := range t.groups {
+		input := &cloudwatchlogs.FilterLogEventsInput{
+			LogGroupName:        aws.String(group),
+			LogStreamNamePrefix: aws.String(t.stream),
+			StartTime:           aws.Int64(t.start),
+		}
+		if t.filter != "" {
+			input.FilterPattern = aws.String(t.filter)
+		}
+		paginator := cloudwatchlogs.NewFilterLogEventsPaginator(t.client, input)
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return withHints(fmt.Errorf("reading %s: %w", group, describeAPIError(err)),
+					"You are not allowed to call logs:FilterLogEvents on the group.")
+			}
+			for _, event := range page.Events {
+				if id := aws.ToString(event.EventId); !t.seen[id] {
+					t.seen[id] = true
+					events = append(events, event)
+					sources = append(sources, group)
+				}
+			}
+		}
+	}
+
+	order := make([]int, len(events))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return aws.ToInt64(events[order[a]].Timestamp) < aws.ToInt64(events[order[b]].Timestamp)
+	})
+	latest := t.start
+	for _, i := range order {
+		line := strings.TrimRight(aws.ToString(events[i].Message), "\n")
+		if len(t.groups) > 1 {
+			line = paint(os.Stdout, "muted", sources[i]) + " " + line
+		}
+		fmt.Println(line)
+		latest = max(latest, aws.ToInt64(events[i].Timestamp))
+	}
+	// Events with the same timestamp may arrive later, so ask from the newest one again.
+	t.start = latest
+	return nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	cwtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+)
+
+// metricsWindow is how far back the metrics snapshot looks.
+const metricsWindow = 15 * time.Minute
+
+// metricQueries are the EC2 metrics of the snapshot, each with the statistic taken over
+// metricsWindow.
+var metricQueries = []struct{ name, stat string }{
+	{"CPUUtilization", "Average"},
+	{"NetworkIn", "Sum"},
+	{"NetworkOut", "Sum"},
+	{"StatusCheckFailed", "Maximum"},
+}
+
+// maxMetricQueries is how many queries one GetMetricData call may carry.
+const maxMetricQueries = 500
+
+// instanceMetrics is the CloudWatch snapshot of one instance. A field is nil when the
+// instance reported no datapoint for it, e.g. because it was stopped.
+type instanceMetrics struct {
+	cpu, netIn, netOut *float64
+	statusFailed       *float64
+}
+
+// summary describes the snapshot in one line for the tui's detail pane.
+func (m instanceMetrics) summary() string {
+	if m.cpu == nil && m.netIn == nil && m.statusFailed == nil {
+		return "no datapoints"
+	}
+	var parts []string
+	if m.cpu != nil {
+		parts = append(parts, fmt.Sprintf("CPU %.0f%%", *m.cpu))
+	}
+	if m.netIn != nil && m.netOut != nil {
+		parts = append(parts, fmt.Sprintf("net in %s, out %s", formatBytes(*m.netIn), formatBytes(*m.netOut)))
+	}
+	switch {
+	case m.statusFailed == nil:
+	case *m.statusFailed > 0:
+		parts = append(parts, "status checks FAILED")
+	default:
+		parts = append(parts, "status checks ok")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// fetchMetrics returns the CloudWatch snapshot of every EC2 instance in instances, which
+// must all be reachable with cfg, keyed by instance ID. The queries of up to 125 instances
+// go in one GetMetricData call.
+func fetchMetrics(ctx context.Context, cfg aws.Config, instances []Instance) (map[string]instanceMetrics, error) {
+	client := cloudwatch.NewFromConfig(cfg)
+	end := time.Now().Truncate(time.Minute)
+	start := end.Add(-metricsWindow)
+
+	var ids []string
+	for _, inst := range instances {
+		if strings.HasPrefix(inst.InstanceID, "i-") {
+			ids = append(ids, inst.InstanceID)
+		}
+	}
+	snapshots := map[string]instanceMetrics{}
+	perCall := maxMetricQueries / len(metricQueries)
+	for first := 0; first < len(ids); first += perCall {
+		batch := ids[first:min(first+perCall, len(ids))]
+		var queries []cwtypes.MetricDataQuery
+		for i, id := range batch {
+			for k, q := range metricQueries {
+				queries = append(queries, cwtypes.MetricDataQuery{
+					Id: aws.String(fmt.Sprintf("m%d_%d", i, k)),
+					MetricStat: &cwtypes.MetricStat{
+						Metric: &cwtypes.Metric{
+							Namespace:  aws.String("AWS/EC2"),
+							MetricName: aws.String(q.name),
+							Dimensions: []cwtypes.Dimension{{Name: aws.String("InstanceId"), Value: aws.String(id)}},
+						},
+						Period: aws.Int32(int32(metricsWindow.Seconds())),
+						Stat:   aws.String(q.stat),
+					},
+				})
+			}
+		}
+
+		paginator := cloudwatch.NewGetMetricDataPaginator(client, &cloudwatch.GetMetricDataInput{
+			MetricDataQueries: queries,
+			StartTime:         aws.Time(start),
+			EndTime:           aws.Time(end),
+		})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("getting CloudWatch metrics: %w", describeAPIError(err))
+			}
+			for _, result := range page.MetricDataResults {
+				var i, k int
+				if _, err := fmt.Sscanf(aws.ToString(result.Id), "m%d_%d", &i, &k); err != nil || len(result.Values) == 0 {
+					continue
+				}
+				m := snapshots[batch[i]]
+				value := result.Values[0]
+				switch k {
+				case 0:
+					m.cpu = &value
+				case 1:
+					m.netIn = &value
+				case 2:
+					m.netOut = &value
+				case 3:
+					m.statusFailed = &value
+				}
+				snapshots[batch[i]] = m
+			}
+		}
+	}
+	return snapshots, nil
+}
+
+// formatBytes renders a byte count with a binary unit: "512 B", "1.5 KiB", "3.2 GiB".
+func formatBytes(n float64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%.0f B", n)
+	}
+	exp := 0
+	for n >= unit*unit && exp < 4 {
+		n /= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", n/unit, "KMGTP"[exp])
+}
+
+// loadMetrics returns the metrics snapshot of every instance, fetched with one batch of
+// calls per region and account.
+func loadMetrics(ctx context.Context, cfg aws.Config, opts *options, instances []Instance) (map[string]instanceMetrics, error) {
+	groups := map[string][]Instance{}
+	var order []string
+	for _, inst := range instances {
+		key := inst.Region + "/" + inst.Account
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], inst)
+	}
+	snapshots := map[string]instanceMetrics{}
+	for _, key := range order {
+		found, err := fetchMetrics(ctx, targetConfig(ctx, cfg, opts, groups[key][0]), groups[key])
+		if err != nil {
+			return snapshots, err
+		}
+		maps.Copy(snapshots, found)
+	}
+	return snapshots, nil
+}
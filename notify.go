@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/user"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+// notifyTimeout bounds each webhook call, so an unreachable endpoint delays a session by
+// no more than this.
+const notifyTimeout = 5 * time.Second
+
+// notifyConfig is the config file's notify section: where to announce sessions as they
+// start and end. For example
+//
+//	notify:
+//	  webhook: https://audit.example.com/ssm-sessions
+//	  slack: https://hooks.slack.com/services/T000/B000/XXXX
+type notifyConfig struct {
+	// Webhook receives a sessionEvent as JSON.
+	Webhook string `yaml:"webhook"`
+	// Slack is a Slack incoming webhook URL, which receives a one-line message.
+	Slack string `yaml:"slack"`
+}
+
+func (c notifyConfig) enabled() bool { return c.Webhook != "" || c.Slack != "" }
+
+// sessionEvent is the JSON posted to the webhook.
+type sessionEvent struct {
+	Event     string    `json:"event"` // session_start or session_end
+	User      string    `json:"user"`
+	Principal string    `json:"principal,omitempty"`
+	Account   string    `json:"account,omitempty"`
+	Region    string    `json:"region"`
+	Instance  string    `json:"instance"`
+	Document  string    `json:"document,omitempty"`
+	SessionID string    `json:"session_id"`
+	Reason    string    `json:"reason,omitempty"`
+	Time      time.Time `json:"time"`
+	// Duration is set on session_end, in seconds.
+	Duration float64 `json:"duration_seconds,omitempty"`
+}
+
+// notifySessionStart announces a session that was just started and returns the function
+// that announces its end. Notifications are best effort: failures are warnings.
+func notifySessionStart(ctx context.Context, cfg aws.Config, opts *options, input *ssm.StartSessionInput, output *ssm.StartSessionOutput) func() {
+	if !opts.notify.enabled() {
+		return func() {}
+	}
+	event := sessionEvent{
+		Event:     "session_start",
+		User:      localUser(),
+		Region:    cfg.Region,
+		Instance:  aws.ToString(input.Target),
+		Document:  aws.ToString(input.DocumentName),
+		SessionID: aws.ToString(output.SessionId),
+		Reason:    opts.Reason,
+		Time:      time.Now(),
+	}
+	// The caller identity names the account the session is in, including one reached
+	// through --accounts or --role-arn.
+	event.Principal, event.Account = callerIdentity(ctx, cfg)
+	opts.notify.send(ctx, event)
+
+	started := event.Time
+	return func() {
+		event.Event = "session_end"
+		event.Time = time.Now()
+		event.Duration = event.Time.Sub(started).Round(time.Second).Seconds()
+		opts.notify.send(context.WithoutCancel(ctx), event)
+	}
+}
+
+// send posts event to the configured endpoints.
+func (c notifyConfig) send(ctx context.Context, event sessionEvent) {
+	if c.Webhook != "" {
+		if err := postJSON(ctx, c.Webhook, event); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: session notification failed: %v\n", err)
+		}
+	}
+	if c.Slack != "" {
+		if err := postJSON(ctx, c.Slack, map[string]string{"text": event.slackText()}); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Slack notification failed: %v\n", err)
+		}
+	}
+}
+
+// slackText describes event in one line.
+func (e sessionEvent) slackText() string {
+	where := e.Instance + " in " + e.Region
+	if e.Account != "" {
+		where += " (account " + e.Account + ")"
+	}
+	text := fmt.Sprintf("%s started an SSM session on %s", e.User, where)
+	if e.Event == "session_end" {
+		text = fmt.Sprintf("%s ended an SSM session on %s after %s", e.User, where, time.Duration(e.Duration)*time.Second)
+	}
+	if e.Reason != "" {
+		text += ": " + e.Reason
+	}
+	return text
+}
+
+// postJSON posts body as JSON to url and checks for a 2xx status.
+func postJSON(ctx context.Context, url string, body any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s answered %s", req.URL.Host, resp.Status)
+	}
+	return nil
+}
+
+// localUser returns the name of the local user running the tool.
+func localUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// outputFormats are the values accepted by list --output.
+var outputFormats = []string{"table", "json", "csv", "tsv"}
+
+// outputFormat is a flag.Value restricted to outputFormats.
+type outputFormat string
+
+func (f *outputFormat) String() string { return string(*f) }
+
+func (f *outputFormat) Set(v string) error {
+	for _, format := range outputFormats {
+		if v == format {
+			*f = outputFormat(v)
+			return nil
+		}
+	}
+	return fmt.Errorf("must be one of %s", strings.Join(outputFormats, ", "))
+}
+
+// instanceRecordHeader names the fields of instanceRecord, matching the JSON keys.
+var instanceRecordHeader = []string{"InstanceId", "Name", "PrivateIpAddress", "PublicIpAddress", "PrivateDnsName", "State", "SSMStatus", "Region", "Platform", "InstanceType", "Lifecycle", "AvailabilityZone", "LaunchTime", "Account", "Source", "VpcId", "SubnetId", "AgentVersion", "LastPingTime", "AgentOutdated"}
+
+// instanceRecord returns the fields of an instance for CSV and TSV output.
+func instanceRecord(inst Instance) []string {
+	launchTime := ""
+	if !inst.LaunchTime.IsZero() {
+		launchTime = inst.LaunchTime.UTC().Format(time.RFC3339)
+	}
+	lastPing := ""
+	if !inst.LastPing.IsZero() {
+		lastPing = inst.LastPing.UTC().Format(time.RFC3339)
+	}
+	return []string{inst.InstanceID, inst.Name, inst.PrivateIPAddress, inst.PublicIPAddress, inst.PrivateDNSName, inst.State, inst.SSMStatus, inst.Region, inst.Platform, inst.InstanceType, inst.Lifecycle, inst.AvailabilityZone, launchTime, inst.Account, inst.Source, inst.VpcID, inst.SubnetID,
+		inst.AgentVersion, lastPing, strconv.FormatBool(inst.AgentOutdated)}
+}
+
+// writeInstances prints the listing in a machine-readable format. An empty listing is
+// still valid output ("[]" or just the header), so scripts need no special case.
+func writeInstances(w io.Writer, instances []Instance, format outputFormat) error {
+	switch format {
+	case "json":
+		if instances == nil {
+			instances = []Instance{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(instances)
+	case "csv", "tsv":
+		cw := csv.NewWriter(w)
+		if format == "tsv" {
+			cw.Comma = '\t'
+		}
+		cw.Write(instanceRecordHeader)
+		for _, inst := range instances {
+			cw.Write(instanceRecord(inst))
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+	return fmt.Errorf("unsupported output format %q", format)
+}
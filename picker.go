@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/nkarisa/homebrew-aws-ssm-connect/pkg/picker"
+	"golang.org/x/term"
+)
+
+// selectInstance picks an instance with the fuzzy finder when running in a terminal, and
+// falls back to the numbered menu when stdin is not a TTY or --numbered or --plain is
+// passed. refresh refetches the listing for the numbered menu's 'r'.
+func selectInstance(instances []Instance, opts *options, refresh func() ([]Instance, error)) (Instance, error) {
+	if opts.Numbered || plainOutput || !term.IsTerminal(int(os.Stdin.Fd())) {
+		return promptForSelection(instances, opts, refresh)
+	}
+	// The picker indents rows by two cells for its cursor.
+	return fuzzySelect(instances, fitToTerminal(opts.tableColumns(), 2))
+}
+
+// instanceTableHeader returns the column headings matching formatInstanceRow.
+func instanceTableHeader(cols []column) string {
+	headers := make([]string, len(cols))
+	for i, col := range cols {
+		headers[i] = padCell(col.header, col.width)
+	}
+	return strings.Join(headers, " ")
+}
+
+// formatInstanceRow renders one instance as a fixed-width table row.
+func formatInstanceRow(inst Instance, cols []column) string {
+	cells := make([]string, len(cols))
+	for i, col := range cols {
+		cells[i] = padCell(col.value(inst), col.width)
+	}
+	return strings.Join(cells, " ")
+}
+
+// paintTableHeader is instanceTableHeader in the header color, for tables printed to stdout.
+func paintTableHeader(cols []column) string {
+	return paint(os.Stdout, "header", instanceTableHeader(cols))
+}
+
+// paintInstanceRow is formatInstanceRow with statuses colored, for tables printed to
+// stdout. Cells are padded before they are colored, so the columns still line up.
+func paintInstanceRow(inst Instance, cols []column) string {
+	if !colorEnabled(os.Stdout) {
+		return formatInstanceRow(inst, cols)
+	}
+	cells := make([]string, len(cols))
+	for i, col := range cols {
+		cells[i] = padCell(col.value(inst), col.width)
+		if col.role != nil {
+			cells[i] = paint(os.Stdout, col.role(inst), cells[i])
+		}
+	}
+	return strings.Join(cells, " ")
+}
+
+// fuzzySelect shows an incremental type-to-filter picker. Typing filters on the visible
+// columns, arrow keys move, Enter connects, Ctrl+C quits.
+func fuzzySelect(instances []Instance, cols []column) (Instance, error) {
+	rows := make([]string, len(instances))
+	for i, inst := range instances {
+		rows[i] = formatInstanceRow(inst, cols)
+	}
+
+	fmt.Println()
+	index, err := picker.Fuzzy("Type to filter, Enter to start an SSM Session, Ctrl+C to quit\n  "+instanceTableHeader(cols), rows)
+	if err != nil {
+		return Instance{}, err
+	}
+	return instances[index], nil
+}
+
+// promptForMultiSelection shows the numbered menu and accepts a list of options such as
+// "1,3,5-9", or "all".
+func promptForMultiSelection(instances []Instance, cols []column) ([]Instance, error) {
+	printInstanceMenu(instances, cols, listingDiff{})
+
+	fmt.Print("Enter the option numbers, e.g. 1,3,5-9 or 'all' (or 'q' to quit): ")
+
+	input, err := picker.Stdin.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("failed to read input: %w", err)
+	}
+
+	trimmedInput := strings.ToLower(strings.TrimSpace(input))
+	if trimmedInput == "q" {
+		return nil, errQuit
+	}
+
+	indexes, err := picker.ParseSelection(trimmedInput, len(instances))
+	if err != nil {
+		return nil, err
+	}
+	selected := make([]Instance, len(indexes))
+	for i, index := range indexes {
+		selected[i] = instances[index]
+	}
+	return selected, nil
+}
+
+// promptForSelection lists instances with numbered options and asks the user to input the option number.
+// Entering 's' re-sorts the table by the next sort key and shows it again, and 'r' refetches
+// it, marking the instances that appeared or disappeared.
+func promptForSelection(instances []Instance, opts *options, refresh func() ([]Instance, error)) (Instance, error) {
+	var diff listingDiff
+	for {
+		printInstanceMenu(instances, fitToTerminal(opts.tableColumns(), 9), diff)
+		diff = listingDiff{}
+
+		// Updated prompt to include the sort, refresh and quit options
+		fmt.Printf("Enter the option number to start an SSM Session ('s' to sort by %s, 'r' to refresh, 'q' to quit): ", nextSortKey(opts.Sort))
+
+		input, err := picker.Stdin.ReadString('\n')
+		if err != nil {
+			return Instance{}, fmt.Errorf("failed to read input: %w", err)
+		}
+
+		trimmedInput := strings.ToLower(strings.TrimSpace(input))
+
+		// Check for quit signal
+		if trimmedInput == "q" {
+			return Instance{}, errQuit
+		}
+		if trimmedInput == "s" {
+			opts.Sort = nextSortKey(opts.Sort)
+			sortInstances(instances, opts.Sort)
+			continue
+		}
+		if trimmedInput == "r" {
+			refreshed, err := refresh()
+			if err != nil {
+				return Instance{}, err
+			}
+			diff = diffListings(instances, refreshed)
+			instances = refreshed
+			if len(instances) == 0 {
+				return Instance{}, errNoInstances
+			}
+			continue
+		}
+
+		selectedNum, err := strconv.Atoi(trimmedInput)
+		if err != nil {
+			return Instance{}, fmt.Errorf("invalid input: '%s' is not a valid number or 'q'", trimmedInput)
+		}
+
+		// Validate the selected number is within bounds (1 to length)
+		if selectedNum < 1 || selectedNum > len(instances) {
+			return Instance{}, fmt.Errorf("invalid option number: %d. Must be between 1 and %d", selectedNum, len(instances))
+		}
+
+		// Get the instance using the 0-based index (selectedNum - 1)
+		return instances[selectedNum-1], nil
+	}
+}
+
+// nextSortKey returns the sort key after key in sortKeys, wrapping around.
+func nextSortKey(key sortOrder) sortOrder {
+	for i, k := range sortKeys {
+		if sortOrder(k) == key {
+			return sortOrder(sortKeys[(i+1)%len(sortKeys)])
+		}
+	}
+	return sortOrder(sortKeys[0])
+}
+
+// printInstanceMenu prints the numbered instance table used by the numbered prompts, with
+// the changes of the last refresh marked.
+func printInstanceMenu(instances []Instance, cols []column, diff listingDiff) {
+	// 8 chars for Option, followed by the instance columns
+	separator := strings.Repeat("-", 9+tableWidth(cols))
+
+	fmt.Println("\nAvailable EC2 Instances:")
+	fmt.Println(separator)
+	fmt.Println(paint(os.Stdout, "header", fmt.Sprintf("%-8s %s", "OPTION", instanceTableHeader(cols))))
+	fmt.Println(separator)
+
+	for i, inst := range instances {
+		// Print the 1-based index (i+1) as the option number
+		option := strconv.Itoa(i + 1)
+		if diff.added[inst.InstanceID] {
+			option += " +"
+		}
+		fmt.Printf("%-8s %s\n", option, paintInstanceRow(inst, cols))
+	}
+	for _, inst := range diff.gone {
+		fmt.Printf("%-8s %s\n", "-", paintInstanceRow(inst, cols))
+	}
+	fmt.Println(separator)
+	if s := diff.summary(); s != "" {
+		fmt.Println(s)
+	}
+}
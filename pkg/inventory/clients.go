@@ -0,0 +1,58 @@
+package inventory
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+// EC2API is the part of the EC2 API the inventory calls. *ec2.Client implements it.
+type EC2API interface {
+	ec2.DescribeInstancesAPIClient
+	DescribeRegions(ctx context.Context, params *ec2.DescribeRegionsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeRegionsOutput, error)
+}
+
+// SSMAPI is the part of the SSM API the inventory calls. *ssm.Client implements it.
+type SSMAPI interface {
+	ssm.DescribeInstanceInformationAPIClient
+}
+
+// ECSAPI is the part of the ECS API the inventory calls. *ecs.Client implements it.
+type ECSAPI interface {
+	ecs.ListClustersAPIClient
+	ecs.ListTasksAPIClient
+	DescribeTasks(ctx context.Context, params *ecs.DescribeTasksInput, optFns ...func(*ecs.Options)) (*ecs.DescribeTasksOutput, error)
+}
+
+// Clients creates the API clients sources use for a region. A nil constructor creates
+// the SDK's client, so the zero value talks to AWS; tests set the constructors to return
+// fakes that replay recorded responses.
+type Clients struct {
+	EC2 func(cfg aws.Config) EC2API
+	SSM func(cfg aws.Config) SSMAPI
+	ECS func(cfg aws.Config) ECSAPI
+}
+
+func (c Clients) ec2(cfg aws.Config) EC2API {
+	if c.EC2 != nil {
+		return c.EC2(cfg)
+	}
+	return ec2.NewFromConfig(cfg)
+}
+
+func (c Clients) ssm(cfg aws.Config) SSMAPI {
+	if c.SSM != nil {
+		return c.SSM(cfg)
+	}
+	return ssm.NewFromConfig(cfg)
+}
+
+func (c Clients) ecs(cfg aws.Config) ECSAPI {
+	if c.ECS != nil {
+		return c.ECS(cfg)
+	}
+	return ecs.NewFromConfig(cfg)
+}
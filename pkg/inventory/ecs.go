@@ -0,0 +1,178 @@
+package inventory
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecstypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+// describeTasksBatch is the most tasks DescribeTasks accepts at once.
+const describeTasksBatch = 100
+
+// ecsSource lists the containers of running ECS tasks as ECS Exec targets, with IDs of
+// the form ecs:<cluster>_<task>_<runtime ID> that StartSession accepts.
+type ecsSource struct{}
+
+func (ecsSource) Name() string { return SourceECS }
+
+// List lists the containers of the running tasks of every cluster in the region. Tag,
+// Name and private IP filters are applied to them here; instance filters such as VPC,
+// subnet or platform leave none.
+func (ecsSource) List(ctx context.Context, cfg aws.Config, filters []types.Filter, opts ListOptions) ([]Instance, error) {
+	for _, filter := range filters {
+		switch name := aws.ToString(filter.Name); {
+		case name == "vpc-id" || name == "subnet-id" || name == "platform" || name == "instance-id" ||
+			strings.HasPrefix(name, "instance.group-"):
+			return nil, nil
+		}
+	}
+
+	client := opts.Clients.ecs(cfg)
+	var instances []Instance
+	clusters := ecs.NewListClustersPaginator(client, &ecs.ListClustersInput{})
+	for clusters.HasMorePages() {
+		page, err := clusters.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, cluster := range page.ClusterArns {
+			found, err := listClusterTasks(ctx, client, cfg.Region, cluster)
+			if err != nil {
+				return nil, err
+			}
+			for _, inst := range found {
+				if matchesFilters(inst, filters) {
+					instances = append(instances, inst)
+				}
+			}
+		}
+	}
+	return instances, nil
+}
+
+// listClusterTasks lists the containers of the running tasks of one cluster.
+func listClusterTasks(ctx context.Context, client ECSAPI, region, cluster string) ([]Instance, error) {
+	var arns []string
+	tasks := ecs.NewListTasksPaginator(client, &ecs.ListTasksInput{Cluster: aws.String(cluster), DesiredStatus: ecstypes.DesiredStatusRunning})
+	for tasks.HasMorePages() {
+		page, err := tasks.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		arns = append(arns, page.TaskArns...)
+	}
+
+	var instances []Instance
+	for batch := range slices.Chunk(arns, describeTasksBatch) {
+		out, err := client.DescribeTasks(ctx, &ecs.DescribeTasksInput{
+			Cluster: aws.String(cluster),
+			Tasks:   batch,
+			Include: []ecstypes.TaskField{ecstypes.TaskFieldTags},
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, task := range out.Tasks {
+			instances = append(instances, taskContainers(region, cluster, task)...)
+		}
+	}
+	return instances, nil
+}
+
+// taskContainers turns the containers of a task into targets. Containers that have not
+// started have no runtime ID to connect to and are left out.
+func taskContainers(region, cluster string, task ecstypes.Task) []Instance {
+	group := aws.ToString(task.Group)
+	if _, name, ok := strings.Cut(group, ":"); ok {
+		group = name // "service:web" or "family:worker"
+	}
+	var tags map[string]string
+	for _, tag := range task.Tags {
+		if tags == nil {
+			tags = map[string]string{}
+		}
+		tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+
+	var instances []Instance
+	for _, container := range task.Containers {
+		runtimeID := aws.ToString(container.RuntimeId)
+		if runtimeID == "" {
+			continue
+		}
+		inst := Instance{
+			InstanceID:       "ecs:" + arnName(cluster) + "_" + arnName(aws.ToString(task.TaskArn)) + "_" + runtimeID,
+			Name:             group + "/" + aws.ToString(container.Name),
+			State:            strings.ToLower(aws.ToString(container.LastStatus)),
+			SSMStatus:        StatusNotRegistered,
+			Platform:         aws.ToString(task.PlatformFamily),
+			InstanceType:     strings.ToLower(string(task.LaunchType)),
+			AvailabilityZone: aws.ToString(task.AvailabilityZone),
+			LaunchTime:       aws.ToTime(task.StartedAt),
+			Region:           region,
+			Source:           SourceECS,
+			Tags:             tags,
+		}
+		if len(container.NetworkInterfaces) > 0 {
+			inst.PrivateIPAddress = aws.ToString(container.NetworkInterfaces[0].PrivateIpv4Address)
+		}
+		if task.EnableExecuteCommand {
+			for _, agent := range container.ManagedAgents {
+				if agent.Name == ecstypes.ManagedAgentNameExecuteCommandAgent {
+					inst.SSMStatus = strings.ToLower(aws.ToString(agent.LastStatus))
+					if inst.SSMStatus == "running" {
+						inst.SSMStatus = StatusOnline
+					}
+				}
+			}
+		}
+		instances = append(instances, inst)
+	}
+	return instances
+}
+
+// matchesFilters applies the Name, tag and private IP filters to a target that
+// DescribeInstances doesn't know about.
+func matchesFilters(inst Instance, filters []types.Filter) bool {
+	for _, filter := range filters {
+		var value string
+		switch name := aws.ToString(filter.Name); {
+		case name == "tag:Name":
+			if !slices.ContainsFunc(filter.Values, func(pattern string) bool {
+				return matchGlob(pattern, inst.Name)
+			}) {
+				return false
+			}
+			continue
+		case name == "private-ip-address":
+			value = inst.PrivateIPAddress
+		case name == "tag-key":
+			if !slices.ContainsFunc(filter.Values, func(key string) bool { _, ok := inst.Tags[key]; return ok }) {
+				return false
+			}
+			continue
+		case strings.HasPrefix(name, "tag:"):
+			tag, ok := inst.Tags[strings.TrimPrefix(name, "tag:")]
+			if !ok {
+				return false
+			}
+			value = tag
+		default:
+			continue
+		}
+		if !slices.Contains(filter.Values, value) {
+			return false
+		}
+	}
+	return true
+}
+
+// arnName returns the last part of an ARN's resource, e.g. the task ID of a task ARN.
+func arnName(arn string) string {
+	return arn[strings.LastIndex(arn, "/")+1:]
+}
@@ -0,0 +1,42 @@
+package inventory
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+func TestMatchesFilters(t *testing.T) {
+	inst := Instance{
+		Name:             "service:web/nginx",
+		PrivateIPAddress: "10.0.1.5",
+		Tags:             map[string]string{"Env": "prod"},
+	}
+	tests := []struct {
+		name   string
+		filter string
+		values []string
+		want   bool
+	}{
+		{"name exact", "tag:Name", []string{"service:web/nginx"}, true},
+		{"name star crosses slash", "tag:Name", []string{"service:web*"}, true},
+		{"name star inside", "tag:Name", []string{"*web*nginx"}, true},
+		{"name question mark", "tag:Name", []string{"service:web?nginx"}, true},
+		{"name any of", "tag:Name", []string{"api*", "*/nginx"}, true},
+		{"name prefix only", "tag:Name", []string{"service:web"}, false},
+		{"name no match", "tag:Name", []string{"*/envoy"}, false},
+		{"private ip", "private-ip-address", []string{"10.0.1.5"}, true},
+		{"tag value", "tag:Env", []string{"staging"}, false},
+		{"tag key", "tag-key", []string{"Env"}, true},
+		{"other filters ignored", "instance-state-name", []string{"stopped"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filters := []types.Filter{{Name: aws.String(tt.filter), Values: tt.values}}
+			if got := matchesFilters(inst, filters); got != tt.want {
+				t.Errorf("matchesFilters(%s=%q) = %v, want %v", tt.filter, tt.values, got, tt.want)
+			}
+		})
+	}
+}
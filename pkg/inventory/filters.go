@@ -0,0 +1,98 @@
+package inventory
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// StateFilter restricts DescribeInstances to the given instance states (running, stopped, ...).
+// Each value may itself be a comma-separated list.
+func StateFilter(states []string) types.Filter {
+	var values []string
+	for _, state := range states {
+		for _, v := range strings.Split(state, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, strings.ToLower(v))
+			}
+		}
+	}
+	return types.Filter{Name: aws.String("instance-state-name"), Values: values}
+}
+
+// SecurityGroupFilters turns security group IDs (sg-...) and names into DescribeInstances
+// filters. An instance matches if it is attached to any of the IDs and any of the names.
+func SecurityGroupFilters(groups []string) []types.Filter {
+	var ids, names []string
+	for _, group := range groups {
+		if strings.HasPrefix(group, "sg-") {
+			ids = append(ids, group)
+		} else {
+			names = append(names, group)
+		}
+	}
+	var filters []types.Filter
+	if len(ids) > 0 {
+		filters = append(filters, types.Filter{Name: aws.String("instance.group-id"), Values: ids})
+	}
+	if len(names) > 0 {
+		filters = append(filters, types.Filter{Name: aws.String("instance.group-name"), Values: names})
+	}
+	return filters
+}
+
+// ParseTagFilters turns Key=Value arguments into DescribeInstances filters. Values given
+// for the same key are OR-ed together, different keys are AND-ed, and a bare Key matches
+// any instance carrying that tag.
+func ParseTagFilters(tags []string) ([]types.Filter, error) {
+	var filters []types.Filter
+	byName := map[string]int{}
+	for _, tag := range tags {
+		key, value, hasValue := strings.Cut(tag, "=")
+		if key == "" {
+			return nil, fmt.Errorf("invalid tag filter '%s': expected Key=Value", tag)
+		}
+
+		name, values := "tag:"+key, []string{value}
+		if !hasValue {
+			name, values = "tag-key", []string{key}
+		}
+
+		if i, ok := byName[name]; ok {
+			filters[i].Values = append(filters[i].Values, values...)
+			continue
+		}
+		byName[name] = len(filters)
+		filters = append(filters, types.Filter{Name: aws.String(name), Values: values})
+	}
+	return filters, nil
+}
+
+// matchGlob reports whether s matches pattern the way EC2 matches filter values: * stands
+// for any run of characters, '/' included, and ? for any single character.
+func matchGlob(pattern, s string) bool {
+	p, r := []rune(pattern), []rune(s)
+	i, j := 0, 0
+	star, next := -1, 0 // the last * seen, and where in s it resumes matching
+	for j < len(r) {
+		switch {
+		case i < len(p) && (p[i] == '?' || p[i] == r[j]):
+			i++
+			j++
+		case i < len(p) && p[i] == '*':
+			star, next = i, j
+			i++
+		case star >= 0:
+			next++
+			i, j = star+1, next
+		default:
+			return false
+		}
+	}
+	for i < len(p) && p[i] == '*' {
+		i++
+	}
+	return i == len(p)
+}
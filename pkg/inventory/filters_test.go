@@ -0,0 +1,105 @@
+package inventory
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestParseTagFilters(t *testing.T) {
+	tests := []struct {
+		name    string
+		tags    []string
+		want    map[string][]string // filter name to values, in order
+		order   []string
+		wantErr bool
+	}{
+		{
+			name:  "key and value",
+			tags:  []string{"Env=prod"},
+			want:  map[string][]string{"tag:Env": {"prod"}},
+			order: []string{"tag:Env"},
+		},
+		{
+			name:  "same key is OR-ed",
+			tags:  []string{"Env=prod", "Role=web", "Env=staging"},
+			want:  map[string][]string{"tag:Env": {"prod", "staging"}, "tag:Role": {"web"}},
+			order: []string{"tag:Env", "tag:Role"},
+		},
+		{
+			name:  "bare key matches any value",
+			tags:  []string{"Owner", "Team"},
+			want:  map[string][]string{"tag-key": {"Owner", "Team"}},
+			order: []string{"tag-key"},
+		},
+		{
+			name:  "value may contain =",
+			tags:  []string{"Query=a=b"},
+			want:  map[string][]string{"tag:Query": {"a=b"}},
+			order: []string{"tag:Query"},
+		},
+		{
+			name:  "empty value",
+			tags:  []string{"Env="},
+			want:  map[string][]string{"tag:Env": {""}},
+			order: []string{"tag:Env"},
+		},
+		{
+			name:    "missing key",
+			tags:    []string{"=prod"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filters, err := ParseTagFilters(tt.tags)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseTagFilters(%q) = %v, want an error", tt.tags, filters)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var order []string
+			got := map[string][]string{}
+			for _, f := range filters {
+				order = append(order, aws.ToString(f.Name))
+				got[aws.ToString(f.Name)] = f.Values
+			}
+			if !reflect.DeepEqual(order, tt.order) || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseTagFilters(%q) = %v in order %v, want %v in order %v", tt.tags, got, order, tt.want, tt.order)
+			}
+		})
+	}
+}
+
+func TestStateFilter(t *testing.T) {
+	tests := []struct {
+		states []string
+		want   []string
+	}{
+		{[]string{"running"}, []string{"running"}},
+		{[]string{"running,stopped"}, []string{"running", "stopped"}},
+		{[]string{"Running", " stopped , pending"}, []string{"running", "stopped", "pending"}},
+		{[]string{"running,,"}, []string{"running"}},
+		{nil, nil},
+	}
+	for _, tt := range tests {
+		f := StateFilter(tt.states)
+		if aws.ToString(f.Name) != "instance-state-name" || !reflect.DeepEqual(f.Values, tt.want) {
+			t.Errorf("StateFilter(%q) = %s %q, want instance-state-name %q", tt.states, aws.ToString(f.Name), f.Values, tt.want)
+		}
+	}
+}
+
+func TestSecurityGroupFilters(t *testing.T) {
+	filters := SecurityGroupFilters([]string{"sg-0123", "web", "sg-4567"})
+	if len(filters) != 2 ||
+		aws.ToString(filters[0].Name) != "instance.group-id" || !reflect.DeepEqual(filters[0].Values, []string{"sg-0123", "sg-4567"}) ||
+		aws.ToString(filters[1].Name) != "instance.group-name" || !reflect.DeepEqual(filters[1].Values, []string{"web"}) {
+		t.Errorf("SecurityGroupFilters = %+v", filters)
+	}
+}
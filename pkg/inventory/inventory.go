@@ -0,0 +1,392 @@
+// Package inventory lists the targets Session Manager can reach, with the status of their
+// SSM agents: EC2 instances, servers registered through hybrid activations and ECS tasks,
+// or whatever other InstanceSource is registered.
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// Instance represents the fields we display for each EC2 instance.
+type Instance struct {
+	InstanceID       string            `json:"InstanceId"`
+	Name             string            `json:"Name"`
+	PrivateIPAddress string            `json:"PrivateIpAddress"`
+	PublicIPAddress  string            `json:"PublicIpAddress,omitempty"`
+	PrivateDNSName   string            `json:"PrivateDnsName,omitempty"`
+	Region           string            `json:"Region"`
+	Account          string            `json:"Account,omitempty"`
+	State            string            `json:"State"`
+	SSMStatus        string            `json:"SSMStatus"`
+	Platform         string            `json:"Platform"`
+	InstanceType     string            `json:"InstanceType"`
+	Lifecycle        string            `json:"Lifecycle,omitempty"`
+	AvailabilityZone string            `json:"AvailabilityZone"`
+	VpcID            string            `json:"VpcId,omitempty"`
+	SubnetID         string            `json:"SubnetId,omitempty"`
+	LaunchTime       time.Time         `json:"LaunchTime"`
+	Source           string            `json:"Source,omitempty"`
+	Health           string            `json:"Health,omitempty"`
+	AgentVersion     string            `json:"AgentVersion,omitempty"`
+	LastPing         time.Time         `json:"LastPingTime,omitzero"`
+	AgentOutdated    bool              `json:"AgentOutdated,omitempty"` // a newer agent is released; only known on Linux
+	Tags             map[string]string `json:"Tags,omitempty"`
+}
+
+// SSM reachability as shown in the SSM column. Online/ConnectionLost/Inactive come
+// straight from the SSM PingStatus; the others are ours.
+const (
+	StatusOnline        = "Online"
+	StatusNotRegistered = "Not Registered"
+	StatusUnknown       = "Unknown"
+)
+
+// The built-in sources, as shown in the SOURCE column.
+const (
+	SourceEC2    = "ec2"
+	SourceHybrid = "hybrid"
+	SourceECS    = "ecs"
+)
+
+// How an EC2 instance is purchased, as shown in the LIFECYCLE column. Besides these it
+// may be EC2's own "spot", "scheduled" or "capacity-block".
+const (
+	LifecycleOnDemand = "on-demand"
+	LifecycleReserved = "reserved" // on-demand, in a capacity reservation
+	LifecycleSpot     = "spot"
+)
+
+// Operating system families, as returned by Instance.OS.
+const (
+	OSWindows = "Windows"
+	OSLinux   = "Linux"
+	OSMacOS   = "macOS"
+)
+
+// OS returns the operating system family of the instance, derived from its platform:
+// "Windows Server 2022 Datacenter", "Windows with SQL Server Standard" and
+// WINDOWS_SERVER_2019_FULL are all Windows. It is empty when the platform is unknown,
+// e.g. for an instance given by ID alone.
+func (i Instance) OS() string {
+	platform := strings.ToLower(i.Platform)
+	switch {
+	case platform == "":
+		return ""
+	case strings.Contains(platform, "windows"):
+		return OSWindows
+	case strings.Contains(platform, "mac"):
+		return OSMacOS
+	}
+	return OSLinux
+}
+
+// IsWindows reports whether the instance is known to run Windows.
+func (i Instance) IsWindows() bool { return i.OS() == OSWindows }
+
+// DefaultConcurrency is how many regions ListAllRegions queries at once by default.
+const DefaultConcurrency = 8
+
+// ListOptions adjust List and ListAllRegions.
+type ListOptions struct {
+	// Sources names the sources to list, EC2 alone if empty.
+	Sources []string
+	// OnPage, if set, is called with the running total after each page of EC2 instances,
+	// so large accounts can show progress.
+	OnPage func(total int)
+	// OnRegion, if set, is called by ListAllRegions as each region finishes.
+	OnRegion func(done, total int)
+	// Concurrency caps how many regions ListAllRegions queries at once;
+	// DefaultConcurrency if zero.
+	Concurrency int
+	// Timeout, if set, bounds the listing of each region in ListAllRegions. A region that
+	// takes longer is skipped with a warning, like one that fails.
+	Timeout time.Duration
+	// Clients creates the API clients; the zero value uses the SDK's.
+	Clients Clients
+	// Warn, if set, receives the failures that don't fail the listing: an SSM status or
+	// hybrid listing that could not be fetched, or a region that was skipped.
+	Warn func(error)
+}
+
+func (o ListOptions) warn(err error) {
+	if o.Warn != nil {
+		o.Warn(err)
+	}
+}
+
+// List lists the targets of every source in opts.Sources in cfg's region. Sources that
+// fail are passed to opts.Warn and skipped, unless every one of them fails.
+func List(ctx context.Context, cfg aws.Config, filters []types.Filter, opts ListOptions) ([]Instance, error) {
+	sources, err := lookupSources(opts.Sources)
+	if err != nil {
+		return nil, err
+	}
+	if len(sources) == 1 {
+		return sources[0].List(ctx, cfg, filters, opts)
+	}
+
+	var instances []Instance
+	var errs []error
+	for _, source := range sources {
+		found, err := source.List(ctx, cfg, filters, opts)
+		if err != nil {
+			opts.warn(fmt.Errorf("could not list %s targets in %s: %w", source.Name(), cfg.Region, err))
+			errs = append(errs, err)
+			continue
+		}
+		instances = append(instances, found...)
+	}
+	if len(errs) == len(sources) {
+		return nil, errs[0]
+	}
+	return instances, nil
+}
+
+// Agent describes the SSM agent of a managed instance.
+type Agent struct {
+	PingStatus string
+	Version    string
+	LastPing   time.Time
+	Outdated   bool
+}
+
+// newAgent extracts the agent fields of a DescribeInstanceInformation entry.
+func newAgent(info ssmtypes.InstanceInformation) Agent {
+	return Agent{
+		PingStatus: string(info.PingStatus),
+		Version:    aws.ToString(info.AgentVersion),
+		LastPing:   aws.ToTime(info.LastPingDateTime),
+		// IsLatestVersion says nothing about Windows instances.
+		Outdated: info.IsLatestVersion != nil && !*info.IsLatestVersion && info.PlatformType != ssmtypes.PlatformTypeWindows,
+	}
+}
+
+// apply copies the agent fields to inst.
+func (a Agent) apply(inst *Instance) {
+	inst.SSMStatus = a.PingStatus
+	inst.AgentVersion, inst.LastPing, inst.AgentOutdated = a.Version, a.LastPing, a.Outdated
+}
+
+// Agents returns the SSM agent of every managed instance in the client's region, keyed by
+// instance ID.
+func Agents(ctx context.Context, client SSMAPI) (map[string]Agent, error) {
+	agents := map[string]Agent{}
+	paginator := ssm.NewDescribeInstanceInformationPaginator(client, &ssm.DescribeInstanceInformationInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, info := range page.InstanceInformationList {
+			agents[aws.ToString(info.InstanceId)] = newAgent(info)
+		}
+	}
+	return agents, nil
+}
+
+// FilterOnline keeps only the instances whose SSM agent is online.
+func FilterOnline(instances []Instance) []Instance {
+	var online []Instance
+	for _, inst := range instances {
+		if inst.SSMStatus == StatusOnline {
+			online = append(online, inst)
+		}
+	}
+	return online
+}
+
+// ListEC2 pages through DescribeInstances in region and flattens the reservations into a
+// single slice. Filters are applied server-side. onPage, if set, is called with the running
+// total after each page.
+func ListEC2(ctx context.Context, client EC2API, region string, filters []types.Filter, onPage func(total int)) ([]Instance, error) {
+	paginator := ec2.NewDescribeInstancesPaginator(client, &ec2.DescribeInstancesInput{
+		Filters:    filters,
+		MaxResults: aws.Int32(1000),
+	})
+
+	var instances []Instance
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, reservation := range page.Reservations {
+			for _, inst := range reservation.Instances {
+				instance := Instance{
+					InstanceID:       aws.ToString(inst.InstanceId),
+					PrivateIPAddress: aws.ToString(inst.PrivateIpAddress),
+					PublicIPAddress:  aws.ToString(inst.PublicIpAddress),
+					PrivateDNSName:   aws.ToString(inst.PrivateDnsName),
+					Region:           region,
+					Platform:         aws.ToString(inst.PlatformDetails),
+					LaunchTime:       aws.ToTime(inst.LaunchTime),
+					InstanceType:     string(inst.InstanceType),
+					VpcID:            aws.ToString(inst.VpcId),
+					SubnetID:         aws.ToString(inst.SubnetId),
+					Source:           SourceEC2,
+				}
+				switch {
+				case inst.InstanceLifecycle != "":
+					instance.Lifecycle = string(inst.InstanceLifecycle)
+				case inst.CapacityReservationId != nil:
+					instance.Lifecycle = LifecycleReserved
+				default:
+					instance.Lifecycle = LifecycleOnDemand
+				}
+				if instance.Platform == "" {
+					// Only set for Windows, but present where PlatformDetails may not be.
+					instance.Platform = string(inst.Platform)
+				}
+				if inst.State != nil {
+					instance.State = string(inst.State.Name)
+				}
+				if inst.Placement != nil {
+					instance.AvailabilityZone = aws.ToString(inst.Placement.AvailabilityZone)
+				}
+				for _, tag := range inst.Tags {
+					if instance.Tags == nil {
+						instance.Tags = map[string]string{}
+					}
+					instance.Tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+				}
+				instance.Name = instance.Tags["Name"]
+				instances = append(instances, instance)
+			}
+		}
+
+		if onPage != nil {
+			onPage(len(instances))
+		}
+	}
+	return instances, nil
+}
+
+// ListAllRegions queries every region enabled for the account, opts.Concurrency at a time,
+// and merges the results. Regions that fail (e.g. blocked by an SCP) or exceed
+// opts.Timeout are passed to opts.Warn and skipped; only if every region fails does the
+// listing fail. opts.OnPage is not used.
+func ListAllRegions(ctx context.Context, cfg aws.Config, filters []types.Filter, opts ListOptions) ([]Instance, error) {
+	regionsOutput, err := opts.Clients.ec2(cfg).DescribeRegions(ctx, &ec2.DescribeRegionsInput{})
+	if err != nil {
+		return nil, err
+	}
+
+	type regionResult struct {
+		region    string
+		instances []Instance
+		err       error
+	}
+
+	regionOpts := opts
+	regionOpts.OnPage = nil
+	concurrency := opts.Concurrency
+	if concurrency < 1 {
+		concurrency = DefaultConcurrency
+	}
+	results := make([]regionResult, len(regionsOutput.Regions))
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	slots := make(chan struct{}, concurrency)
+	done := 0
+	for i, r := range regionsOutput.Regions {
+		wg.Add(1)
+		go func(i int, region string) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			regionCfg := cfg.Copy()
+			regionCfg.Region = region
+			instances, err := listWithTimeout(ctx, regionCfg, filters, regionOpts)
+			results[i] = regionResult{region: region, instances: instances, err: err}
+
+			mu.Lock()
+			done++
+			if opts.OnRegion != nil {
+				opts.OnRegion(done, len(results))
+			}
+			mu.Unlock()
+		}(i, aws.ToString(r.RegionName))
+	}
+	wg.Wait()
+
+	// Merge in the order DescribeRegions returned, so the listing is stable between runs.
+	var instances []Instance
+	failed := 0
+	for _, result := range results {
+		if result.err != nil {
+			opts.warn(fmt.Errorf("skipping region %s: %w", result.region, result.err))
+			failed++
+			continue
+		}
+		instances = append(instances, result.instances...)
+	}
+	if failed == len(results) && failed > 0 {
+		return nil, fmt.Errorf("failed to describe instances in all %d regions", failed)
+	}
+	return instances, nil
+}
+
+// listWithTimeout calls List, giving up after opts.Timeout if it is set.
+func listWithTimeout(ctx context.Context, cfg aws.Config, filters []types.Filter, opts ListOptions) ([]Instance, error) {
+	if opts.Timeout <= 0 {
+		return List(ctx, cfg, filters, opts)
+	}
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+	instances, err := List(ctx, cfg, filters, opts)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, fmt.Errorf("timed out after %s", opts.Timeout)
+	}
+	return instances, err
+}
+
+// SortKeys are the orders Sort accepts.
+var SortKeys = []string{"name", "launch-time", "ip", "id"}
+
+// Sort sorts instances in place by one of SortKeys, falling back to the instance ID for
+// ties so the order is stable between runs. Launch time sorts newest first.
+func Sort(instances []Instance, key string) {
+	sort.SliceStable(instances, func(i, j int) bool {
+		a, b := instances[i], instances[j]
+		switch key {
+		case "name":
+			if a.Name != b.Name {
+				// Unnamed instances go last.
+				if a.Name == "" || b.Name == "" {
+					return b.Name == ""
+				}
+				return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+			}
+		case "launch-time":
+			if !a.LaunchTime.Equal(b.LaunchTime) {
+				return a.LaunchTime.After(b.LaunchTime)
+			}
+		case "ip":
+			ipA, errA := netip.ParseAddr(a.PrivateIPAddress)
+			ipB, errB := netip.ParseAddr(b.PrivateIPAddress)
+			if errA != nil || errB != nil {
+				if (errA == nil) != (errB == nil) {
+					return errA == nil
+				}
+			} else if ipA != ipB {
+				return ipA.Less(ipB)
+			}
+		}
+		return a.InstanceID < b.InstanceID
+	})
+}
@@ -0,0 +1,60 @@
+package inventory
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSort(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2026, 10, d, 0, 0, 0, 0, time.UTC) }
+	instances := []Instance{
+		{InstanceID: "i-3", Name: "web-2", PrivateIPAddress: "10.0.0.10", LaunchTime: day(1)},
+		{InstanceID: "i-1", Name: "", PrivateIPAddress: "", LaunchTime: day(3)},
+		{InstanceID: "i-4", Name: "API", PrivateIPAddress: "10.0.0.9", LaunchTime: day(2)},
+		{InstanceID: "i-2", Name: "web-2", PrivateIPAddress: "10.0.0.100", LaunchTime: day(2)},
+	}
+	tests := []struct {
+		key  string
+		want []string
+	}{
+		// Unnamed last, case-insensitive, ID breaks ties.
+		{"name", []string{"i-4", "i-2", "i-3", "i-1"}},
+		// Newest first.
+		{"launch-time", []string{"i-1", "i-2", "i-4", "i-3"}},
+		// Numerically, not as strings; no address last.
+		{"ip", []string{"i-4", "i-3", "i-2", "i-1"}},
+		{"id", []string{"i-1", "i-2", "i-3", "i-4"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			sorted := append([]Instance(nil), instances...)
+			Sort(sorted, tt.key)
+			var got []string
+			for _, inst := range sorted {
+				got = append(got, inst.InstanceID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Sort(%s) = %v, want %v", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInstanceOS(t *testing.T) {
+	tests := []struct {
+		platform string
+		want     string
+	}{
+		{"Windows Server 2022 Datacenter", OSWindows},
+		{"WINDOWS_SERVER_2019_FULL", OSWindows},
+		{"Linux/UNIX", OSLinux},
+		{"macOS", OSMacOS},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := (Instance{Platform: tt.platform}).OS(); got != tt.want {
+			t.Errorf("OS of %q = %q, want %q", tt.platform, got, tt.want)
+		}
+	}
+}
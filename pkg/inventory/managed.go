@@ -0,0 +1,88 @@
+package inventory
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// IsManagedInstanceID reports whether id belongs to a server registered through an SSM
+// hybrid activation rather than to an EC2 instance.
+func IsManagedInstanceID(id string) bool {
+	return strings.HasPrefix(id, "mi-")
+}
+
+// ListManaged lists the on-premises servers and VMs registered with SSM through hybrid
+// activations (mi- IDs) in region. The DescribeInstances filters are mapped onto them:
+// instance IDs and tags server-side, the Name, private IP and Windows filters here. They
+// have no EC2 state, so state filters don't apply, and no VPC, so VPC, subnet and security
+// group filters leave none of them.
+func ListManaged(ctx context.Context, client SSMAPI, region string, filters []types.Filter) ([]Instance, error) {
+	ssmFilters := []ssmtypes.InstanceInformationStringFilter{
+		{Key: aws.String("ResourceType"), Values: []string{string(ssmtypes.ResourceTypeManagedInstance)}},
+	}
+	var names, ips []string
+	for _, filter := range filters {
+		switch name := aws.ToString(filter.Name); {
+		case name == "tag:Name":
+			names = filter.Values
+		case name == "private-ip-address":
+			ips = filter.Values
+		case name == "instance-id":
+			// EC2 instance IDs never name a managed instance.
+			ids := slices.DeleteFunc(slices.Clone(filter.Values), func(id string) bool { return !IsManagedInstanceID(id) })
+			if len(ids) == 0 {
+				return nil, nil
+			}
+			ssmFilters = append(ssmFilters, ssmtypes.InstanceInformationStringFilter{
+				Key: aws.String("InstanceIds"), Values: ids})
+		case name == "vpc-id" || name == "subnet-id" || strings.HasPrefix(name, "instance.group-"):
+			return nil, nil
+		case name == "platform":
+			ssmFilters = append(ssmFilters, ssmtypes.InstanceInformationStringFilter{
+				Key: aws.String("PlatformTypes"), Values: []string{string(ssmtypes.PlatformTypeWindows)}})
+		case name == "tag-key" || strings.HasPrefix(name, "tag:"):
+			ssmFilters = append(ssmFilters, ssmtypes.InstanceInformationStringFilter{
+				Key: filter.Name, Values: filter.Values})
+		}
+	}
+
+	var instances []Instance
+	paginator := ssm.NewDescribeInstanceInformationPaginator(client, &ssm.DescribeInstanceInformationInput{Filters: ssmFilters})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, info := range page.InstanceInformationList {
+			inst := Instance{
+				InstanceID:       aws.ToString(info.InstanceId),
+				Name:             aws.ToString(info.Name),
+				PrivateIPAddress: aws.ToString(info.IPAddress),
+				Region:           region,
+				Platform:         strings.TrimSpace(aws.ToString(info.PlatformName) + " " + aws.ToString(info.PlatformVersion)),
+				LaunchTime:       aws.ToTime(info.RegistrationDate),
+				Source:           SourceHybrid,
+			}
+			newAgent(info).apply(&inst)
+			if inst.Name == "" {
+				inst.Name = aws.ToString(info.ComputerName)
+			}
+			if len(names) > 0 && !slices.ContainsFunc(names, func(pattern string) bool {
+				return matchGlob(pattern, inst.Name)
+			}) {
+				continue
+			}
+			if len(ips) > 0 && !slices.Contains(ips, inst.PrivateIPAddress) {
+				continue
+			}
+			instances = append(instances, inst)
+		}
+	}
+	return instances, nil
+}
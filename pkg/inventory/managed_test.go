@@ -0,0 +1,72 @@
+package inventory
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// fakeSSM answers DescribeInstanceInformation with the managed instances whose ID an
+// InstanceIds filter names, or all of them, and records the requests.
+type fakeSSM struct {
+	ids    []string
+	inputs []*ssm.DescribeInstanceInformationInput
+}
+
+func (f *fakeSSM) DescribeInstanceInformation(ctx context.Context, params *ssm.DescribeInstanceInformationInput, optFns ...func(*ssm.Options)) (*ssm.DescribeInstanceInformationOutput, error) {
+	f.inputs = append(f.inputs, params)
+	want := f.ids
+	for _, filter := range params.Filters {
+		if aws.ToString(filter.Key) == "InstanceIds" {
+			want = filter.Values
+		}
+	}
+	output := &ssm.DescribeInstanceInformationOutput{}
+	for _, id := range f.ids {
+		for _, w := range want {
+			if id == w {
+				output.InstanceInformationList = append(output.InstanceInformationList,
+					ssmtypes.InstanceInformation{InstanceId: aws.String(id), PingStatus: ssmtypes.PingStatusOnline})
+			}
+		}
+	}
+	return output, nil
+}
+
+func TestListManagedInstanceIDFilter(t *testing.T) {
+	tests := []struct {
+		name     string
+		ids      []string
+		want     []string
+		wantCall bool
+	}{
+		{"managed ID", []string{"mi-0aaa"}, []string{"mi-0aaa"}, true},
+		{"EC2 IDs are left out", []string{"i-0bbb", "mi-0ccc"}, []string{"mi-0ccc"}, true},
+		{"only EC2 IDs", []string{"i-0bbb"}, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeSSM{ids: []string{"mi-0aaa", "mi-0ccc", "mi-0ddd"}}
+			filters := []types.Filter{{Name: aws.String("instance-id"), Values: tt.ids}}
+			instances, err := ListManaged(context.Background(), client, "us-east-1", filters)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, inst := range instances {
+				got = append(got, inst.InstanceID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ListManaged = %v, want %v", got, tt.want)
+			}
+			if called := len(client.inputs) > 0; called != tt.wantCall {
+				t.Errorf("DescribeInstanceInformation called: %v, want %v", called, tt.wantCall)
+			}
+		})
+	}
+}
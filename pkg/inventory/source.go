@@ -0,0 +1,115 @@
+package inventory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// InstanceSource lists one kind of Session Manager target. A new kind of target is added
+// by implementing it and calling Register, usually from an init function.
+type InstanceSource interface {
+	// Name identifies the source in ListOptions.Sources and in Instance.Source.
+	Name() string
+	// List lists the source's targets in cfg's region. Filters are DescribeInstances
+	// filters; a source applies the ones that make sense for it, and returns nothing for
+	// filters it can't satisfy (e.g. a VPC for servers outside AWS).
+	List(ctx context.Context, cfg aws.Config, filters []types.Filter, opts ListOptions) ([]Instance, error)
+}
+
+// sources are the registered sources, in registration order.
+var sources []InstanceSource
+
+// Register makes source available under its name. It panics if the name is taken.
+func Register(source InstanceSource) {
+	if Lookup(source.Name()) != nil {
+		panic("inventory: source " + source.Name() + " registered twice")
+	}
+	sources = append(sources, source)
+}
+
+// Lookup returns the source registered under name, or nil.
+func Lookup(name string) InstanceSource {
+	for _, source := range sources {
+		if source.Name() == name {
+			return source
+		}
+	}
+	return nil
+}
+
+// SourceNames returns the names of the registered sources.
+func SourceNames() []string {
+	names := make([]string, len(sources))
+	for i, source := range sources {
+		names[i] = source.Name()
+	}
+	return names
+}
+
+// lookupSources resolves names, defaulting to EC2 alone.
+func lookupSources(names []string) ([]InstanceSource, error) {
+	if len(names) == 0 {
+		names = []string{SourceEC2}
+	}
+	var resolved []InstanceSource
+	for _, name := range names {
+		source := Lookup(name)
+		if source == nil {
+			return nil, fmt.Errorf("unknown instance source '%s'; available: %s", name, strings.Join(SourceNames(), ", "))
+		}
+		if !slices.Contains(resolved, source) {
+			resolved = append(resolved, source)
+		}
+	}
+	return resolved, nil
+}
+
+// ec2Source lists EC2 instances with the status of their SSM agents. If SSM can't be
+// queried, the listing still succeeds with an "Unknown" status so the user can try to
+// connect anyway.
+type ec2Source struct{}
+
+func (ec2Source) Name() string { return SourceEC2 }
+
+func (ec2Source) List(ctx context.Context, cfg aws.Config, filters []types.Filter, opts ListOptions) ([]Instance, error) {
+	instances, err := ListEC2(ctx, opts.Clients.ec2(cfg), cfg.Region, filters, opts.OnPage)
+	if err != nil || len(instances) == 0 {
+		return instances, err
+	}
+
+	agents, err := Agents(ctx, opts.Clients.ssm(cfg))
+	if err != nil {
+		opts.warn(fmt.Errorf("could not query SSM agent status in %s: %w", cfg.Region, err))
+	}
+	for i := range instances {
+		switch agent, ok := agents[instances[i].InstanceID]; {
+		case err != nil:
+			instances[i].SSMStatus = StatusUnknown
+		case ok:
+			agent.apply(&instances[i])
+		default:
+			instances[i].SSMStatus = StatusNotRegistered
+		}
+	}
+	return instances, nil
+}
+
+// hybridSource lists the servers registered through SSM hybrid activations.
+type hybridSource struct{}
+
+func (hybridSource) Name() string { return SourceHybrid }
+
+func (hybridSource) List(ctx context.Context, cfg aws.Config, filters []types.Filter, opts ListOptions) ([]Instance, error) {
+	return ListManaged(ctx, opts.Clients.ssm(cfg), cfg.Region, filters)
+}
+
+func init() {
+	Register(ec2Source{})
+	Register(hybridSource{})
+	Register(ecsSource{})
+}
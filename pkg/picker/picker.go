@@ -0,0 +1,177 @@
+// Package picker implements the terminal prompts used to choose instances and other
+// options: a type-to-filter fuzzy finder, numbered menus and yes/no questions.
+package picker
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/manifoldco/promptui"
+	"golang.org/x/term"
+)
+
+// FuzzySize is the number of rows the fuzzy finder shows at once.
+const FuzzySize = 15
+
+// ErrQuit is returned by the pickers when the user chooses to quit.
+var ErrQuit = errors.New("quit signal")
+
+// Fuzzy runs the type-to-filter picker over rows and returns the chosen index. Typing
+// filters with FuzzyMatch, arrow keys move, Enter picks and Ctrl+C quits (ErrQuit).
+func Fuzzy(label string, rows []string) (int, error) {
+	prompt := promptui.Select{
+		Label: label,
+		Items: rows,
+		Size:  FuzzySize,
+		Templates: &promptui.SelectTemplates{
+			Label:    "{{ . }}",
+			Active:   "▸ {{ . | cyan }}",
+			Inactive: "  {{ . }}",
+			Selected: "✔ {{ . | green }}",
+		},
+		Searcher: func(input string, index int) bool {
+			return FuzzyMatch(input, rows[index])
+		},
+		StartInSearchMode: true,
+		HideHelp:          true,
+	}
+
+	index, _, err := prompt.Run()
+	if err != nil {
+		if err == promptui.ErrInterrupt || err == promptui.ErrEOF {
+			return 0, ErrQuit
+		}
+		return 0, fmt.Errorf("picker failed: %w", err)
+	}
+	return index, nil
+}
+
+// Stdin is standard input, buffered for the line prompts. They all read through it: a
+// reader of their own would buffer, and lose, the lines typed ahead or piped in for the
+// prompts that follow.
+var Stdin = bufio.NewReader(os.Stdin)
+
+// Plain makes Choose use the numbered menu even in a terminal, as its prompt is read line
+// by line and works with screen readers.
+var Plain bool
+
+// Choose lets the user choose one of rows, with the fuzzy finder in a terminal and a
+// numbered menu otherwise (or when numbered or Plain is set). It returns the chosen index.
+func Choose(title string, rows []string, numbered bool) (int, error) {
+	if !numbered && !Plain && term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Println()
+		return Fuzzy(title+" (type to filter, Ctrl+C to quit)", rows)
+	}
+
+	fmt.Printf("\n%s:\n", title)
+	for i, row := range rows {
+		fmt.Printf("%4d) %s\n", i+1, row)
+	}
+	fmt.Print("Enter the option number (or 'q' to quit): ")
+
+	input, err := Stdin.ReadString('\n')
+	if err != nil {
+		return 0, fmt.Errorf("failed to read input: %w", err)
+	}
+	trimmedInput := strings.ToLower(strings.TrimSpace(input))
+	if trimmedInput == "q" {
+		return 0, ErrQuit
+	}
+	selectedNum, err := strconv.Atoi(trimmedInput)
+	if err != nil {
+		return 0, fmt.Errorf("invalid input: '%s' is not a valid number or 'q'", trimmedInput)
+	}
+	if selectedNum < 1 || selectedNum > len(rows) {
+		return 0, fmt.Errorf("invalid option number: %d. Must be between 1 and %d", selectedNum, len(rows))
+	}
+	return selectedNum - 1, nil
+}
+
+// Confirm asks a yes/no question on the terminal; an empty answer returns def.
+func Confirm(question string, def bool) bool {
+	choices := "[y/N]"
+	if def {
+		choices = "[Y/n]"
+	}
+	fmt.Printf("%s %s ", question, choices)
+
+	input, err := Stdin.ReadString('\n')
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(strings.TrimSpace(input)) {
+	case "":
+		return def
+	case "y", "yes":
+		return true
+	}
+	return false
+}
+
+// FuzzyMatch reports whether every non-space character of pattern appears in text in order,
+// case-insensitively (so "wp1" matches "web-prod-1").
+func FuzzyMatch(pattern, text string) bool {
+	text = strings.ToLower(text)
+	pos := 0
+	for _, r := range strings.ToLower(pattern) {
+		if unicode.IsSpace(r) {
+			continue
+		}
+		i := strings.IndexRune(text[pos:], r)
+		if i < 0 {
+			return false
+		}
+		pos += i + len(string(r))
+	}
+	return true
+}
+
+// ParseSelection turns "1,3,5-9" (1-based, inclusive ranges) or "all" into 0-based indexes
+// of a list of count options, without duplicates and in the order given.
+func ParseSelection(input string, count int) ([]int, error) {
+	if input == "all" || input == "*" {
+		indexes := make([]int, count)
+		for i := range indexes {
+			indexes[i] = i
+		}
+		return indexes, nil
+	}
+
+	var indexes []int
+	seen := map[int]bool{}
+	for _, part := range strings.Split(input, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		first, last := part, part
+		if a, b, ok := strings.Cut(part, "-"); ok {
+			first, last = strings.TrimSpace(a), strings.TrimSpace(b)
+		}
+		start, err1 := strconv.Atoi(first)
+		end, err2 := strconv.Atoi(last)
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("invalid input: '%s' is not a number or range", part)
+		}
+		if start < 1 || end > count || start > end {
+			return nil, fmt.Errorf("invalid option range: %s. Must be between 1 and %d", part, count)
+		}
+
+		for n := start; n <= end; n++ {
+			if !seen[n] {
+				seen[n] = true
+				indexes = append(indexes, n-1)
+			}
+		}
+	}
+	if len(indexes) == 0 {
+		return nil, fmt.Errorf("no options selected")
+	}
+	return indexes, nil
+}
@@ -0,0 +1,84 @@
+package picker
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseSelection(t *testing.T) {
+	tests := []struct {
+		input   string
+		count   int
+		want    []int
+		wantErr bool
+	}{
+		{input: "1", count: 3, want: []int{0}},
+		{input: "3,1", count: 3, want: []int{2, 0}},
+		{input: "2-4", count: 5, want: []int{1, 2, 3}},
+		{input: "1, 3 - 4 ,", count: 5, want: []int{0, 2, 3}},
+		{input: "1-3,2", count: 5, want: []int{0, 1, 2}},
+		{input: "all", count: 3, want: []int{0, 1, 2}},
+		{input: "*", count: 2, want: []int{0, 1}},
+		{input: "0", count: 3, wantErr: true},
+		{input: "4", count: 3, wantErr: true},
+		{input: "3-1", count: 3, wantErr: true},
+		{input: "a", count: 3, wantErr: true},
+		{input: "1-x", count: 3, wantErr: true},
+		{input: " , ", count: 3, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseSelection(tt.input, tt.count)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseSelection(%q, %d) = %v, want an error", tt.input, tt.count, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseSelection(%q, %d) = %v, %v, want %v", tt.input, tt.count, got, err, tt.want)
+		}
+	}
+}
+
+func TestFuzzyMatch(t *testing.T) {
+	tests := []struct {
+		pattern, text string
+		want          bool
+	}{
+		{"wp1", "web-prod-1", true},
+		{"WEB", "web-prod-1", true},
+		{"web prod", "web-prod-1", true},
+		{"", "anything", true},
+		{"1pw", "web-prod-1", false},
+		{"db", "web-prod-1", false},
+		{"i-0a", "i-0abc  web-1  running", true},
+		{"ü", "müller", true},
+	}
+	for _, tt := range tests {
+		if got := FuzzyMatch(tt.pattern, tt.text); got != tt.want {
+			t.Errorf("FuzzyMatch(%q, %q) = %v, want %v", tt.pattern, tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestPromptsShareStdin(t *testing.T) {
+	saved := Stdin
+	t.Cleanup(func() { Stdin = saved })
+	// Answers typed ahead reach the prompts they were meant for.
+	Stdin = bufio.NewReader(strings.NewReader("yes\n\n2\nn\n"))
+
+	if !Confirm("First?", false) {
+		t.Error("first Confirm = false, want true")
+	}
+	if !Confirm("Second?", true) {
+		t.Error("second Confirm = false, want the default, true")
+	}
+	if index, err := Choose("Pick", []string{"a", "b", "c"}, true); err != nil || index != 1 {
+		t.Errorf("Choose = %d, %v, want 1", index, err)
+	}
+	if Confirm("Last?", true) {
+		t.Error("last Confirm = true, want false")
+	}
+}
@@ -0,0 +1,680 @@
+// Package session opens Session Manager sessions: it speaks the data channel protocol
+// natively for shells and SSH proxying, and prepares the arguments session-manager-plugin
+// expects for everything else.
+package session
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/gorilla/websocket"
+	"golang.org/x/term"
+)
+
+// The Session Manager data channel protocol, spoken natively so that shells and SSH proxy
+// sessions work without session-manager-plugin. Port forwarding to a local listener still
+// needs the plugin, which multiplexes TCP connections over the channel.
+
+// Logf, if set, receives a trace of the data channel: the stream URL dialled and every
+// message received.
+var Logf func(format string, args ...any)
+
+func logf(format string, args ...any) {
+	if Logf != nil {
+		Logf(format, args...)
+	}
+}
+
+// Proxy, if set, chooses the proxy the data channel connects through. If nil, HTTPS_PROXY
+// and NO_PROXY from the environment decide.
+var Proxy func(*http.Request) (*url.URL, error)
+
+// ErrInterrupted is returned by RunNative when a termination signal ended the session.
+var ErrInterrupted = errors.New("session interrupted")
+
+// ErrDataChannel is wrapped by the errors of RunNative that mean the data channel could not
+// be reached, as when outbound HTTPS to ssmmessages is blocked.
+var ErrDataChannel = errors.New("connecting to the session data channel")
+
+// KeyError is returned by RunNative when the KMS data key for an encrypted session could
+// not be generated.
+type KeyError struct {
+	KeyID string
+	Err   error
+}
+
+func (e *KeyError) Error() string { return "generating the session data key: " + e.Err.Error() }
+func (e *KeyError) Unwrap() error { return e.Err }
+
+// nativeClientVersion is the plugin version reported to the agent; the protocol features
+// used here (handshake, KMS encryption) are the ones that version supports.
+const nativeClientVersion = "1.2.0.0"
+
+// Data channel message types.
+const (
+	msgInputStreamData  = "input_stream_data"
+	msgOutputStreamData = "output_stream_data"
+	msgAcknowledge      = "acknowledge"
+	msgChannelClosed    = "channel_closed"
+)
+
+// Payload types of stream data messages.
+const (
+	payloadOutput               = 1
+	payloadSize                 = 3
+	payloadHandshakeRequest     = 5
+	payloadHandshakeResponse    = 6
+	payloadHandshakeComplete    = 7
+	payloadEncChallengeRequest  = 8
+	payloadEncChallengeResponse = 9
+	payloadStdErr               = 11
+)
+
+// Handshake actions the agent can request, and how the client reports on them.
+const (
+	actionSessionType       = "SessionType"
+	actionKMSEncryption     = "KMSEncryption"
+	actionStatusSuccess     = 1
+	actionStatusFailed      = 2
+	actionStatusUnsupported = 3
+)
+
+const (
+	// clientMessageHeaderLength is the size of the fixed header, up to the payload length.
+	clientMessageHeaderLength = 116
+	// clientMessageAckFlags marks acknowledgements, as the plugin sends them.
+	clientMessageAckFlags = 3
+
+	resendTimeout      = 3 * time.Second
+	pingInterval       = 5 * time.Minute
+	resizePollInterval = 500 * time.Millisecond
+)
+
+// clientMessage is a binary data channel frame. All integers are big endian; the message
+// type is space padded to 32 bytes and the message ID is stored low half first.
+type clientMessage struct {
+	MessageType    string
+	SchemaVersion  uint32
+	CreatedDate    uint64
+	SequenceNumber int64
+	Flags          uint64
+	MessageID      [16]byte
+	PayloadType    uint32
+	Payload        []byte
+}
+
+// acknowledgeContent is the payload of an acknowledge message.
+type acknowledgeContent struct {
+	AcknowledgedMessageType           string
+	AcknowledgedMessageId             string
+	AcknowledgedMessageSequenceNumber int64
+	IsSequentialMessage               bool
+}
+
+// processedClientAction reports the outcome of one action of a handshake request.
+type processedClientAction struct {
+	ActionType   string
+	ActionStatus int
+	ActionResult json.RawMessage
+	Error        string
+}
+
+func (m *clientMessage) marshal() []byte {
+	buf := make([]byte, clientMessageHeaderLength+4+len(m.Payload))
+	binary.BigEndian.PutUint32(buf[0:], clientMessageHeaderLength)
+	copy(buf[4:36], m.MessageType+strings.Repeat(" ", 32-len(m.MessageType)))
+	binary.BigEndian.PutUint32(buf[36:], m.SchemaVersion)
+	binary.BigEndian.PutUint64(buf[40:], m.CreatedDate)
+	binary.BigEndian.PutUint64(buf[48:], uint64(m.SequenceNumber))
+	binary.BigEndian.PutUint64(buf[56:], m.Flags)
+	copy(buf[64:72], m.MessageID[8:])
+	copy(buf[72:80], m.MessageID[:8])
+	digest := sha256.Sum256(m.Payload)
+	copy(buf[80:112], digest[:])
+	binary.BigEndian.PutUint32(buf[112:], m.PayloadType)
+	binary.BigEndian.PutUint32(buf[116:], uint32(len(m.Payload)))
+	copy(buf[120:], m.Payload)
+	return buf
+}
+
+func unmarshalClientMessage(data []byte) (*clientMessage, error) {
+	if len(data) < clientMessageHeaderLength+4 {
+		return nil, fmt.Errorf("malformed data channel message: %d bytes", len(data))
+	}
+	headerLength := int(binary.BigEndian.Uint32(data[0:]))
+	if headerLength < clientMessageHeaderLength || headerLength+4 > len(data) {
+		return nil, fmt.Errorf("malformed data channel message: header length %d", headerLength)
+	}
+	payloadLength := int(binary.BigEndian.Uint32(data[headerLength:]))
+	start := headerLength + 4
+	if payloadLength > len(data)-start {
+		return nil, fmt.Errorf("malformed data channel message: payload length %d", payloadLength)
+	}
+
+	msg := &clientMessage{
+		MessageType:    strings.TrimRight(string(data[4:36]), " \x00"),
+		SchemaVersion:  binary.BigEndian.Uint32(data[36:]),
+		CreatedDate:    binary.BigEndian.Uint64(data[40:]),
+		SequenceNumber: int64(binary.BigEndian.Uint64(data[48:])),
+		Flags:          binary.BigEndian.Uint64(data[56:]),
+		PayloadType:    binary.BigEndian.Uint32(data[112:]),
+		Payload:        data[start : start+payloadLength],
+	}
+	copy(msg.MessageID[8:], data[64:72])
+	copy(msg.MessageID[:8], data[72:80])
+	return msg, nil
+}
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() [16]byte {
+	var id [16]byte
+	rand.Read(id[:])
+	id[6] = id[6]&0x0f | 0x40
+	id[8] = id[8]&0x3f | 0x80
+	return id
+}
+
+func formatUUID(id [16]byte) string {
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:16])
+}
+
+// pendingMessage is a sent stream message the agent has not acknowledged yet.
+type pendingMessage struct {
+	data   []byte
+	sentAt time.Time
+}
+
+// dataChannel is an open data channel of one session.
+type dataChannel struct {
+	ctx       context.Context
+	cfg       aws.Config
+	conn      *websocket.Conn
+	sessionID string
+	target    string
+	stdout    io.Writer
+	stderr    io.Writer
+
+	writeMu sync.Mutex
+
+	// mu guards the outgoing stream and the encryption keys.
+	mu      sync.Mutex
+	nextSeq int64
+	unacked map[int64]*pendingMessage
+	encrypt cipher.AEAD
+	decrypt cipher.AEAD
+
+	// Incoming stream state, only used by the read loop.
+	expectedSeq int64
+	received    map[int64]*clientMessage
+
+	// ready is closed once the agent accepts input: after the handshake, or at the first
+	// output of agents too old to send one.
+	ready     chan struct{}
+	readyOnce sync.Once
+}
+
+// RunNative connects to the stream URL of a started session and relays it to the terminal
+// (raw mode, with size updates) or, for SSH proxying and broadcasting, to stdin and stdout
+// as is. The remote stderr and the agent's messages go to stderr. It returns when the
+// agent closes the channel, and ErrInterrupted if a termination signal arrived first.
+func RunNative(ctx context.Context, cfg aws.Config, output *ssm.StartSessionOutput, target string, stdin io.Reader, stdout, stderr io.Writer, terminal bool) error {
+	// A signal ends the session cleanly: the terminal is restored and the session closed.
+	parent := ctx
+	ctx, stopSignals := signal.NotifyContext(ctx, terminationSignals...)
+	defer stopSignals()
+
+	logf("dial %s", aws.ToString(output.StreamUrl))
+	dialer := *websocket.DefaultDialer
+	if Proxy != nil {
+		dialer.Proxy = Proxy
+	}
+	conn, _, err := dialer.DialContext(ctx, aws.ToString(output.StreamUrl), nil)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrDataChannel, err)
+	}
+	defer conn.Close()
+
+	dc := &dataChannel{
+		ctx:       ctx,
+		cfg:       cfg,
+		conn:      conn,
+		sessionID: aws.ToString(output.SessionId),
+		target:    target,
+		stdout:    stdout,
+		stderr:    stderr,
+		unacked:   make(map[int64]*pendingMessage),
+		received:  make(map[int64]*clientMessage),
+		ready:     make(chan struct{}),
+	}
+
+	err = conn.WriteJSON(map[string]string{
+		"MessageSchemaVersion": "1.0",
+		"RequestId":            formatUUID(newUUID()),
+		"TokenValue":           aws.ToString(output.TokenValue),
+		"ClientId":             formatUUID(newUUID()),
+		"ClientVersion":        nativeClientVersion,
+	})
+	if err != nil {
+		return fmt.Errorf("opening the session data channel: %w", err)
+	}
+
+	if terminal {
+		fd := int(os.Stdin.Fd())
+		if state, err := term.MakeRaw(fd); err == nil {
+			defer term.Restore(fd, state)
+		}
+		go dc.watchTerminalSize(fd)
+	}
+
+	done := make(chan error, 2)
+	go func() { done <- dc.readLoop() }()
+	go dc.forwardInput(stdin, terminal, done)
+	go dc.resendLoop()
+	go dc.pingLoop()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		if parent.Err() != nil {
+			return parent.Err()
+		}
+		return ErrInterrupted
+	}
+}
+
+// readLoop processes incoming messages until the channel is closed. Stream data is
+// acknowledged as it arrives and handled in sequence order.
+func (dc *dataChannel) readLoop() error {
+	for {
+		_, data, err := dc.conn.ReadMessage()
+		if err != nil {
+			if dc.ctx.Err() != nil || websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+				return nil
+			}
+			return fmt.Errorf("reading from the session data channel: %w", err)
+		}
+		msg, err := unmarshalClientMessage(data)
+		if err != nil {
+			return err
+		}
+		logf("recv %s seq=%d payload=%d bytes", msg.MessageType, msg.SequenceNumber, len(msg.Payload))
+
+		switch msg.MessageType {
+		case msgOutputStreamData:
+			if err := dc.acknowledge(msg); err != nil {
+				return err
+			}
+			if msg.SequenceNumber < dc.expectedSeq {
+				continue // a resend of something already handled
+			}
+			dc.received[msg.SequenceNumber] = msg
+			for {
+				next, ok := dc.received[dc.expectedSeq]
+				if !ok {
+					break
+				}
+				delete(dc.received, dc.expectedSeq)
+				dc.expectedSeq++
+				if err := dc.handleOutput(next); err != nil {
+					return err
+				}
+			}
+		case msgAcknowledge:
+			var ack acknowledgeContent
+			if json.Unmarshal(msg.Payload, &ack) == nil {
+				dc.mu.Lock()
+				delete(dc.unacked, ack.AcknowledgedMessageSequenceNumber)
+				dc.mu.Unlock()
+			}
+		case msgChannelClosed:
+			var closed struct{ Output string }
+			if json.Unmarshal(msg.Payload, &closed) == nil && closed.Output != "" {
+				fmt.Fprintf(dc.stderr, "\r\n%s\r\n", closed.Output)
+			}
+			return nil
+		}
+	}
+}
+
+func (dc *dataChannel) handleOutput(msg *clientMessage) error {
+	switch msg.PayloadType {
+	case payloadHandshakeRequest:
+		return dc.handshake(msg.Payload)
+	case payloadHandshakeComplete:
+		var complete struct{ CustomerMessage string }
+		if json.Unmarshal(msg.Payload, &complete) == nil && complete.CustomerMessage != "" {
+			fmt.Fprintln(dc.stderr, complete.CustomerMessage)
+		}
+		dc.markReady()
+	case payloadEncChallengeRequest:
+		return dc.answerChallenge(msg.Payload)
+	case payloadOutput, payloadStdErr:
+		dc.markReady()
+		data, err := dc.open(msg.Payload)
+		if err != nil {
+			return err
+		}
+		w := dc.stdout
+		if msg.PayloadType == payloadStdErr {
+			w = dc.stderr
+		}
+		w.Write(data)
+	}
+	return nil
+}
+
+// handshake answers the agent's handshake request, setting up KMS encryption if the
+// session preferences require it.
+func (dc *dataChannel) handshake(payload []byte) error {
+	var request struct {
+		AgentVersion           string
+		RequestedClientActions []struct {
+			ActionType       string
+			ActionParameters json.RawMessage
+		}
+	}
+	if err := json.Unmarshal(payload, &request); err != nil {
+		return fmt.Errorf("decoding the session handshake: %w", err)
+	}
+
+	response := struct {
+		ClientVersion          string
+		ProcessedClientActions []processedClientAction
+		Errors                 []string
+	}{ClientVersion: nativeClientVersion, Errors: []string{}}
+
+	var encryptionErr error
+	for _, action := range request.RequestedClientActions {
+		processed := processedClientAction{ActionType: action.ActionType, ActionStatus: actionStatusSuccess}
+		switch action.ActionType {
+		case actionSessionType:
+			// Shells and SSH proxying are both relayed as plain streams.
+		case actionKMSEncryption:
+			result, err := dc.setUpEncryption(action.ActionParameters)
+			if err != nil {
+				encryptionErr = err
+				processed.ActionStatus = actionStatusFailed
+				processed.Error = err.Error()
+				response.Errors = append(response.Errors, err.Error())
+			} else {
+				processed.ActionResult = result
+			}
+		default:
+			processed.ActionStatus = actionStatusUnsupported
+			processed.Error = fmt.Sprintf("%s is not supported by this client", action.ActionType)
+		}
+		response.ProcessedClientActions = append(response.ProcessedClientActions, processed)
+	}
+
+	data, err := json.Marshal(response)
+	if err != nil {
+		return fmt.Errorf("encoding the session handshake: %w", err)
+	}
+	if err := dc.send(payloadHandshakeResponse, data); err != nil {
+		return err
+	}
+	return encryptionErr
+}
+
+// setUpEncryption generates the session's data key with KMS. The agent decrypts the
+// returned ciphertext key; the first half of the plaintext key protects agent output and
+// the second half client input.
+func (dc *dataChannel) setUpEncryption(params json.RawMessage) (json.RawMessage, error) {
+	var request struct {
+		KMSKeyID string `json:"KMSKeyId"`
+	}
+	if err := json.Unmarshal(params, &request); err != nil {
+		return nil, fmt.Errorf("decoding the KMS encryption request: %w", err)
+	}
+
+	key, err := kms.NewFromConfig(dc.cfg).GenerateDataKey(dc.ctx, &kms.GenerateDataKeyInput{
+		KeyId:         aws.String(request.KMSKeyID),
+		NumberOfBytes: aws.Int32(64),
+		EncryptionContext: map[string]string{
+			"aws:ssm:SessionId": dc.sessionID,
+			"aws:ssm:TargetId":  dc.target,
+		},
+	})
+	if err != nil {
+		return nil, &KeyError{KeyID: request.KMSKeyID, Err: err}
+	}
+
+	half := len(key.Plaintext) / 2
+	decrypt, err := newGCM(key.Plaintext[:half])
+	if err != nil {
+		return nil, err
+	}
+	encrypt, err := newGCM(key.Plaintext[half:])
+	if err != nil {
+		return nil, err
+	}
+
+	dc.mu.Lock()
+	dc.decrypt, dc.encrypt = decrypt, encrypt
+	dc.mu.Unlock()
+
+	return json.Marshal(struct{ KMSCipherTextKey []byte }{key.CiphertextBlob})
+}
+
+// answerChallenge proves to the agent that both sides hold the same keys by returning its
+// challenge re-encrypted with the client key.
+func (dc *dataChannel) answerChallenge(payload []byte) error {
+	var challenge struct{ Challenge []byte }
+	if err := json.Unmarshal(payload, &challenge); err != nil {
+		return fmt.Errorf("decoding the encryption challenge: %w", err)
+	}
+	plain, err := dc.open(challenge.Challenge)
+	if err != nil {
+		return err
+	}
+	challenge.Challenge = dc.seal(plain)
+	data, err := json.Marshal(challenge)
+	if err != nil {
+		return fmt.Errorf("encoding the encryption challenge: %w", err)
+	}
+	return dc.send(payloadEncChallengeResponse, data)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("setting up session encryption: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts client data once encryption is set up; the nonce is prepended.
+func (dc *dataChannel) seal(data []byte) []byte {
+	dc.mu.Lock()
+	aead := dc.encrypt
+	dc.mu.Unlock()
+	if aead == nil {
+		return data
+	}
+	nonce := make([]byte, aead.NonceSize())
+	rand.Read(nonce)
+	return aead.Seal(nonce, nonce, data, nil)
+}
+
+// open decrypts agent data once encryption is set up.
+func (dc *dataChannel) open(data []byte) ([]byte, error) {
+	dc.mu.Lock()
+	aead := dc.decrypt
+	dc.mu.Unlock()
+	if aead == nil {
+		return data, nil
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, fmt.Errorf("decrypting session output: message too short")
+	}
+	plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting session output: %w", err)
+	}
+	return plain, nil
+}
+
+func (dc *dataChannel) markReady() {
+	dc.readyOnce.Do(func() { close(dc.ready) })
+}
+
+// send writes the next input stream message and keeps it for resending until the agent
+// acknowledges it. Only terminal data is encrypted, as the plugin does.
+func (dc *dataChannel) send(payloadType uint32, payload []byte) error {
+	if payloadType == payloadOutput {
+		payload = dc.seal(payload)
+	}
+
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	msg := &clientMessage{
+		MessageType:    msgInputStreamData,
+		SchemaVersion:  1,
+		CreatedDate:    uint64(time.Now().UnixMilli()),
+		SequenceNumber: dc.nextSeq,
+		MessageID:      newUUID(),
+		PayloadType:    payloadType,
+		Payload:        payload,
+	}
+	data := msg.marshal()
+	dc.unacked[dc.nextSeq] = &pendingMessage{data: data, sentAt: time.Now()}
+	dc.nextSeq++
+	return dc.write(data)
+}
+
+func (dc *dataChannel) acknowledge(msg *clientMessage) error {
+	payload, err := json.Marshal(acknowledgeContent{
+		AcknowledgedMessageType:           msg.MessageType,
+		AcknowledgedMessageId:             formatUUID(msg.MessageID),
+		AcknowledgedMessageSequenceNumber: msg.SequenceNumber,
+		IsSequentialMessage:               true,
+	})
+	if err != nil {
+		return fmt.Errorf("encoding acknowledgement: %w", err)
+	}
+	ack := &clientMessage{
+		MessageType:   msgAcknowledge,
+		SchemaVersion: 1,
+		CreatedDate:   uint64(time.Now().UnixMilli()),
+		Flags:         clientMessageAckFlags,
+		MessageID:     newUUID(),
+		Payload:       payload,
+	}
+	return dc.write(ack.marshal())
+}
+
+func (dc *dataChannel) write(data []byte) error {
+	dc.writeMu.Lock()
+	defer dc.writeMu.Unlock()
+	if err := dc.conn.WriteMessage(websocket.BinaryMessage, data); err != nil {
+		return fmt.Errorf("writing to the session data channel: %w", err)
+	}
+	return nil
+}
+
+// forwardInput relays stdin once the agent is ready. In SSH proxy mode the end of stdin
+// ends the session; a terminal session ends when the remote shell exits.
+func (dc *dataChannel) forwardInput(r io.Reader, terminal bool, done chan<- error) {
+	select {
+	case <-dc.ready:
+	case <-dc.ctx.Done():
+		return
+	}
+
+	buf := make([]byte, 1024)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if err := dc.send(payloadOutput, buf[:n]); err != nil {
+				done <- err
+				return
+			}
+		}
+		if err != nil {
+			if !terminal {
+				done <- nil
+			}
+			return
+		}
+	}
+}
+
+// watchTerminalSize sends the terminal size at the start and whenever it changes. Polling
+// works the same on every platform, which a SIGWINCH handler would not.
+func (dc *dataChannel) watchTerminalSize(fd int) {
+	select {
+	case <-dc.ready:
+	case <-dc.ctx.Done():
+		return
+	}
+
+	ticker := time.NewTicker(resizePollInterval)
+	defer ticker.Stop()
+	cols, rows := 0, 0
+	for {
+		if w, h, err := term.GetSize(fd); err == nil && (w != cols || h != rows) {
+			cols, rows = w, h
+			size, _ := json.Marshal(map[string]int{"cols": cols, "rows": rows})
+			dc.send(payloadSize, size)
+		}
+		select {
+		case <-ticker.C:
+		case <-dc.ctx.Done():
+			return
+		}
+	}
+}
+
+// resendLoop resends input the agent has not acknowledged in time.
+func (dc *dataChannel) resendLoop() {
+	ticker := time.NewTicker(resendTimeout / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-dc.ctx.Done():
+			return
+		}
+		dc.mu.Lock()
+		for _, pending := range dc.unacked {
+			if time.Since(pending.sentAt) >= resendTimeout {
+				pending.sentAt = time.Now()
+				dc.write(pending.data)
+			}
+		}
+		dc.mu.Unlock()
+	}
+}
+
+// pingLoop keeps idle sessions from being dropped by the service.
+func (dc *dataChannel) pingLoop() {
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			dc.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second))
+		case <-dc.ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package session
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func TestClientMessageRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  clientMessage
+	}{
+		{"input", clientMessage{MessageType: msgInputStreamData, SchemaVersion: 1, CreatedDate: 1760520000000,
+			SequenceNumber: 42, MessageID: newUUID(), PayloadType: payloadOutput, Payload: []byte("ls -l\r")}},
+		{"acknowledge", clientMessage{MessageType: msgAcknowledge, SchemaVersion: 1, SequenceNumber: 0,
+			Flags: clientMessageAckFlags, MessageID: newUUID(), Payload: []byte(`{"AcknowledgedMessageSequenceNumber":7}`)}},
+		{"empty payload", clientMessage{MessageType: msgChannelClosed, SequenceNumber: -1, MessageID: newUUID(), Payload: []byte{}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := tt.msg.marshal()
+			if got := binary.BigEndian.Uint32(data[0:]); got != clientMessageHeaderLength {
+				t.Errorf("header length = %d, want %d", got, clientMessageHeaderLength)
+			}
+			if len(data) != clientMessageHeaderLength+4+len(tt.msg.Payload) {
+				t.Errorf("message is %d bytes, want %d", len(data), clientMessageHeaderLength+4+len(tt.msg.Payload))
+			}
+			if got := int64(binary.BigEndian.Uint64(data[48:])); got != tt.msg.SequenceNumber {
+				t.Errorf("sequence number = %d, want %d", got, tt.msg.SequenceNumber)
+			}
+			if digest := sha256.Sum256(tt.msg.Payload); !bytes.Equal(data[80:112], digest[:]) {
+				t.Errorf("payload digest = %x, want %x", data[80:112], digest)
+			}
+			// The message ID is stored low half first.
+			if !bytes.Equal(data[64:72], tt.msg.MessageID[8:]) || !bytes.Equal(data[72:80], tt.msg.MessageID[:8]) {
+				t.Errorf("message ID = %x, want the halves of %x swapped", data[64:80], tt.msg.MessageID)
+			}
+
+			got, err := unmarshalClientMessage(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(*got, tt.msg) {
+				t.Errorf("round trip = %+v, want %+v", *got, tt.msg)
+			}
+		})
+	}
+}
+
+func TestUnmarshalClientMessageMalformed(t *testing.T) {
+	valid := (&clientMessage{MessageType: msgOutputStreamData, Payload: []byte("hello")}).marshal()
+	withHeaderLength := func(n uint32) []byte {
+		data := bytes.Clone(valid)
+		binary.BigEndian.PutUint32(data[0:], n)
+		return data
+	}
+	withPayloadLength := func(n uint32) []byte {
+		data := bytes.Clone(valid)
+		binary.BigEndian.PutUint32(data[clientMessageHeaderLength:], n)
+		return data
+	}
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"too short", valid[:clientMessageHeaderLength]},
+		{"header length too small", withHeaderLength(clientMessageHeaderLength - 1)},
+		{"header length past the end", withHeaderLength(uint32(len(valid)))},
+		{"payload length past the end", withPayloadLength(6)},
+	}
+	for _, tt := range tests {
+		if msg, err := unmarshalClientMessage(tt.data); err == nil {
+			t.Errorf("%s: unmarshalClientMessage = %+v, want an error", tt.name, msg)
+		}
+	}
+}
+
+func TestUnmarshalClientMessageLongerHeader(t *testing.T) {
+	// Newer agents may add header fields; the payload length follows the header, wherever it ends.
+	msg := clientMessage{MessageType: msgOutputStreamData, SequenceNumber: 3, Payload: []byte("hi")}
+	data := msg.marshal()
+	longer := append(bytes.Clone(data[:clientMessageHeaderLength]), 0, 0, 0, 0)
+	longer = append(longer, data[clientMessageHeaderLength:]...)
+	binary.BigEndian.PutUint32(longer[0:], clientMessageHeaderLength+4)
+
+	got, err := unmarshalClientMessage(longer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got.Payload) != "hi" || got.SequenceNumber != 3 {
+		t.Errorf("unmarshalClientMessage = %+v", got)
+	}
+}
+
+func TestHandleOutputStreams(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	dc := &dataChannel{stdout: &stdout, stderr: &stderr, ready: make(chan struct{})}
+	messages := []*clientMessage{
+		{PayloadType: payloadOutput, Payload: []byte("out\n")},
+		{PayloadType: payloadStdErr, Payload: []byte("err\n")},
+		{PayloadType: payloadHandshakeComplete, Payload: []byte(`{"CustomerMessage":"welcome"}`)},
+	}
+	for _, msg := range messages {
+		if err := dc.handleOutput(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := stdout.String(); got != "out\n" {
+		t.Errorf("stdout = %q, want %q", got, "out\n")
+	}
+	if got, want := stderr.String(), "err\nwelcome\n"; got != want {
+		t.Errorf("stderr = %q, want %q", got, want)
+	}
+}
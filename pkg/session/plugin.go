@@ -0,0 +1,57 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+// PluginName is the binary that speaks the Session Manager data channel protocol for every
+// kind of session, port forwarding included. The AWS CLI delegates to it after calling
+// StartSession.
+const PluginName = "session-manager-plugin"
+
+// pluginRequest is the StartSession request as the AWS CLI serializes it for the plugin.
+type pluginRequest struct {
+	Target       string              `json:"Target"`
+	DocumentName string              `json:"DocumentName,omitempty"`
+	Parameters   map[string][]string `json:"Parameters,omitempty"`
+}
+
+// PluginArgs returns the arguments for session-manager-plugin to take over the session
+// that input started with the StartSession response output, exactly as the AWS CLI passes
+// them. The SSM endpoint is resolved from cfg, so a custom endpoint URL or FIPS endpoints
+// carry over. profile, which may be empty, is the profile the plugin should use for its
+// own calls. The first argument carries the session token; keep it out of logs.
+func PluginArgs(ctx context.Context, cfg aws.Config, profile string, input *ssm.StartSessionInput, output *ssm.StartSessionOutput) ([]string, error) {
+	sessionJSON, err := json.Marshal(map[string]string{
+		"SessionId":  aws.ToString(output.SessionId),
+		"TokenValue": aws.ToString(output.TokenValue),
+		"StreamUrl":  aws.ToString(output.StreamUrl),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("encoding session response: %w", err)
+	}
+	requestJSON, err := json.Marshal(pluginRequest{
+		Target:       aws.ToString(input.Target),
+		DocumentName: aws.ToString(input.DocumentName),
+		Parameters:   input.Parameters,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("encoding session request: %w", err)
+	}
+
+	clientOpts := ssm.NewFromConfig(cfg).Options()
+	endpoint, err := clientOpts.EndpointResolverV2.ResolveEndpoint(ctx, ssm.EndpointParameters{
+		Region:   aws.String(cfg.Region),
+		UseFIPS:  aws.Bool(clientOpts.EndpointOptions.UseFIPSEndpoint == aws.FIPSEndpointStateEnabled),
+		Endpoint: clientOpts.BaseEndpoint,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("resolving the SSM endpoint for region %s: %w", cfg.Region, err)
+	}
+	return []string{string(sessionJSON), cfg.Region, "StartSession", profile, string(requestJSON), endpoint.URI.String()}, nil
+}
@@ -0,0 +1,66 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+func TestPluginArgs(t *testing.T) {
+	input := &ssm.StartSessionInput{
+		Target:       aws.String("i-0abc"),
+		DocumentName: aws.String("AWS-StartPortForwardingSession"),
+		Parameters:   map[string][]string{"portNumber": {"80"}, "localPortNumber": {"8080"}},
+	}
+	output := &ssm.StartSessionOutput{
+		SessionId:  aws.String("alice-0123"),
+		TokenValue: aws.String("token"),
+		StreamUrl:  aws.String("wss://ssmmessages.eu-west-1.amazonaws.com/v1/data-channel/alice-0123"),
+	}
+	tests := []struct {
+		name     string
+		cfg      aws.Config
+		profile  string
+		endpoint string
+	}{
+		{"default endpoint", aws.Config{Region: "eu-west-1"}, "dev", "https://ssm.eu-west-1.amazonaws.com"},
+		{"custom endpoint", aws.Config{Region: "eu-west-1", BaseEndpoint: aws.String("https://vpce-1.ssm.eu-west-1.vpce.amazonaws.com")}, "",
+			"https://vpce-1.ssm.eu-west-1.vpce.amazonaws.com"},
+		{"china partition", aws.Config{Region: "cn-north-1"}, "", "https://ssm.cn-north-1.amazonaws.com.cn"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, err := PluginArgs(context.Background(), tt.cfg, tt.profile, input, output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(args) != 6 {
+				t.Fatalf("got %d arguments, want 6: %q", len(args), args)
+			}
+			var response map[string]string
+			if err := json.Unmarshal([]byte(args[0]), &response); err != nil {
+				t.Fatal(err)
+			}
+			if want := map[string]string{"SessionId": "alice-0123", "TokenValue": "token", "StreamUrl": *output.StreamUrl}; !reflect.DeepEqual(response, want) {
+				t.Errorf("session = %v, want %v", response, want)
+			}
+			if args[1] != tt.cfg.Region || args[2] != "StartSession" || args[3] != tt.profile {
+				t.Errorf("region, operation and profile = %q", args[1:4])
+			}
+			var request pluginRequest
+			if err := json.Unmarshal([]byte(args[4]), &request); err != nil {
+				t.Fatal(err)
+			}
+			if want := (pluginRequest{Target: "i-0abc", DocumentName: "AWS-StartPortForwardingSession", Parameters: input.Parameters}); !reflect.DeepEqual(request, want) {
+				t.Errorf("request = %+v, want %+v", request, want)
+			}
+			if args[5] != tt.endpoint {
+				t.Errorf("endpoint = %s, want %s", args[5], tt.endpoint)
+			}
+		})
+	}
+}
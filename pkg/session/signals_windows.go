@@ -0,0 +1,8 @@
+//go:build windows
+
+package session
+
+import "os"
+
+// terminationSignals end a session relayed by RunNative.
+var terminationSignals = []os.Signal{os.Interrupt}
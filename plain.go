@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/nkarisa/homebrew-aws-ssm-connect/pkg/picker"
+	"golang.org/x/term"
+)
+
+// plainOutput is the --plain value: no colors, box drawing, spinners or redrawn progress
+// lines, and numbered prompts read line by line instead of the fuzzy finder, for screen
+// readers and CI logs.
+var plainOutput bool
+
+// addPlainFlags registers --plain. Like --debug it takes effect while the flags are parsed.
+func addPlainFlags(fs *flag.FlagSet) {
+	fs.BoolFunc("plain", "plain, line-oriented output and numbered prompts, for screen readers and logs", func(string) error {
+		setPlainOutput()
+		return nil
+	})
+}
+
+// setPlainOutput turns plain output on, for --plain or the config file's plain: true.
+func setPlainOutput() {
+	plainOutput = true
+	picker.Plain = true
+}
+
+// liveOutput reports whether stderr may show a spinner or a progress line rewritten in
+// place.
+func liveOutput() bool {
+	return !plainOutput && term.IsTerminal(int(os.Stderr.Fd()))
+}
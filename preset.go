@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nkarisa/homebrew-aws-ssm-connect/pkg/picker"
+)
+
+// preset is a named environment from the config file's presets section: the profile,
+// region, filters and session document to use together, chosen with --env. For example
+//
+//	presets:
+//	  prod-eu:
+//	    profile: prod
+//	    region: eu-west-1
+//	    tags: [Env=prod]
+//	    document: Prod-Hardened-Shell
+type preset struct {
+	Profile     string            `yaml:"profile"`
+	Region      string            `yaml:"region"`
+	Tags        []string          `yaml:"tags"`
+	States      []string          `yaml:"states"`
+	Sources     []string          `yaml:"sources"`
+	Accounts    []string          `yaml:"accounts"`
+	AccountRole string            `yaml:"account_role"`
+	Document    string            `yaml:"document"`
+	Parameters  map[string]string `yaml:"parameters"`
+}
+
+// summary describes the preset in one line for the picker.
+func (p preset) summary() string {
+	var parts []string
+	if p.Profile != "" {
+		parts = append(parts, "profile "+p.Profile)
+	}
+	if p.Region != "" {
+		parts = append(parts, "region "+p.Region)
+	}
+	if len(p.Tags) > 0 {
+		parts = append(parts, "tags "+strings.Join(p.Tags, ","))
+	}
+	if p.Document != "" {
+		parts = append(parts, "document "+p.Document)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// presetNames returns the names of presets, sorted.
+func presetNames(presets map[string]preset) []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applyPreset sets the options the named preset defines. Flags given on the command line
+// or restored by --last/--history still win; the environment and config file settings
+// the preset covers don't.
+func (o *options) applyPreset(name string) error {
+	p, ok := o.presets[name]
+	if !ok {
+		if len(o.presets) == 0 {
+			return fmt.Errorf("unknown environment '%s': no presets are configured", name)
+		}
+		return fmt.Errorf("unknown environment '%s'; available: %s", name, strings.Join(presetNames(o.presets), ", "))
+	}
+	o.Env = name
+	if p.Profile != "" && !o.isPinned("profile") {
+		o.Profile = p.Profile
+	}
+	if p.Region != "" && !o.isPinned("region") {
+		o.Region = p.Region
+	}
+	if len(p.Tags) > 0 && !o.isSet("tag") {
+		o.Tags = p.Tags
+	}
+	if len(p.States) > 0 && !o.isSet("state") {
+		o.States = p.States
+	}
+	if len(p.Sources) > 0 && !o.isSet("source") {
+		o.Sources = p.Sources
+	}
+	if len(p.Accounts) > 0 && !o.isPinned("accounts") {
+		o.Accounts = p.Accounts
+	}
+	if p.AccountRole != "" && !o.isPinned("account-role") {
+		o.AccountRole = p.AccountRole
+	}
+	if p.Document != "" && !o.isSet("document-name") {
+		o.Document = p.Document
+	}
+	if len(p.Parameters) > 0 && !o.isSet("parameter") {
+		o.Parameters = nil
+		for key, value := range p.Parameters {
+			o.Parameters = append(o.Parameters, key+"="+value)
+		}
+	}
+	return nil
+}
+
+// pickPreset asks the user to choose one of the configured presets and applies it.
+func pickPreset(opts *options) error {
+	names := presetNames(opts.presets)
+	rows := make([]string, len(names))
+	for i, name := range names {
+		rows[i] = fmt.Sprintf("%-20s %s", name, opts.presets[name].summary())
+	}
+	index, err := picker.Choose("Select an environment", rows, opts.Numbered)
+	if err != nil {
+		return err
+	}
+	return opts.applyPreset(names[index])
+}
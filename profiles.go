@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/nkarisa/homebrew-aws-ssm-connect/pkg/picker"
+	"golang.org/x/term"
+)
+
+// sharedConfigFiles returns the AWS shared config and credentials file paths, honoring
+// AWS_CONFIG_FILE and AWS_SHARED_CREDENTIALS_FILE like the SDK does.
+func sharedConfigFiles() (configFile, credentialsFile string) {
+	home, _ := os.UserHomeDir()
+	configFile = os.Getenv("AWS_CONFIG_FILE")
+	if configFile == "" {
+		configFile = filepath.Join(home, ".aws", "config")
+	}
+	credentialsFile = os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if credentialsFile == "" {
+		credentialsFile = filepath.Join(home, ".aws", "credentials")
+	}
+	return configFile, credentialsFile
+}
+
+// listAWSProfiles returns the sorted, de-duplicated profile names defined in the shared
+// config ([profile name] and [default]) and credentials ([name]) files.
+func listAWSProfiles() []string {
+	configFile, credentialsFile := sharedConfigFiles()
+
+	seen := map[string]bool{}
+	for _, section := range iniSections(configFile) {
+		switch {
+		case section == "default":
+			seen["default"] = true
+		case strings.HasPrefix(section, "profile "):
+			seen[strings.TrimSpace(strings.TrimPrefix(section, "profile "))] = true
+		}
+	}
+	for _, section := range iniSections(credentialsFile) {
+		seen[section] = true
+	}
+
+	profiles := make([]string, 0, len(seen))
+	for name := range seen {
+		profiles = append(profiles, name)
+	}
+	sort.Strings(profiles)
+	return profiles
+}
+
+// iniSections returns the section names ("[...]" headers) of an INI file, or nil if it
+// can't be read.
+func iniSections(path string) []string {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var sections []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			sections = append(sections, strings.TrimSpace(line[1:len(line)-1]))
+		}
+	}
+	return sections
+}
+
+// shouldPickProfile reports whether to ask the user for a profile: nothing chose one
+// (flag, config file, AWS_PROFILE, static credentials in the environment), stdin is a
+// terminal, and there is more than one profile to choose from.
+func shouldPickProfile(opts *options, profiles []string) bool {
+	if opts.Profile != "" || os.Getenv("AWS_PROFILE") != "" || os.Getenv("AWS_ACCESS_KEY_ID") != "" {
+		return false
+	}
+	return len(profiles) > 1 && term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// pickProfile asks the user to choose one of the configured profiles, or one of the
+// config file's presets if it defines any.
+func pickProfile(opts *options) error {
+	if len(opts.presets) > 0 && opts.Env == "" {
+		if !shouldPickProfile(opts, presetNames(opts.presets)) {
+			return nil
+		}
+		return pickPreset(opts)
+	}
+
+	profiles := listAWSProfiles()
+	if !shouldPickProfile(opts, profiles) {
+		return nil
+	}
+
+	index, err := picker.Choose("Select an AWS profile", profiles, opts.Numbered)
+	if err != nil {
+		return err
+	}
+	opts.Profile = profiles[index]
+	return nil
+}
+
+// profileName returns the name of the profile in effect: the given one, AWS_PROFILE, or
+// "default". Per-profile state such as the cache and aliases is keyed by it.
+func profileName(profile string) string {
+	if profile == "" {
+		profile = os.Getenv("AWS_PROFILE")
+	}
+	if profile == "" {
+		profile = "default"
+	}
+	return profile
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/nkarisa/homebrew-aws-ssm-connect/pkg/session"
+)
+
+// proxyURL is the --proxy value; nil leaves the choice to HTTPS_PROXY, HTTP_PROXY and
+// NO_PROXY, which the SDK, the built-in session client and the tools we run all honor.
+var proxyURL *url.URL
+
+// addProxyFlags registers --proxy. Like --debug it takes effect while the flags are parsed.
+// The proxy is also exported as HTTPS_PROXY and HTTP_PROXY, so session-manager-plugin and
+// the SSH proxy commands we start use it too.
+func addProxyFlags(fs *flag.FlagSet) {
+	fs.Func("proxy", "send AWS API calls and sessions through this HTTP(S) proxy `url`, e.g. http://proxy.corp:3128 (default: HTTPS_PROXY, except NO_PROXY hosts)", func(value string) error {
+		u, err := url.Parse(value)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("expected an http:// or https:// proxy URL, got '%s'", value)
+		}
+		proxyURL = u
+		session.Proxy = http.ProxyURL(u)
+		for _, name := range []string{"HTTPS_PROXY", "HTTP_PROXY", "https_proxy", "http_proxy"} {
+			os.Setenv(name, value)
+		}
+		return nil
+	})
+}
+
+// proxyConfigOptions returns the SDK option that sends API calls through --proxy.
+func proxyConfigOptions() []func(*config.LoadOptions) error {
+	if proxyURL == nil {
+		return nil
+	}
+	client := awshttp.NewBuildableClient().WithTransportOptions(func(t *http.Transport) {
+		t.Proxy = http.ProxyURL(proxyURL)
+	})
+	return []func(*config.LoadOptions) error{config.WithHTTPClient(client)}
+}
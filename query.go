@@ -0,0 +1,256 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// queryOperators are the comparisons --query-filter understands.
+var queryOperators = []string{"=", "!=", "<", ">", "contains", "prefix", "suffix", "~", "!~"}
+
+// querySymbols are the operators that may be written without spaces around them, as in
+// age>9d, longest first.
+var querySymbols = []string{"!=", "!~", "=", "~", "<", ">"}
+
+// queryTimes are the fields compared as durations with < and >, and the time each one
+// counts from.
+var queryTimes = map[string]func(Instance) time.Time{
+	"age":       func(inst Instance) time.Time { return inst.LaunchTime },
+	"last-ping": func(inst Instance) time.Time { return inst.LastPing },
+}
+
+// queryCondition is one "field operator value" comparison of a --query-filter.
+type queryCondition struct {
+	field    string
+	operator string
+	value    string
+	pattern  *regexp.Regexp // for ~ and !~
+	duration time.Duration  // for < and >
+}
+
+// queryFilter is a flag.Value for --query-filter, a small expression evaluated on the
+// listing client-side:
+//
+//	name contains web and ip prefix 10.1.
+//	tag:Team ~ ^plat or type = t3.micro
+//
+//	age > 9d or last-ping>1h
+//
+// Fields are the --columns keys and tag:Key. Values with spaces may be quoted. "and" binds
+// tighter than "or"; comparisons are case-insensitive except for regular expressions.
+// age and last-ping only take < and >, with a duration such as 9d, 12h or 30m.
+type queryFilter struct {
+	text         string
+	alternatives [][]queryCondition // instances match if all the conditions of any one match
+}
+
+func (q *queryFilter) String() string { return q.text }
+
+func (q *queryFilter) Set(v string) error {
+	words, err := splitQuery(v)
+	if err != nil {
+		return err
+	}
+
+	var alternatives [][]queryCondition
+	var all []queryCondition
+	for len(words) > 0 {
+		words = append(splitCondition(words[0]), words[1:]...)
+		if len(words) < 3 {
+			return fmt.Errorf("incomplete condition '%s': expected field operator value", strings.Join(words, " "))
+		}
+		cond := queryCondition{field: strings.ToLower(words[0]), operator: strings.ToLower(words[1]), value: words[2]}
+		if !strings.HasPrefix(cond.field, "tag:") && findColumn(cond.field) == nil {
+			return fmt.Errorf("unknown field '%s'; available: %s, tag:Key", words[0], strings.Join(columnKeys(), ", "))
+		}
+		if cond.field != words[0] && strings.HasPrefix(cond.field, "tag:") {
+			cond.field = "tag:" + words[0][len("tag:"):] // Tag keys are case-sensitive.
+		}
+		_, timed := queryTimes[cond.field]
+		switch cond.operator {
+		case "~", "!~":
+			if cond.pattern, err = regexp.Compile(cond.value); err != nil {
+				return fmt.Errorf("invalid regular expression '%s': %w", cond.value, err)
+			}
+		case "<", ">":
+			if !timed {
+				return fmt.Errorf("'%s' only compares age and last-ping, not '%s'", words[1], words[0])
+			}
+			if cond.duration, err = parseQueryDuration(cond.value); err != nil {
+				return err
+			}
+		case "=", "!=", "contains", "prefix", "suffix":
+		default:
+			return fmt.Errorf("unknown operator '%s'; available: %s", words[1], strings.Join(queryOperators, ", "))
+		}
+		if timed && cond.duration == 0 {
+			return fmt.Errorf("'%s' is compared with < or >, e.g. '%s > 9d'", words[0], cond.field)
+		}
+		all = append(all, cond)
+		words = words[3:]
+
+		if len(words) == 0 {
+			break
+		}
+		switch strings.ToLower(words[0]) {
+		case "and":
+		case "or":
+			alternatives, all = append(alternatives, all), nil
+		default:
+			return fmt.Errorf("expected 'and' or 'or' before '%s'", words[0])
+		}
+		if len(words) == 1 {
+			return fmt.Errorf("expected a condition after '%s'", words[0])
+		}
+		words = words[1:]
+	}
+	if len(all) == 0 {
+		return fmt.Errorf("empty filter")
+	}
+	q.text, q.alternatives = v, append(alternatives, all)
+	return nil
+}
+
+// splitCondition splits a word such as age>9d or name=web at its operator. Other words are
+// returned as they are.
+func splitCondition(word string) []string {
+	at, operator := -1, ""
+	for _, symbol := range querySymbols {
+		if i := strings.Index(word, symbol); i > 0 && (at < 0 || i < at) {
+			at, operator = i, symbol
+		}
+	}
+	if at < 0 {
+		return []string{word}
+	}
+	if value := word[at+len(operator):]; value != "" {
+		return []string{word[:at], operator, value}
+	}
+	return []string{word[:at], operator}
+}
+
+// parseQueryDuration parses the duration of an age or last-ping comparison: a Go duration
+// (12h, 30m) or a number of days (9d).
+func parseQueryDuration(v string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(v, "d"); ok {
+		n, err := strconv.ParseFloat(days, 64)
+		if err == nil && n > 0 {
+			return time.Duration(n * float64(24*time.Hour)), nil
+		}
+	} else if d, err := time.ParseDuration(v); err == nil && d > 0 {
+		return d, nil
+	}
+	return 0, fmt.Errorf("invalid duration '%s': expected e.g. 9d, 12h or 30m", v)
+}
+
+// splitQuery splits an expression into words, honoring single and double quotes.
+func splitQuery(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	for _, r := range s {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			word.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in '%s'", s)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// matches reports whether inst satisfies the filter. An empty filter matches everything.
+func (q *queryFilter) matches(inst Instance) bool {
+	if len(q.alternatives) == 0 {
+		return true
+	}
+	for _, all := range q.alternatives {
+		matched := true
+		for _, cond := range all {
+			if !cond.matches(inst) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (c queryCondition) matches(inst Instance) bool {
+	if since, ok := queryTimes[c.field]; ok {
+		// Instances without the time, e.g. never pinged, match neither way.
+		t := since(inst)
+		if t.IsZero() {
+			return false
+		}
+		if c.operator == "<" {
+			return time.Since(t) < c.duration
+		}
+		return time.Since(t) > c.duration
+	}
+
+	var field string
+	if key, ok := strings.CutPrefix(c.field, "tag:"); ok {
+		field = inst.Tags[key]
+	} else if c.field == "name" {
+		field = inst.Name // not the N/A the column shows for unnamed instances
+	} else {
+		field = findColumn(c.field).value(inst)
+	}
+
+	switch c.operator {
+	case "~":
+		return c.pattern.MatchString(field)
+	case "!~":
+		return !c.pattern.MatchString(field)
+	}
+	field, value := strings.ToLower(field), strings.ToLower(c.value)
+	switch c.operator {
+	case "=":
+		return field == value
+	case "!=":
+		return field != value
+	case "contains":
+		return strings.Contains(field, value)
+	case "prefix":
+		return strings.HasPrefix(field, value)
+	case "suffix":
+		return strings.HasSuffix(field, value)
+	}
+	return false
+}
+
+// filterQuery keeps the instances that match the --query-filter expression.
+func filterQuery(instances []Instance, q *queryFilter) []Instance {
+	var matched []Instance
+	for _, inst := range instances {
+		if q.matches(inst) {
+			matched = append(matched, inst)
+		}
+	}
+	return matched
+}
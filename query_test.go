@@ -0,0 +1,90 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQueryFilterMatches(t *testing.T) {
+	now := time.Now()
+	web := Instance{
+		InstanceID:       "i-0aaa1111aaaa1111a",
+		Name:             "prod-web-1",
+		PrivateIPAddress: "10.1.2.3",
+		InstanceType:     "t3.micro",
+		LaunchTime:       now.Add(-10 * 24 * time.Hour),
+		LastPing:         now.Add(-2 * time.Minute),
+		Tags:             map[string]string{"Team": "platform"},
+	}
+	unnamed := Instance{
+		InstanceID:   "i-0bbb2222bbbb2222b",
+		InstanceType: "m5.large",
+		LaunchTime:   now.Add(-2 * 24 * time.Hour),
+	}
+	tests := []struct {
+		query string
+		want  []bool // web, unnamed
+	}{
+		{"name = PROD-WEB-1", []bool{true, false}},
+		{"name != prod-web-1", []bool{false, true}},
+		{"name = N/A", []bool{false, false}},
+		{`name = ""`, []bool{false, true}},
+		{"name contains web", []bool{true, false}},
+		{"ip prefix 10.1.", []bool{true, false}},
+		{"type suffix .large", []bool{false, true}},
+		{"tag:Team ~ ^plat", []bool{true, false}},
+		{"tag:Team !~ ^plat", []bool{false, true}},
+		{"tag:team = platform", []bool{false, false}},
+		{"age > 9d", []bool{true, false}},
+		{"age < 9d", []bool{false, true}},
+		{"age>36h", []bool{true, true}},
+		{"last-ping < 5m", []bool{true, false}},
+		{"last-ping > 5m", []bool{false, false}},
+		{"name=prod-web-1", []bool{true, false}},
+		{"type = m5.large or name contains web and age > 30d", []bool{false, true}},
+		{"type = m5.large or name contains web and age > 9d", []bool{true, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			var q queryFilter
+			if err := q.Set(tt.query); err != nil {
+				t.Fatalf("Set(%q): %v", tt.query, err)
+			}
+			for i, inst := range []Instance{web, unnamed} {
+				if got := q.matches(inst); got != tt.want[i] {
+					t.Errorf("matches(%s) = %v, want %v", inst.InstanceID, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestQueryFilterErrors(t *testing.T) {
+	tests := []struct {
+		query   string
+		wantErr string
+	}{
+		{"", "empty filter"},
+		{"name contains", "incomplete condition"},
+		{"color = red", "unknown field 'color'"},
+		{"name like web", "unknown operator 'like'"},
+		{"name ~ (", "invalid regular expression"},
+		{"name = web nor ip = 10.0.0.1", "expected 'and' or 'or' before 'nor'"},
+		{"name = web and", "expected a condition after 'and'"},
+		{"name = 'web", "unterminated quote"},
+		{"name > web", "'>' only compares age and last-ping"},
+		{"age = 3d", "'age' is compared with < or >"},
+		{"age > soon", "invalid duration 'soon'"},
+		{"last-ping < -5m", "invalid duration '-5m'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			var q queryFilter
+			err := q.Set(tt.query)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Set(%q) error = %v, want %q", tt.query, err, tt.wantErr)
+			}
+		})
+	}
+}
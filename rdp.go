@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// rdpPort is the port Remote Desktop listens on in Windows instances.
+const rdpPort = 3389
+
+// runRdp implements the rdp command: pick a Windows instance and forward a free local port
+// to its Remote Desktop port, optionally opening the local RDP client on it.
+func runRdp(ctx context.Context, args []string) int {
+	var opts options
+	var localPort int
+	var launch bool
+	fs := newFlagSet(findCommand("rdp"), &opts)
+	addDiscoveryFlags(fs, &opts)
+	addPickerFlags(fs, &opts)
+	fs.IntVar(&localPort, "local-port", 0, "local `port` to listen on (default: a free port)")
+	fs.BoolVar(&launch, "launch", false, "open the local RDP client once the tunnel is up")
+	addReconnectFlag(fs, &opts)
+	addDryRunFlag(fs, &opts)
+
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return flagErrorCode(err)
+	}
+	if len(positional) > 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	if len(positional) == 1 {
+		opts.Target = positional[0]
+	}
+	opts.WindowsOnly = true
+
+	forwards := []portForward{{LocalPort: localPort, RemotePort: rdpPort}}
+	if err := assignLocalPorts(forwards); err != nil {
+		return reportError(err)
+	}
+	localPort = forwards[0].LocalPort
+
+	fmt.Println(banner)
+	cfg, target, err := resolveTarget(ctx, &opts)
+	if err != nil {
+		return targetErrorCode(err, &opts)
+	}
+	if err := ensureRunning(ctx, cfg, &opts, target); err != nil {
+		return targetErrorCode(err, &opts)
+	}
+	if opts.DryRun {
+		return startSelectedSession(ctx, cfg, &opts, target, forwards)
+	}
+	recordHistory(&opts, target)
+
+	fmt.Printf("\nPoint your RDP client at localhost:%d and log in as Administrator (or a domain user).\n", localPort)
+	if launch {
+		go launchRDPClient(ctx, localPort)
+	}
+	return startSelectedSession(ctx, cfg, &opts, target, forwards)
+}
+
+// freeLocalPort asks the OS for a TCP port that is free on the loopback interface.
+func freeLocalPort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, fmt.Errorf("finding a free local port: %w", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+// waitForListener reports whether something accepts TCP connections on address within
+// timeout, such as the local end of a port forwarding session.
+func waitForListener(ctx context.Context, address string, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		conn, err := net.DialTimeout("tcp", address, time.Second)
+		if err == nil {
+			conn.Close()
+			return true
+		}
+		if time.Now().After(deadline) || ctx.Err() != nil {
+			return false
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// launchRDPClient waits for the tunnel to accept connections and opens the platform's RDP
+// client on it. Failures are warnings; the tunnel stays up for a client started by hand.
+func launchRDPClient(ctx context.Context, port int) {
+	address := net.JoinHostPort("localhost", strconv.Itoa(port))
+	if !waitForListener(ctx, address, 30*time.Second) {
+		fmt.Fprintf(os.Stderr, "Warning: the tunnel on %s did not come up; not launching the RDP client.\n", address)
+		return
+	}
+
+	var name string
+	var args []string
+	switch runtime.GOOS {
+	case "windows":
+		name, args = "mstsc", []string{"/v:" + address}
+	case "darwin":
+		// Handled by Microsoft Remote Desktop / Windows App.
+		name, args = "open", []string{"rdp://full%20address=s:" + address}
+	default:
+		name, args = "xfreerdp", []string{"/v:" + address}
+	}
+	debugCommand(name, args)
+	client, err := executor.Start(name, args, nil, nil, nil, false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not launch the RDP client (%s): %v\n", name, err)
+		return
+	}
+	go client.Wait()
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+// The longest reason StartSession accepts, and the longest Run Command comment.
+const (
+	maxSessionReason  = 256
+	maxCommandComment = 100
+)
+
+// addReasonFlag registers --reason.
+func addReasonFlag(fs *flag.FlagSet, opts *options) {
+	fs.StringVar(&opts.Reason, "reason", "", "why you are connecting, e.g. \"JIRA-123 debugging OOM\"; recorded in the history and sent with the session")
+}
+
+// applyReason sets the reason of a session request, where Session Manager records it in
+// the session history and CloudTrail.
+func (o *options) applyReason(input *ssm.StartSessionInput) {
+	if o.Reason != "" && input.Reason == nil {
+		input.Reason = aws.String(truncate(o.Reason, maxSessionReason))
+	}
+}
+
+// commentWithReason appends the reason to a Run Command comment, within its length limit.
+func (o *options) commentWithReason(comment string) string {
+	if o.Reason == "" {
+		return comment
+	}
+	return truncate(comment+": "+o.Reason, maxCommandComment)
+}
+
+// truncate shortens s to at most n characters.
+func truncate(s string, n int) string {
+	if runes := []rune(s); len(runes) > n {
+		return string(runes[:n])
+	}
+	return s
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aws/smithy-go"
+)
+
+// addReconnectFlag registers --reconnect for the commands that hold a session open.
+func addReconnectFlag(fs *flag.FlagSet, opts *options) {
+	fs.IntVar(&opts.Reconnect, "reconnect", 0, "reconnect up to `n` times when the session drops (network loss, idle timeout)")
+}
+
+// withReconnect runs a session and, with --reconnect, opens it again when it ends
+// abnormally, waiting a little longer before each attempt. A session the user ended or
+// interrupted is not reopened.
+func withReconnect(ctx context.Context, opts *options, instanceID string, session func() error) error {
+	delay := 2 * time.Second
+	for attempt := 1; ; attempt++ {
+		err := session()
+		if err == nil || attempt > opts.Reconnect || !isSessionDrop(err) || ctx.Err() != nil {
+			return err
+		}
+
+		fmt.Fprintf(os.Stderr, "\nThe session to %s dropped: %v\nReconnecting in %s (attempt %d of %d)...\n",
+			instanceID, err, delay, attempt, opts.Reconnect)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay = min(2*delay, 30*time.Second)
+	}
+}
+
+// isSessionDrop reports whether err ended a session for reasons worth reconnecting after:
+// a lost connection or a plugin failure, rather than an interrupt or an API error such as
+// a denied permission that would only fail again.
+func isSessionDrop(err error) bool {
+	var se *exitStatusError
+	if errors.As(err, &se) && se.code == 130 {
+		return false
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "TargetNotConnected", "ThrottlingException", "InternalServerError":
+			return true
+		}
+		return false
+	}
+	return true
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"flag"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/ratelimit"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/config"
+)
+
+// defaultMaxRetries is how often a throttled or otherwise retryable API call is retried.
+// The SDK's default of two gives up too early when a large account is scanned across
+// regions, where RequestLimitExceeded is routine.
+const defaultMaxRetries = 5
+
+// maxRetryBackoff caps the delay between two attempts of a call.
+const maxRetryBackoff = 20 * time.Second
+
+// maxRetries is the --max-retries value.
+var maxRetries = defaultMaxRetries
+
+// addRetryFlags registers --max-retries. Like --debug it takes effect while the flags are
+// parsed, since every AWS configuration loaded afterwards needs it.
+func addRetryFlags(fs *flag.FlagSet) {
+	fs.IntVar(&maxRetries, "max-retries", defaultMaxRetries, "retry throttled and failed AWS API calls up to `n` times, with jittered exponential backoff")
+}
+
+// retryConfigOptions returns the SDK option that retries calls per --max-retries. The
+// standard retryer already backs off exponentially with jitter and treats the throttling
+// codes (RequestLimitExceeded, Throttling, ThrottlingException, ...) as retryable; its
+// client-side retry quota is turned off, as during a scan it runs out before the
+// throttling stops and fails calls that would have succeeded.
+func retryConfigOptions() []func(*config.LoadOptions) error {
+	return []func(*config.LoadOptions) error{
+		config.WithRetryer(func() aws.Retryer {
+			return retry.NewStandard(func(o *retry.StandardOptions) {
+				o.MaxAttempts = max(maxRetries, 0) + 1
+				o.MaxBackoff = maxRetryBackoff
+				o.RateLimiter = ratelimit.None
+			})
+		}),
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/nkarisa/homebrew-aws-ssm-connect/pkg/picker"
+	"golang.org/x/term"
+)
+
+// assumeRole replaces the credentials of cfg with temporary ones for --role-arn, assumed
+// with the profile's credentials and, with --mfa-serial, a code from the MFA device.
+func assumeRole(ctx context.Context, cfg aws.Config, opts *options) (aws.Config, error) {
+	fmt.Fprintf(os.Stderr, "Assuming role: %s\n", opts.RoleARN)
+	provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), opts.RoleARN, func(o *stscreds.AssumeRoleOptions) {
+		// The session name shows up in CloudTrail and as the owner of SSM sessions.
+		o.RoleSessionName = fmt.Sprintf("aws-ssm-connect-%d", time.Now().Unix())
+		if opts.MFASerial != "" {
+			o.SerialNumber = aws.String(opts.MFASerial)
+			o.TokenProvider = promptMFACode
+		}
+	})
+	cfg.Credentials = aws.NewCredentialsCache(provider)
+
+	// Assume the role now, so a wrong code or a missing trust relationship is reported
+	// before anything is listed.
+	if _, err := cfg.Credentials.Retrieve(ctx); err != nil {
+		return cfg, withHints(fmt.Errorf("assuming role %s: %w", opts.RoleARN, describeAPIError(err)),
+			"The role's trust policy must allow your identity to assume it.",
+			"If the role requires MFA, pass --mfa-serial with your MFA device ARN.",
+			"MFA codes are single use; wait for the next one if you just used it.")
+	}
+	return cfg, nil
+}
+
+// promptMFACode asks for the current code of the MFA device. It is also used for role
+// profiles with mfa_serial in ~/.aws/config.
+func promptMFACode() (string, error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", errors.New("an MFA code is required, but stdin is not a terminal to ask for it")
+	}
+	fmt.Fprint(os.Stderr, "Enter MFA code: ")
+	line, err := picker.Stdin.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("reading the MFA code: %w", err)
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// credentialScope names the identity a listing belongs to, for keying the inventory
+// cache: the profile, plus the SSO or assumed role and the --accounts searched, if any.
+func (o *options) credentialScope() string {
+	scope := profileName(o.Profile)
+	if o.SSOAccount != "" {
+		scope += "@" + o.SSOAccount + "-" + o.SSORole
+	}
+	if o.RoleARN != "" {
+		// arn:aws:iam::123456789012:role/Name -> <profile>@123456789012-role-Name
+		role := o.RoleARN
+		if _, rest, ok := strings.Cut(role, "::"); ok {
+			role = rest
+		}
+		scope += "@" + strings.NewReplacer(":", "-", "/", "-").Replace(role)
+	}
+	if len(o.Accounts) > 0 {
+		scope += "+" + o.accountsScope()
+	}
+	return scope
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// runRsync implements the rsync command: run rsync with its own arguments, reaching the
+// instances in them over SSH-over-SSM:
+//
+//	aws-ssm-connect rsync -- -avz --delete ./site/ web-1:/var/www/site/
+func runRsync(ctx context.Context, args []string) int {
+	return runCopyTool(ctx, "rsync", args)
+}
+
+// runSCP implements the scp command, which is to scp what the rsync command is to rsync.
+// Unlike cp, every scp flag can be passed through.
+func runSCP(ctx context.Context, args []string) int {
+	return runCopyTool(ctx, "scp", args)
+}
+
+// runCopyTool runs tool (rsync or scp) with the arguments after --, rewriting each
+// host:path whose host is an instance ID, an alias or a Name tag to user@instanceId:path
+// and adding the ssh options that go through this binary's proxy command. Unless -i is
+// given, a temporary key is pushed with EC2 Instance Connect for the login.
+func runCopyTool(ctx context.Context, tool string, args []string) int {
+	var opts options
+	var user, identity string
+	var instanceConnect bool
+	fs := newFlagSet(findCommand(tool), &opts)
+	fs.StringVar(&user, "user", defaultSSHUser, "remote `login` name, unless a path gives one (user@host:path)")
+	fs.StringVar(&identity, "i", "", "SSH private key `file` to authenticate with")
+	addInstanceConnectFlag(fs, &instanceConnect)
+	addReasonFlag(fs, &opts)
+	addDryRunFlag(fs, &opts)
+
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return flagErrorCode(err)
+	}
+	if len(positional) < 2 {
+		fs.Usage()
+		return exitUsage
+	}
+	if err := opts.applyFileConfig(); err != nil {
+		return reportError(err)
+	}
+
+	// Each host is resolved once, however many paths name it.
+	resolved := map[string]Instance{}
+	var remotes []string
+	region, keyUser := opts.Region, user
+	toolArgs := make([]string, len(positional))
+	for i, arg := range positional {
+		login, host, path, ok := splitRemotePath(arg)
+		if !ok {
+			toolArgs[i] = arg
+			continue
+		}
+		target, found := resolved[host]
+		if !found {
+			if target, err = resolveRemoteHost(ctx, &opts, host); err != nil {
+				return targetErrorCode(err, &opts)
+			}
+			if strings.HasPrefix(target.InstanceID, "ecs:") {
+				return reportError(fmt.Errorf("%s is an ECS task; SSH can't be proxied to it", target.InstanceID))
+			}
+			resolved[host] = target
+			remotes = append(remotes, target.InstanceID)
+			if target.Region != "" {
+				region = target.Region
+			}
+		}
+		if login == "" {
+			login = user
+		}
+		keyUser = login
+		toolArgs[i] = fmt.Sprintf("%s@%s:%s", login, target.InstanceID, path)
+	}
+	if len(remotes) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: no path is on an instance; write it as host:path, where host is an instance ID, alias or Name.")
+		return exitUsage
+	}
+
+	proxy, err := proxyCommand(&opts, region)
+	if err != nil {
+		return reportError(err)
+	}
+	sshArgs := []string{"-o", "ProxyCommand=" + proxy}
+	if opts.DryRun {
+		if identity != "" {
+			sshArgs = append(sshArgs, "-i", identity)
+		}
+		printDryRun(tool, append(copyToolSSHArgs(tool, sshArgs), toolArgs...)...)
+		return exitOK
+	}
+
+	switch {
+	case identity != "":
+		sshArgs = append(sshArgs, "-i", identity)
+	case instanceConnect:
+		opts.Region = region
+		cfg, err := resolveAWSConfig(ctx, &opts)
+		if err != nil {
+			return reportError(err)
+		}
+		keyArgs, cleanup := instanceConnectArgs(ctx, cfg, keyUser, remotes...)
+		defer cleanup()
+		sshArgs = append(sshArgs, keyArgs...)
+	}
+	return runExternal(ctx, tool, append(copyToolSSHArgs(tool, sshArgs), toolArgs...))
+}
+
+// copyToolSSHArgs returns the arguments that give tool the ssh options sshArgs: as they
+// are for scp, and as the remote shell (-e) for rsync, which splits it on spaces but keeps
+// double-quoted words together.
+func copyToolSSHArgs(tool string, sshArgs []string) []string {
+	if tool != "rsync" {
+		return sshArgs
+	}
+	words := []string{"ssh"}
+	for _, arg := range sshArgs {
+		if strings.ContainsAny(arg, " '\"") {
+			arg = `"` + strings.ReplaceAll(arg, `"`, `""`) + `"`
+		}
+		words = append(words, arg)
+	}
+	return []string{"-e", strings.Join(words, " ")}
+}
+
+// splitRemotePath splits an scp or rsync path of the form [user@]host:path. Local paths,
+// which have a slash before any colon, and rsync daemon paths (host::module) are not remote.
+func splitRemotePath(arg string) (login, host, path string, ok bool) {
+	if strings.HasPrefix(arg, "-") || strings.Contains(arg, "::") || strings.Contains(arg, "://") {
+		return "", "", "", false
+	}
+	host, path, ok = strings.Cut(arg, ":")
+	if !ok || host == "" || strings.Contains(host, "/") {
+		return "", "", "", false
+	}
+	if at := strings.LastIndex(host, "@"); at >= 0 {
+		login, host = host[:at], host[at+1:]
+	}
+	return login, host, path, host != ""
+}
+
+// resolveRemoteHost returns the instance host names in a path: an instance ID as is, an
+// alias's instance, or else the instance whose Name tag matches host, picked from a list
+// when several do. Aliases may set the profile and region in opts.
+func resolveRemoteHost(ctx context.Context, opts *options, host string) (Instance, error) {
+	if instanceIDPattern.MatchString(host) {
+		return Instance{InstanceID: host, Region: opts.Region}, nil
+	}
+	target, name := opts.Target, opts.Name
+	defer func() { opts.Target, opts.Name = target, name }()
+	if isAlias(host) {
+		opts.Target = host
+	} else {
+		opts.Name = host
+	}
+	_, inst, err := resolveTarget(ctx, opts)
+	return inst, err
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// runPowerShellScriptDocument is the SSM Run Command document used for .ps1 scripts.
+const runPowerShellScriptDocument = "AWS-RunPowerShellScript"
+
+// runScript implements the run command: upload a local script through SSM Run Command to
+// every picked instance, wait for each invocation, and write what every instance printed
+// to <instance>.stdout and <instance>.stderr in the output directory, with a summary table:
+//
+//	aws-ssm-connect run --script ./patch.sh --tag Env=prod --all
+//
+// Like exec, it reads the instance IDs or names to run on from stdin when that is piped.
+// The script travels inline as the command parameter, so it must fit in the document
+// parameter limit (about 64 KB), and SSM keeps only the first 24,000 characters of each
+// output stream.
+func runScript(ctx context.Context, args []string) int {
+	var opts options
+	var script, outputDir string
+	var timeout time.Duration
+	var concurrency int
+	var output commandOutput
+	fs := newFlagSet(findCommand("run"), &opts)
+	addDiscoveryFlags(fs, &opts)
+	addPickerFlags(fs, &opts)
+	fs.StringVar(&script, "script", "", "local script `file` to run; .ps1 files run with PowerShell")
+	fs.StringVar(&outputDir, "output-dir", "", "write per-instance output to this `directory` (default ssm-run-<timestamp>)")
+	fs.BoolVar(&opts.All, "all", false, "run on every matching instance without prompting")
+	fs.IntVar(&concurrency, "concurrency", defaultExecConcurrency, "run on at most `n` instances at once")
+	fs.DurationVar(&timeout, "timeout", 30*time.Minute, "give up waiting for the script after this `duration`")
+	addCommandOutputFlags(fs, &output)
+	addDryRunFlag(fs, &opts)
+
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return flagErrorCode(err)
+	}
+	if len(positional) > 0 && instanceIDPattern.MatchString(positional[0]) {
+		opts.Target, positional = positional[0], positional[1:]
+	}
+	if len(positional) > 0 || script == "" {
+		if script == "" {
+			fmt.Fprintln(os.Stderr, "Error: --script is required.")
+		}
+		fs.Usage()
+		return exitUsage
+	}
+
+	content, err := os.ReadFile(script)
+	if err != nil {
+		return reportError(fmt.Errorf("reading the script: %w", err))
+	}
+	command := remoteCommand{
+		document: runShellScriptDocument,
+		text:     string(content),
+		comment:  "aws-ssm-connect run " + filepath.Base(script),
+		output:   output,
+	}
+	if strings.EqualFold(filepath.Ext(script), ".ps1") {
+		command.document = runPowerShellScriptDocument
+	}
+
+	// Without an instance ID, --all or a target selector, pick hosts from the menu.
+	opts.Multi = !opts.All
+	opts.batchStdin = true
+	cfg, targets, err := resolveTargets(ctx, &opts)
+	if err != nil {
+		return targetErrorCode(err, &opts)
+	}
+	// The guard policy may have asked for the reason.
+	command.comment = opts.commentWithReason(command.comment)
+	if opts.DryRun {
+		if err := printSendCommandDryRun(cfg, &opts, targets, command); err != nil {
+			return reportError(err)
+		}
+		return exitOK
+	}
+
+	if outputDir == "" {
+		outputDir = "ssm-run-" + time.Now().Format("20060102-150405")
+	}
+	if err := os.MkdirAll(outputDir, 0o755); err != nil {
+		return reportError(fmt.Errorf("creating the output directory: %w", err))
+	}
+
+	fmt.Fprintf(os.Stderr, "Running %s on %d instances...\n", filepath.Base(script), len(targets))
+	results := make([]commandResult, len(targets))
+	errs := make([]error, len(targets))
+	var mu sync.Mutex
+	forEachTarget(targets, concurrency, func(i int, target Instance) {
+		stdout, stderr := streamWriters(command, "["+hostLabel(target)+"] ", &mu)
+		results[i], errs[i] = runRemoteCommand(ctx, targetConfig(ctx, cfg, &opts, target), target.InstanceID, command, timeout, stdout, stderr)
+		if errs[i] == nil {
+			errs[i] = writeScriptOutput(outputDir, target.InstanceID, results[i])
+		}
+		status := "done"
+		if errs[i] != nil {
+			status = "failed"
+		}
+		mu.Lock()
+		fmt.Fprintf(os.Stderr, "[%s] %s\n", hostLabel(target), status)
+		mu.Unlock()
+	})
+
+	summary, failed := scriptSummary(targets, results, errs)
+	fmt.Print("\n" + summary)
+	if err := os.WriteFile(filepath.Join(outputDir, "summary.txt"), []byte(summary), 0o644); err != nil {
+		return reportError(fmt.Errorf("writing the summary: %w", err))
+	}
+	fmt.Fprintf(os.Stderr, "\n%d succeeded, %d failed. Output is in %s.\n", len(targets)-failed, failed, outputDir)
+	if failed > 0 {
+		return exitError
+	}
+	return exitOK
+}
+
+// writeScriptOutput saves one instance's output streams in dir.
+func writeScriptOutput(dir, instanceID string, result commandResult) error {
+	for ext, text := range map[string]string{".stdout": result.Stdout, ".stderr": result.Stderr} {
+		if err := os.WriteFile(filepath.Join(dir, instanceID+ext), []byte(text), 0o644); err != nil {
+			return fmt.Errorf("writing output: %w", err)
+		}
+	}
+	return nil
+}
+
+// scriptSummary renders the run summary table and counts the instances that failed.
+func scriptSummary(targets []Instance, results []commandResult, errs []error) (string, int) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-20s %-24s %-5s %s\n", "INSTANCE", "NAME", "EXIT", "STATUS")
+	failed := 0
+	for i, target := range targets {
+		status, exit := strings.ToLower(results[i].Status), fmt.Sprint(results[i].ExitCode)
+		switch {
+		case errs[i] != nil:
+			status, exit = errs[i].Error(), "-"
+			failed++
+		case results[i].Status != string(ssmtypes.CommandInvocationStatusSuccess):
+			failed++
+		}
+		fmt.Fprintf(&b, "%-20s %s %-5s %s\n", target.InstanceID, padCell(target.Name, 24), exit, status)
+	}
+	return b.String(), failed
+}
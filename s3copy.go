@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// s3CopyTimeout bounds the instance's side of a cp --via-s3 transfer, and is how long the
+// presigned URL it uses stays valid.
+const s3CopyTimeout = time.Hour
+
+// copyViaS3 implements cp --via-s3, for instances that can't be reached with SSH: the file
+// goes through a temporary object in bucket. The instance fetches or uploads it with a
+// presigned URL, so it needs curl or wget (PowerShell on Windows) but no S3 permissions of
+// its own, and reports the file's SHA-256, which must match ours. The object is deleted
+// afterwards, whatever happened.
+func copyViaS3(ctx context.Context, opts *options, source, destination string, bucket commandOutput) int {
+	srcHost, srcPath, fromInstance := strings.Cut(source, ":")
+	dstHost, dstPath, toInstance := strings.Cut(destination, ":")
+	fromInstance = fromInstance && instanceIDPattern.MatchString(srcHost)
+	toInstance = toInstance && instanceIDPattern.MatchString(dstHost)
+	if fromInstance == toInstance {
+		fmt.Fprintln(os.Stderr, "Error: with --via-s3, exactly one side of the copy must be instanceId:path.")
+		return exitUsage
+	}
+	instanceID, remotePath, localPath, name := dstHost, dstPath, source, filepath.Base(source)
+	if fromInstance {
+		instanceID, remotePath, localPath, name = srcHost, srcPath, destination, path.Base(srcPath)
+	}
+
+	cfg, err := resolveAWSConfig(ctx, opts)
+	if err != nil {
+		return reportError(err)
+	}
+	key := path.Join(bucket.s3Prefix, "aws-ssm-connect-"+newTransferID(), name)
+	object := fmt.Sprintf("s3://%s/%s", bucket.s3Bucket, key)
+
+	if opts.DryRun {
+		if fromInstance {
+			fmt.Printf("Would have %s upload %s to %s, then download it to %s.\n", instanceID, remotePath, object, localPath)
+		} else {
+			fmt.Printf("Would upload %s to %s, then have %s download it to %s.\n", localPath, object, instanceID, remotePath)
+		}
+		return exitOK
+	}
+
+	// The platform decides between a shell and a PowerShell script.
+	target := Instance{InstanceID: instanceID, Region: cfg.Region}
+	if strings.HasPrefix(instanceID, "i-") {
+		found, err := listInstancesWithSSMStatus(ctx, cfg, []types.Filter{
+			{Name: aws.String("instance-id"), Values: []string{instanceID}},
+		}, nil, nil)
+		if err != nil {
+			return reportError(err)
+		}
+		if len(found) == 1 {
+			target = found[0]
+		}
+	}
+	if err := checkGuard(ctx, cfg, opts, []Instance{target}); err != nil {
+		return targetErrorCode(err, opts)
+	}
+
+	client := s3.NewFromConfig(cfg)
+	defer func() {
+		// A fresh context, so an interrupted copy still cleans up.
+		if _, err := client.DeleteObject(context.Background(), &s3.DeleteObjectInput{Bucket: aws.String(bucket.s3Bucket), Key: aws.String(key)}); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: deleting %s: %v\n", object, describeAPIError(err))
+		}
+	}()
+	if fromInstance {
+		err = copyFromInstanceViaS3(ctx, cfg, client, target, remotePath, localPath, bucket.s3Bucket, key)
+	} else {
+		err = copyToInstanceViaS3(ctx, cfg, client, target, localPath, remotePath, bucket.s3Bucket, key)
+	}
+	if err != nil {
+		return reportError(err)
+	}
+	return exitOK
+}
+
+// copyToInstanceViaS3 uploads the local file to bucket/key and has the instance download it
+// to remotePath (into it, if it is a directory).
+func copyToInstanceViaS3(ctx context.Context, cfg aws.Config, client *s3.Client, target Instance, localPath, remotePath, bucket, key string) error {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	sum, err := fileSHA256(file)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", localPath, err)
+	}
+
+	fmt.Printf("Uploading %s to s3://%s/%s...\n", localPath, bucket, key)
+	if _, err := client.PutObject(ctx, &s3.PutObjectInput{Bucket: aws.String(bucket), Key: aws.String(key), Body: file}); err != nil {
+		return withHints(fmt.Errorf("uploading to s3://%s/%s: %w", bucket, key, describeAPIError(err)),
+			"You are not allowed to call s3:PutObject on the bucket.")
+	}
+	url, err := s3.NewPresignClient(client).PresignGetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)},
+		s3.WithPresignExpires(s3CopyTimeout))
+	if err != nil {
+		return fmt.Errorf("presigning s3://%s/%s: %w", bucket, key, err)
+	}
+
+	name := filepath.Base(localPath)
+	command := remoteCommand{document: runShellScriptDocument, comment: "aws-ssm-connect cp --via-s3"}
+	if target.IsWindows() {
+		command.document = runPowerShellScriptDocument
+		command.text = fmt.Sprintf("$ErrorActionPreference = 'Stop'; $dest = %s; if (Test-Path -PathType Container $dest) { $dest = Join-Path $dest %s }; "+
+			"Invoke-WebRequest -UseBasicParsing -Uri %s -OutFile $dest; (Get-FileHash -Algorithm SHA256 $dest).Hash",
+			powerShellQuote(remotePath), powerShellQuote(name), powerShellQuote(url.URL))
+	} else {
+		command.text = fmt.Sprintf("set -e; dest=%s; if [ -d \"$dest\" ]; then dest=\"$dest/\"%s; fi; "+
+			"if command -v curl >/dev/null; then curl -fsS -o \"$dest\" %s; else wget -q -O \"$dest\" %s; fi; sha256sum \"$dest\"",
+			shellQuote(remotePath), shellQuote(name), shellQuote(url.URL), shellQuote(url.URL))
+	}
+	fmt.Printf("Downloading it on %s to %s...\n", target.InstanceID, remotePath)
+	remoteSum, err := runTransferCommand(ctx, cfg, target.InstanceID, command)
+	if err != nil {
+		return err
+	}
+	if remoteSum != sum {
+		return fmt.Errorf("checksum mismatch: %s has SHA-256 %s, the copy on %s has %s", localPath, sum, target.InstanceID, remoteSum)
+	}
+	fmt.Printf("Copied %s to %s:%s (SHA-256 verified).\n", localPath, target.InstanceID, remotePath)
+	return nil
+}
+
+// copyFromInstanceViaS3 has the instance upload remotePath to bucket/key and downloads it
+// to localPath (into it, if it is a directory).
+func copyFromInstanceViaS3(ctx context.Context, cfg aws.Config, client *s3.Client, target Instance, remotePath, localPath, bucket, key string) error {
+	url, err := s3.NewPresignClient(client).PresignPutObject(ctx, &s3.PutObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)},
+		s3.WithPresignExpires(s3CopyTimeout))
+	if err != nil {
+		return fmt.Errorf("presigning s3://%s/%s: %w", bucket, key, err)
+	}
+	command := remoteCommand{document: runShellScriptDocument, comment: "aws-ssm-connect cp --via-s3"}
+	if target.IsWindows() {
+		command.document = runPowerShellScriptDocument
+		command.text = fmt.Sprintf("$ErrorActionPreference = 'Stop'; Invoke-WebRequest -UseBasicParsing -Method Put -InFile %s -Uri %s | Out-Null; "+
+			"(Get-FileHash -Algorithm SHA256 %s).Hash", powerShellQuote(remotePath), powerShellQuote(url.URL), powerShellQuote(remotePath))
+	} else {
+		command.text = fmt.Sprintf("set -e; if command -v curl >/dev/null; then curl -fsS -T %s %s; else wget -q -O /dev/null --method=PUT --body-file=%s %s; fi; sha256sum %s",
+			shellQuote(remotePath), shellQuote(url.URL), shellQuote(remotePath), shellQuote(url.URL), shellQuote(remotePath))
+	}
+	fmt.Printf("Uploading %s on %s to s3://%s/%s...\n", remotePath, target.InstanceID, bucket, key)
+	remoteSum, err := runTransferCommand(ctx, cfg, target.InstanceID, command)
+	if err != nil {
+		return err
+	}
+
+	if info, err := os.Stat(localPath); err == nil && info.IsDir() {
+		localPath = filepath.Join(localPath, path.Base(remotePath))
+	}
+	fmt.Printf("Downloading it to %s...\n", localPath)
+	out, err := client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		return withHints(fmt.Errorf("downloading s3://%s/%s: %w", bucket, key, describeAPIError(err)),
+			"You are not allowed to call s3:GetObject on the bucket.")
+	}
+	defer out.Body.Close()
+	file, err := os.Create(localPath)
+	if err != nil {
+		return err
+	}
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(file, hash), out.Body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("writing %s: %w", localPath, err)
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != remoteSum {
+		os.Remove(localPath)
+		return fmt.Errorf("checksum mismatch: %s:%s has SHA-256 %s, the download has %s", target.InstanceID, remotePath, remoteSum, sum)
+	}
+	fmt.Printf("Copied %s:%s to %s (SHA-256 verified).\n", target.InstanceID, remotePath, localPath)
+	return nil
+}
+
+// runTransferCommand runs a transfer command on the instance and returns the SHA-256 it
+// printed last, in lower case.
+func runTransferCommand(ctx context.Context, cfg aws.Config, instanceID string, command remoteCommand) (string, error) {
+	result, err := runRemoteCommand(ctx, cfg, instanceID, command, s3CopyTimeout, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	if result.Status != string(ssmtypes.CommandInvocationStatusSuccess) {
+		return "", fmt.Errorf("the transfer on %s %s (exit code %d): %s", instanceID, strings.ToLower(result.Status), result.ExitCode,
+			strings.TrimSpace(result.Stderr))
+	}
+	lines := strings.Fields(strings.TrimSpace(result.Stdout))
+	for i := len(lines) - 1; i >= 0; i-- {
+		if sum := strings.ToLower(lines[i]); len(sum) == sha256.Size*2 {
+			if _, err := hex.DecodeString(sum); err == nil {
+				return sum, nil
+			}
+		}
+	}
+	return "", errors.New("the instance did not report the file's checksum")
+}
+
+// fileSHA256 returns the hex SHA-256 of file's contents and rewinds it.
+func fileSHA256(file *os.File) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// powerShellQuote quotes s as a PowerShell literal string.
+func powerShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// newTransferID returns a random name for the temporary object of one transfer.
+func newTransferID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2instanceconnect"
+)
+
+// runSerial implements the serial command: connect to an instance's serial console through
+// EC2 Instance Connect. Unlike every other command it needs neither the SSM Agent nor a
+// working network on the instance, so it is the way in when those are broken.
+//
+// The console requires a Nitro instance type, serial console access enabled for the
+// account, and an OS user with a password to log in with.
+func runSerial(ctx context.Context, args []string) int {
+	var opts options
+	var port int
+	fs := newFlagSet(findCommand("serial"), &opts)
+	addDiscoveryFlags(fs, &opts)
+	addPickerFlags(fs, &opts)
+	fs.IntVar(&port, "port", 0, "serial `port` to connect to (only 0 is supported by EC2 today)")
+	addDryRunFlag(fs, &opts)
+
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return flagErrorCode(err)
+	}
+	if len(positional) > 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	if len(positional) == 1 {
+		opts.Target = positional[0]
+	}
+
+	fmt.Println(banner)
+	cfg, target, err := resolveTarget(ctx, &opts)
+	if err != nil {
+		return targetErrorCode(err, &opts)
+	}
+	host := serialConsoleHost(target.InstanceID, port, cfg.Region)
+	if opts.DryRun {
+		printDryRun("aws", append([]string{"ec2-instance-connect", "send-serial-console-ssh-public-key",
+			"--instance-id", target.InstanceID,
+			"--serial-port", fmt.Sprint(port),
+			"--ssh-public-key", "file://KEY.pub"}, awsCLIArgs(cfg, &opts)...)...)
+		printDryRun("ssh", "-i", "KEY", host)
+		return exitOK
+	}
+	if err := checkSerialConsoleAccess(ctx, cfg); err != nil {
+		return reportError(err)
+	}
+
+	key, err := newTemporaryKey()
+	if err != nil {
+		return reportError(err)
+	}
+	defer key.remove()
+	_, err = ec2instanceconnect.NewFromConfig(cfg).SendSerialConsoleSSHPublicKey(ctx, &ec2instanceconnect.SendSerialConsoleSSHPublicKeyInput{
+		InstanceId:   aws.String(target.InstanceID),
+		SerialPort:   int32(port),
+		SSHPublicKey: aws.String(key.public),
+	})
+	if err != nil {
+		return reportError(withHints(fmt.Errorf("sending an SSH key to the serial console of %s: %w", target.InstanceID, describeAPIError(err)),
+			"The serial console only works on Nitro-based instance types (and bare metal).",
+			"You are not allowed to call ec2-instance-connect:SendSerialConsoleSSHPublicKey on the instance.",
+			"Only one session per serial port is allowed; someone may already be connected."))
+	}
+
+	recordHistory(&opts, target)
+	fmt.Printf("\nConnecting to the serial console of %s. Press Enter for a login prompt; type ~. to disconnect.\n", target.InstanceID)
+	return runExternal(ctx, "ssh", []string{"-i", key.path, "-o", "IdentitiesOnly=yes", host})
+}
+
+// serialConsoleHost returns the ssh destination of an instance's serial console port.
+func serialConsoleHost(instanceID string, port int, region string) string {
+	return fmt.Sprintf("%s.port%d@serial-console.ec2-instance-connect.%s.aws", instanceID, port, region)
+}
+
+// checkSerialConsoleAccess fails if serial console access is turned off for the account in
+// cfg's region. If the status can't be read the check is skipped, as connecting will tell.
+func checkSerialConsoleAccess(ctx context.Context, cfg aws.Config) error {
+	out, err := ec2.NewFromConfig(cfg).GetSerialConsoleAccessStatus(ctx, &ec2.GetSerialConsoleAccessStatusInput{})
+	if err != nil {
+		debugf("serial console access status: %v", err)
+		return nil
+	}
+	if !aws.ToBool(out.SerialConsoleAccessEnabled) {
+		return withHints(fmt.Errorf("EC2 serial console access is disabled for this account in %s", cfg.Region),
+			fmt.Sprintf("An administrator can enable it with 'aws ec2 enable-serial-console-access --region %s'.", cfg.Region))
+	}
+	return nil
+}
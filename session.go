@@ -0,0 +1,480 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/nkarisa/homebrew-aws-ssm-connect/pkg/inventory"
+	"github.com/nkarisa/homebrew-aws-ssm-connect/pkg/session"
+	"golang.org/x/term"
+)
+
+// SSM documents used for the port forwarding mode.
+const (
+	portForwardingDocument       = "AWS-StartPortForwardingSession"
+	portForwardingRemoteDocument = "AWS-StartPortForwardingSessionToRemoteHost"
+	sshSessionDocument           = "AWS-StartSSHSession"
+	interactiveCommandDocument   = "AWS-StartInteractiveCommand"
+)
+
+// portForward describes a -L style forwarding spec: localPort[:remoteHost]:remotePort.
+// An empty RemoteHost forwards to a port on the instance itself.
+type portForward struct {
+	LocalPort  int
+	RemoteHost string
+	RemotePort int
+}
+
+// parsePortForward parses "5432:db.internal:5432" or "8080:80" into a portForward. A local
+// port of 0 is resolved to a free one by assignLocalPorts.
+func parsePortForward(spec string) (portForward, error) {
+	if spec == "" {
+		return portForward{}, fmt.Errorf("missing -L localPort:remoteHost:remotePort")
+	}
+
+	parts := strings.Split(spec, ":")
+	var localPart, host, remotePart string
+	switch len(parts) {
+	case 2:
+		localPart, remotePart = parts[0], parts[1]
+	case 3:
+		localPart, host, remotePart = parts[0], parts[1], parts[2]
+	default:
+		return portForward{}, fmt.Errorf("invalid forward spec '%s': expected localPort:remoteHost:remotePort", spec)
+	}
+
+	// A local port of 0 means any free port, as with net.Listen.
+	localPort := 0
+	if localPart != "0" {
+		var err error
+		if localPort, err = parsePort(localPart); err != nil {
+			return portForward{}, fmt.Errorf("invalid local port in '%s': %w", spec, err)
+		}
+	}
+	remotePort, err := parsePort(remotePart)
+	if err != nil {
+		return portForward{}, fmt.Errorf("invalid remote port in '%s': %w", spec, err)
+	}
+	return portForward{LocalPort: localPort, RemoteHost: host, RemotePort: remotePort}, nil
+}
+
+// assignLocalPorts gives every forward a usable local port: forwards asking for port 0 get
+// a free one, and so do those whose port is already taken, with a note saying so, rather
+// than failing later with the plugin's bind error.
+func assignLocalPorts(forwards []portForward) error {
+	for i := range forwards {
+		requested := forwards[i].LocalPort
+		if requested != 0 && localPortFree(requested) {
+			continue
+		}
+		port, err := freeLocalPort()
+		if err != nil {
+			return err
+		}
+		forwards[i].LocalPort = port
+		if requested != 0 {
+			fmt.Fprintf(os.Stderr, "Local port %d is in use; using %d instead.\n", requested, port)
+		}
+	}
+	return nil
+}
+
+// localPortFree reports whether the port can be listened on at localhost.
+func localPortFree(port int) bool {
+	l, err := net.Listen("tcp", net.JoinHostPort("localhost", strconv.Itoa(port)))
+	if err != nil {
+		return false
+	}
+	l.Close()
+	return true
+}
+
+// String returns the forward in the -L syntax parsePortForward accepts.
+func (f portForward) String() string {
+	if f.RemoteHost == "" {
+		return fmt.Sprintf("%d:%d", f.LocalPort, f.RemotePort)
+	}
+	return fmt.Sprintf("%d:%s:%d", f.LocalPort, f.RemoteHost, f.RemotePort)
+}
+
+// parseDocumentParameters turns repeated --parameter key=value arguments into session
+// document parameters. Repeating a key adds to its list of values.
+func parseDocumentParameters(params []string) (map[string][]string, error) {
+	parsed := map[string][]string{}
+	for _, param := range params {
+		key, value, ok := strings.Cut(param, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid parameter '%s': expected key=value", param)
+		}
+		parsed[key] = append(parsed[key], value)
+	}
+	return parsed, nil
+}
+
+// parsePort validates a TCP port number.
+func parsePort(s string) (int, error) {
+	port, err := strconv.Atoi(s)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("'%s' is not a valid port number", s)
+	}
+	return port, nil
+}
+
+// startSSMSession starts an interactive shell session on the selected instance, using
+// the configured session document or, when empty, the account's default
+// (SSM-SessionManagerRunShell), which opens PowerShell on Windows instances. With
+// --log-session the output is also written to a transcript, and with --record to an
+// asciicast recording.
+//
+// With --user the shell is a login shell of that user, started through sudo from an
+// interactive command session. Session Manager's own Run As support is an account-wide
+// preference keyed on IAM tags, so it can't be chosen per session.
+func startSSMSession(ctx context.Context, cfg aws.Config, opts *options, target Instance) error {
+	instanceID := target.InstanceID
+	if target.IsWindows() && opts.User != "" {
+		return withHints(fmt.Errorf("--user can't be used with the Windows instance %s: it starts the shell with sudo", instanceID),
+			"Use 'aws-ssm-connect rdp "+instanceID+"' to log on as another user.")
+	}
+	input, err := shellSessionInput(opts, instanceID)
+	if err != nil {
+		return err
+	}
+	if opts.DryRun {
+		return printStartSessionDryRun(cfg, opts, input)
+	}
+
+	fmt.Printf("\nAttempting to start SSM session for Instance ID: %s...\n", instanceID)
+	if opts.User != "" {
+		fmt.Printf("Starting a login shell as %s.\n", opts.User)
+	}
+	if target.Lifecycle == inventory.LifecycleSpot {
+		fmt.Printf("Note: %s is a spot instance; EC2 may reclaim it during the session, with two minutes' notice.\n", instanceID)
+	}
+	if target.IsWindows() && opts.Document == "" {
+		fmt.Printf("This is a Windows instance: the session opens PowerShell. For the desktop, use 'aws-ssm-connect rdp %s'.\n", instanceID)
+	}
+	var stdout io.Writer = os.Stdout
+	if opts.LogSession {
+		transcript, err := openTranscript(instanceID)
+		if err != nil {
+			return err
+		}
+		defer transcript.Close()
+		fmt.Printf("Logging session to %s\n", transcript.Name())
+		stdout = io.MultiWriter(os.Stdout, transcript)
+	}
+	if opts.Record != "" {
+		recording, err := openRecording(opts.Record, instanceID)
+		if err != nil {
+			return err
+		}
+		defer recording.Close()
+		fmt.Printf("Recording session to %s\n", recording.Name())
+		stdout = io.MultiWriter(stdout, recording)
+	}
+
+	err = withReconnect(ctx, opts, instanceID, func() error {
+		return runSession(ctx, cfg, opts, input, stdout)
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Println("\nSSM Session terminated successfully.")
+	return nil
+}
+
+// shellSessionInput returns the StartSession request for an interactive shell on
+// instanceID with the session document, --user and --parameter options.
+func shellSessionInput(opts *options, instanceID string) (*ssm.StartSessionInput, error) {
+	input := &ssm.StartSessionInput{Target: aws.String(instanceID)}
+	switch {
+	case opts.User != "" && opts.Document != "":
+		return nil, fmt.Errorf("--user can't be combined with the custom session document %s", opts.Document)
+	case opts.User != "":
+		input.DocumentName = aws.String(interactiveCommandDocument)
+		input.Parameters = map[string][]string{"command": {"sudo -iu " + shellQuote(opts.User)}}
+	case opts.Document != "":
+		input.DocumentName = aws.String(opts.Document)
+	}
+	if len(opts.Parameters) > 0 {
+		params, err := parseDocumentParameters(opts.Parameters)
+		if err != nil {
+			return nil, err
+		}
+		if input.Parameters == nil {
+			input.Parameters = params
+		} else {
+			for key, values := range params {
+				input.Parameters[key] = append(input.Parameters[key], values...)
+			}
+		}
+	}
+	return input, nil
+}
+
+// startPortForwardSession tunnels a local port through the selected instance, either to a
+// port on the instance itself or to a remote host reachable from it (e.g. an RDS endpoint).
+func startPortForwardSession(ctx context.Context, cfg aws.Config, opts *options, instanceID string, forward portForward) error {
+	input := &ssm.StartSessionInput{
+		Target: aws.String(instanceID),
+		Parameters: map[string][]string{
+			"portNumber":      {strconv.Itoa(forward.RemotePort)},
+			"localPortNumber": {strconv.Itoa(forward.LocalPort)},
+		},
+	}
+
+	destination := fmt.Sprintf("%s:%d", instanceID, forward.RemotePort)
+	if forward.RemoteHost != "" {
+		input.DocumentName = aws.String(portForwardingRemoteDocument)
+		input.Parameters["host"] = []string{forward.RemoteHost}
+		destination = fmt.Sprintf("%s:%d (via %s)", forward.RemoteHost, forward.RemotePort, instanceID)
+	} else {
+		input.DocumentName = aws.String(portForwardingDocument)
+	}
+	if opts.DryRun {
+		return printStartSessionDryRun(cfg, opts, input)
+	}
+
+	fmt.Printf("\nForwarding localhost:%d -> %s. Press Ctrl+C to stop.\n", forward.LocalPort, destination)
+	err := withReconnect(ctx, opts, instanceID, func() error {
+		return runSession(ctx, cfg, opts, input, os.Stdout)
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Println("\nPort forwarding session terminated.")
+	return nil
+}
+
+// startPortForwardSessions runs one port forwarding session per forward concurrently, all
+// through the same instance. They share a lifecycle: when one ends, the others are closed
+// too, so a half-working set of tunnels is never left behind.
+func startPortForwardSessions(ctx context.Context, cfg aws.Config, opts *options, instanceID string, forwards []portForward) error {
+	if len(forwards) == 1 || opts.DryRun {
+		for _, forward := range forwards {
+			if err := startPortForwardSession(ctx, cfg, opts, instanceID, forward); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errs := make(chan error, len(forwards))
+	for _, forward := range forwards {
+		go func(forward portForward) {
+			err := startPortForwardSession(ctx, cfg, opts, instanceID, forward)
+			switch {
+			case err != nil && ctx.Err() != nil:
+				err = nil // Closed because another forward ended first.
+			case err != nil:
+				err = fmt.Errorf("forward %s: %w", forward, err)
+			}
+			errs <- err
+			cancel()
+		}(forward)
+	}
+
+	var firstErr error
+	for range forwards {
+		if err := <-errs; err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// startProxySession pipes an SSH connection to the instance over stdin/stdout, for use as
+// an OpenSSH ProxyCommand. Nothing but the SSH stream may be written to stdout here.
+func startProxySession(ctx context.Context, cfg aws.Config, opts *options, instanceID string, port int) error {
+	input := &ssm.StartSessionInput{
+		Target:       aws.String(instanceID),
+		DocumentName: aws.String(sshSessionDocument),
+		Parameters: map[string][]string{
+			"portNumber": {strconv.Itoa(port)},
+		},
+	}
+
+	return runSession(ctx, cfg, opts, input, os.Stdout)
+}
+
+// runSession calls the SSM StartSession API and hands the returned stream URL and token
+// to the session-manager-plugin, exactly as the AWS CLI does. It blocks until the plugin exits.
+// The plugin's output goes to stdout; its input and errors use the terminal directly.
+// With --native, or when the plugin is not installed, shells and SSH proxy sessions are
+// relayed by the built-in client instead. Every attempt is recorded in the audit log.
+func runSession(ctx context.Context, cfg aws.Config, opts *options, input *ssm.StartSessionInput, stdout io.Writer) (err error) {
+	opts.applyReason(input)
+	started := time.Now()
+	var sessionID string
+	defer func() { recordAudit(ctx, cfg, opts, input, sessionID, started, err) }()
+
+	// Fail early if the plugin is missing and needed, before a session is opened on the instance.
+	pluginPath, err := executor.LookPath(session.PluginName)
+	native := opts.Native || err != nil
+	if native && isPortForwardingDocument(aws.ToString(input.DocumentName)) {
+		return withKind(kindMissingTool, withHints(fmt.Errorf("port forwarding needs %s, which was not found in your PATH", session.PluginName),
+			"Install it from https://docs.aws.amazon.com/systems-manager/latest/userguide/session-manager-working-with-install-plugin.html"))
+	}
+
+	client := newSessionClient(cfg)
+	output, err := client.StartSession(ctx, input)
+	if isTargetNotConnected(err) && opts.Wait {
+		if err := waitForAgent(ctx, cfg, aws.ToString(input.Target), startTimeout); err != nil {
+			return err
+		}
+		output, err = client.StartSession(ctx, input)
+	}
+	if err != nil {
+		hints := []string{
+			"The instance is not running or the SSM Agent is unhealthy.",
+			"The instance's IAM role lacks the necessary SSM permissions (e.g., AmazonSSMManagedInstanceCore).",
+			"You are not allowed to call ssm:StartSession on the instance.",
+		}
+		if isTargetNotConnected(err) {
+			hints = append(hints, "If the instance is still booting, pass --wait to connect once its agent is online.")
+		}
+		return withHints(fmt.Errorf("starting SSM session: %w", describeAPIError(err)), hints...)
+	}
+	sessionID = aws.ToString(output.SessionId)
+	notifyEnd := notifySessionStart(ctx, cfg, opts, input, output)
+	defer notifyEnd()
+
+	if native {
+		terminal := aws.ToString(input.DocumentName) != sshSessionDocument && term.IsTerminal(int(os.Stdin.Fd()))
+		err := runNativeSession(ctx, cfg, output, aws.ToString(input.Target), os.Stdin, stdout, os.Stderr, terminal)
+		// Harmless if the agent already closed the session; required if we are the side hanging up.
+		client.TerminateSession(context.WithoutCancel(ctx), &ssm.TerminateSessionInput{SessionId: output.SessionId})
+		return err
+	}
+
+	args, err := session.PluginArgs(ctx, cfg, opts.Profile, input, output)
+	if err != nil {
+		return err
+	}
+	// The session response carries the stream token, so it is left out of the debug log.
+	debugCommand(pluginPath, append([]string{"<session>"}, args[1:]...))
+
+	// Crucial: Connect the plugin's I/O to the current process's I/O
+	// This allows the user to interact with the SSM session directly.
+	plugin, err := executor.Start(pluginPath, args, os.Stdin, stdout, os.Stderr, false)
+	if err != nil {
+		client.TerminateSession(ctx, &ssm.TerminateSessionInput{SessionId: output.SessionId})
+		return err
+	}
+	// Wait for the plugin to complete, relaying signals meanwhile
+	stopRelay := relaySignals(plugin)
+	// Cancelling ctx, e.g. when another forward of the same invocation ended, closes the
+	// session the way a signal would.
+	stopOnCancel := context.AfterFunc(ctx, func() { stopProcess(plugin.Pid()) })
+	err = plugin.Wait()
+	stopOnCancel()
+	stopRelay()
+	if err != nil {
+		// The exit code of the SSM session is propagated
+		if code, ok := exitCode(err); ok {
+			return &exitStatusError{
+				err:  fmt.Errorf("session terminated with exit code: %d", code),
+				code: code,
+			}
+		}
+		// The plugin never took ownership of the session, so close it ourselves.
+		client.TerminateSession(ctx, &ssm.TerminateSessionInput{SessionId: output.SessionId})
+		return err
+	}
+	return nil
+}
+
+// runNativeSession relays a started session with the built-in client (session.RunNative),
+// explaining its failures.
+func runNativeSession(ctx context.Context, cfg aws.Config, output *ssm.StartSessionOutput, target string, stdin io.Reader, stdout, stderr io.Writer, terminal bool) error {
+	session.Logf = debugf
+	err := session.RunNative(ctx, cfg, output, target, stdin, stdout, stderr, terminal)
+	var keyErr *session.KeyError
+	switch {
+	case errors.Is(err, session.ErrInterrupted):
+		// Exit like a shell killed by Ctrl+C would.
+		return &exitStatusError{err: err, code: 130}
+	case errors.Is(err, session.ErrDataChannel):
+		return withHints(err, "Outbound HTTPS to ssmmessages."+cfg.Region+"."+regionDNSSuffix(cfg.Region)+" is blocked.")
+	case errors.As(err, &keyErr):
+		return withHints(fmt.Errorf("generating the session data key: %w", describeAPIError(keyErr.Err)),
+			"Session encryption is enabled and you are not allowed to call kms:GenerateDataKey on "+keyErr.KeyID+".")
+	}
+	return err
+}
+
+// relaySignals forwards signals to the plugin while it runs, and keeps Ctrl+C from killing
+// this process before the plugin has closed the session; otherwise the session would be
+// orphaned and the terminal left in whatever mode the plugin had set. Call the returned
+// function once the plugin has exited.
+func relaySignals(p process) (stop func()) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, append([]os.Signal{os.Interrupt}, forwardedSignals...)...)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case sig := <-sigs:
+				if sig != os.Interrupt {
+					p.Signal(sig)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(sigs)
+		close(done)
+	}
+}
+
+// isTargetNotConnected reports whether StartSession failed because the instance's SSM
+// agent is not connected, as happens while it boots.
+func isTargetNotConnected(err error) bool {
+	var notConnected *ssmtypes.TargetNotConnected
+	return errors.As(err, &notConnected)
+}
+
+// isPortForwardingDocument reports whether a session document forwards to a local listener,
+// which only the plugin supports.
+func isPortForwardingDocument(name string) bool {
+	return name == portForwardingDocument || name == portForwardingRemoteDocument
+}
+
+// openTranscript creates a timestamped session transcript under ~/.aws-ssm-connect/logs.
+// Only the session output is captured; since the remote shell echoes what is typed, that
+// includes the commands run.
+func openTranscript(instanceID string) (*os.File, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("locating home directory for session logs: %w", err)
+	}
+	dir := filepath.Join(home, ".aws-ssm-connect", "logs")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("creating session log directory: %w", err)
+	}
+
+	now := time.Now()
+	path := filepath.Join(dir, fmt.Sprintf("%s-%s.log", now.Format("20060102-150405"), instanceID))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("creating session log: %w", err)
+	}
+	fmt.Fprintf(f, "# aws-ssm-connect session to %s started %s\n", instanceID, now.Format(time.RFC3339))
+	return f, nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/nkarisa/homebrew-aws-ssm-connect/pkg/session"
+)
+
+func TestRunSession(t *testing.T) {
+	shell := &ssm.StartSessionInput{Target: aws.String("i-0aaa1111aaaa1111a")}
+	forward := &ssm.StartSessionInput{
+		Target:       aws.String("i-0aaa1111aaaa1111a"),
+		DocumentName: aws.String(portForwardingDocument),
+		Parameters:   map[string][]string{"portNumber": {"5432"}, "localPortNumber": {"15432"}},
+	}
+	started := &ssm.StartSessionOutput{
+		SessionId:  aws.String("alice-0123456789abcdef0"),
+		TokenValue: aws.String("token"),
+		StreamUrl:  aws.String("wss://ssmmessages.us-east-1.amazonaws.com/v1/data-channel/alice-0123456789abcdef0"),
+	}
+	tests := []struct {
+		name          string
+		input         *ssm.StartSessionInput
+		client        *fakeSessionClient
+		executor      *fakeExecutor
+		wantCode      int  // exit status carried by the error, 0 for none
+		wantErr       bool // other than an exit status
+		wantKind      *errorKind
+		wantPlugin    bool
+		wantTerminate bool
+	}{
+		{
+			name:       "plugin exits cleanly",
+			input:      shell,
+			client:     &fakeSessionClient{output: started},
+			executor:   &fakeExecutor{},
+			wantPlugin: true,
+		},
+		{
+			name:       "remote exit code is propagated",
+			input:      shell,
+			client:     &fakeSessionClient{output: started},
+			executor:   &fakeExecutor{responses: map[string]fakeResponse{session.PluginName: {code: 3}}},
+			wantCode:   3,
+			wantPlugin: true,
+		},
+		{
+			name:          "plugin fails to start",
+			input:         shell,
+			client:        &fakeSessionClient{output: started},
+			executor:      &fakeExecutor{responses: map[string]fakeResponse{session.PluginName: {startErr: errors.New("exec format error")}}},
+			wantErr:       true,
+			wantPlugin:    true,
+			wantTerminate: true,
+		},
+		{
+			name:     "session refused",
+			input:    shell,
+			client:   &fakeSessionClient{err: errors.New("AccessDeniedException")},
+			executor: &fakeExecutor{},
+			wantErr:  true,
+		},
+		{
+			name:     "port forwarding without the plugin",
+			input:    forward,
+			client:   &fakeSessionClient{output: started},
+			executor: &fakeExecutor{missing: []string{session.PluginName}},
+			wantErr:  true,
+			wantKind: kindMissingTool,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("XDG_STATE_HOME", t.TempDir())
+			useExecutor(t, tt.executor)
+			useSessionClient(t, tt.client)
+
+			err := runSession(context.Background(), testConfig(), &options{Profile: "dev"}, tt.input, nil)
+			var exitErr *exitStatusError
+			switch {
+			case tt.wantCode != 0:
+				if !errors.As(err, &exitErr) || exitErr.code != tt.wantCode {
+					t.Errorf("runSession = %v, want exit status %d", err, tt.wantCode)
+				}
+			case tt.wantErr:
+				if err == nil || errors.As(err, &exitErr) {
+					t.Errorf("runSession = %v, want an error", err)
+				}
+			case err != nil:
+				t.Errorf("runSession = %v", err)
+			}
+			if tt.wantKind != nil && errorKindOf(err) != tt.wantKind {
+				t.Errorf("error kind = %v, want %s", errorKindOf(err), tt.wantKind.name)
+			}
+
+			if tt.wantPlugin != (len(tt.executor.calls) == 1) {
+				t.Fatalf("plugin calls = %q, want plugin run: %v", tt.executor.calls, tt.wantPlugin)
+			}
+			if tt.wantPlugin {
+				checkPluginArgs(t, tt.executor.calls[0], tt.input, started)
+			}
+			if want := []string{"alice-0123456789abcdef0"}; tt.wantTerminate != slices.Equal(tt.client.terminated, want) {
+				t.Errorf("terminated sessions = %q, want terminated: %v", tt.client.terminated, tt.wantTerminate)
+			}
+		})
+	}
+}
+
+// checkPluginArgs checks the plugin was handed the session as the AWS CLI hands it over.
+func checkPluginArgs(t *testing.T, call []string, input *ssm.StartSessionInput, output *ssm.StartSessionOutput) {
+	t.Helper()
+	if len(call) != 7 || call[0] != session.PluginName {
+		t.Fatalf("plugin call = %q", call)
+	}
+	var response map[string]string
+	if err := json.Unmarshal([]byte(call[1]), &response); err != nil || response["SessionId"] != aws.ToString(output.SessionId) ||
+		response["TokenValue"] != aws.ToString(output.TokenValue) || response["StreamUrl"] != aws.ToString(output.StreamUrl) {
+		t.Errorf("session argument = %s", call[1])
+	}
+	if call[2] != "us-east-1" || call[3] != "StartSession" || call[4] != "dev" {
+		t.Errorf("region, operation and profile = %q", call[2:5])
+	}
+	var request struct{ Target string }
+	if err := json.Unmarshal([]byte(call[5]), &request); err != nil || request.Target != aws.ToString(input.Target) {
+		t.Errorf("request argument = %s", call[5])
+	}
+}
+
+// testConfig returns a configuration whose calls fail at once, for the ones made on the
+// side, such as the caller identity of the audit log.
+func testConfig() aws.Config {
+	return aws.Config{
+		Region:       "us-east-1",
+		Credentials:  aws.AnonymousCredentials{},
+		BaseEndpoint: aws.String("http://127.0.0.1:1"),
+		Retryer:      func() aws.Retryer { return aws.NopRetryer{} },
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// runSFTP implements the sftp command: pick an instance as for connect and open an
+// interactive sftp session to it over SSH-over-SSM, for browsing and moving files rather
+// than typing shell commands:
+//
+//	aws-ssm-connect sftp --tag Role=web --dir /var/log
+//
+// Unless -i is given or --instance-connect is off, a temporary key is pushed with EC2
+// Instance Connect.
+func runSFTP(ctx context.Context, args []string) int {
+	var opts options
+	var user, identity, dir string
+	var instanceConnect bool
+	fs := newFlagSet(findCommand("sftp"), &opts)
+	addDiscoveryFlags(fs, &opts)
+	addPickerFlags(fs, &opts)
+	fs.StringVar(&user, "user", defaultSSHUser, "remote `login` name")
+	fs.StringVar(&identity, "i", "", "SSH private key `file` to authenticate with")
+	fs.StringVar(&dir, "dir", "", "start in this remote `directory` instead of the login's home")
+	addInstanceConnectFlag(fs, &instanceConnect)
+	addDryRunFlag(fs, &opts)
+
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return flagErrorCode(err)
+	}
+	if len(positional) > 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	if len(positional) == 1 {
+		opts.Target = positional[0]
+	}
+
+	fmt.Println(banner)
+	cfg, target, err := resolveTarget(ctx, &opts)
+	if err != nil {
+		return targetErrorCode(err, &opts)
+	}
+	if strings.HasPrefix(target.InstanceID, "ecs:") {
+		return reportError(fmt.Errorf("%s is an ECS task; SSH, and so sftp, can't be proxied to it", target.InstanceID))
+	}
+	if err := ensureRunning(ctx, cfg, &opts, target); err != nil {
+		return targetErrorCode(err, &opts)
+	}
+	proxy, err := proxyCommand(&opts, cfg.Region)
+	if err != nil {
+		return reportError(err)
+	}
+
+	sftpArgs := []string{"-o", "ProxyCommand=" + proxy}
+	destination := user + "@" + target.InstanceID
+	if dir != "" {
+		destination += ":" + dir
+	}
+	if opts.DryRun {
+		if identity != "" {
+			sftpArgs = append(sftpArgs, "-i", identity)
+		}
+		printDryRun("sftp", append(sftpArgs, destination)...)
+		return exitOK
+	}
+	switch {
+	case identity != "":
+		sftpArgs = append(sftpArgs, "-i", identity)
+	case instanceConnect:
+		keyArgs, cleanup := instanceConnectArgs(ctx, cfg, user, target.InstanceID)
+		defer cleanup()
+		sftpArgs = append(sftpArgs, keyArgs...)
+	}
+
+	recordHistory(&opts, target)
+	fmt.Printf("\nOpening sftp to %s. Type help for the commands, bye to leave.\n", hostLabel(target))
+	return runExternal(ctx, "sftp", append(sftpArgs, destination))
+}
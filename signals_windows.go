@@ -0,0 +1,9 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// Windows delivers Ctrl+C to every process attached to the console and has no other
+// signals to relay, so nothing is forwarded to the session-manager-plugin.
+var forwardedSignals []os.Signal
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// defaultSSHUser is the login used for SSH-over-SSM when --user is not given.
+const defaultSSHUser = "ec2-user"
+
+// proxyCommand returns an OpenSSH ProxyCommand that tunnels through this binary's proxy
+// command, carrying over the profile and region so ssh/scp reach the right account, and
+// the reason so the session records it.
+func proxyCommand(opts *options, region string) (string, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("locating the aws-ssm-connect binary: %w", err)
+	}
+
+	parts := []string{shellQuote(self), "proxy", "%h", "%p"}
+	for _, arg := range credentialArgs(opts, region) {
+		parts = append(parts, shellQuote(arg))
+	}
+	if opts.Reason != "" {
+		// OpenSSH expands % sequences in the ProxyCommand.
+		parts = append(parts, "--reason", shellQuote(strings.ReplaceAll(opts.Reason, "%", "%%")))
+	}
+	return strings.Join(parts, " "), nil
+}
+
+// credentialArgs returns the flags that make another run of this binary use the same
+// credentials as opts, in region, and call the same endpoints with the same retries.
+func credentialArgs(opts *options, region string) []string {
+	var args []string
+	if opts.Profile != "" {
+		args = append(args, "--profile", opts.Profile)
+	}
+	if region != "" {
+		args = append(args, "--region", region)
+	}
+	if opts.SSOAccount != "" {
+		args = append(args, "--sso-account", opts.SSOAccount, "--sso-role", opts.SSORole)
+	}
+	if opts.RoleARN != "" {
+		args = append(args, "--role-arn", opts.RoleARN)
+	}
+	if opts.MFASerial != "" {
+		args = append(args, "--mfa-serial", opts.MFASerial)
+	}
+	if endpointURL != "" {
+		args = append(args, "--endpoint-url", endpointURL)
+	}
+	if useFIPS {
+		args = append(args, "--fips")
+	}
+	if maxRetries != defaultMaxRetries {
+		args = append(args, "--max-retries", strconv.Itoa(maxRetries))
+	}
+	return args
+}
+
+// shellQuote quotes s for /bin/sh, which OpenSSH uses to run the ProxyCommand.
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r == '/' || r == '-' || r == '_' || r == '.' || r == ':' || r == '@' || r == '=' ||
+			('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9'))
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// runCp implements the cp command, copying files to or from an instance with scp over
+// an SSH-over-SSM tunnel:
+//
+//	aws-ssm-connect cp ./local.txt i-0abc:/tmp/
+//	aws-ssm-connect cp -r i-0abc:/var/log/app ./logs
+//
+// Unless -i is given, a temporary key is pushed with EC2 Instance Connect, so the instance
+// needs no key provisioned for --user; otherwise it must accept one of your own. With
+// --via-s3 the file goes through S3 and Run Command instead, and SSH isn't needed at all.
+func runCp(ctx context.Context, args []string) int {
+	var opts options
+	var user, identity string
+	var recursive, instanceConnect bool
+	var viaS3 commandOutput
+	fs := newFlagSet(findCommand("cp"), &opts)
+	fs.StringVar(&user, "user", defaultSSHUser, "remote `login` name")
+	fs.StringVar(&identity, "i", "", "SSH private key `file` to authenticate with")
+	fs.BoolVar(&recursive, "r", false, "copy directories recursively")
+	addInstanceConnectFlag(fs, &instanceConnect)
+	fs.Var(s3OutputFlag{&viaS3}, "via-s3", "copy one file through a temporary object under this `s3://bucket/prefix` instead of scp, for instances without SSH")
+	addReasonFlag(fs, &opts)
+	addDryRunFlag(fs, &opts)
+
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return flagErrorCode(err)
+	}
+	if len(positional) < 2 {
+		fs.Usage()
+		return exitUsage
+	}
+	if err := opts.applyFileConfig(); err != nil {
+		return reportError(err)
+	}
+	if viaS3.s3Bucket != "" {
+		if recursive || len(positional) != 2 {
+			fmt.Fprintln(os.Stderr, "Error: --via-s3 copies a single file; archive directories with tar first.")
+			return exitUsage
+		}
+		return copyViaS3(ctx, &opts, positional[0], positional[1], viaS3)
+	}
+
+	// Exactly one side of the copy must be on an instance.
+	var remotes []string
+	paths := make([]string, len(positional))
+	for i, path := range positional {
+		if host, remotePath, ok := strings.Cut(path, ":"); ok && instanceIDPattern.MatchString(host) {
+			paths[i] = fmt.Sprintf("%s@%s:%s", user, host, remotePath)
+			if !slices.Contains(remotes, host) {
+				remotes = append(remotes, host)
+			}
+			continue
+		}
+		paths[i] = path
+	}
+	if len(remotes) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: one side of the copy must be instanceId:path.")
+		return exitUsage
+	}
+
+	proxy, err := proxyCommand(&opts, opts.Region)
+	if err != nil {
+		return reportError(err)
+	}
+
+	scpArgs := []string{"-o", "ProxyCommand=" + proxy}
+	if recursive {
+		scpArgs = append(scpArgs, "-r")
+	}
+	if opts.DryRun {
+		if identity != "" {
+			scpArgs = append(scpArgs, "-i", identity)
+		}
+		printDryRun("scp", append(scpArgs, paths...)...)
+		return exitOK
+	}
+
+	switch {
+	case identity != "":
+		scpArgs = append(scpArgs, "-i", identity)
+	case instanceConnect:
+		cfg, err := resolveAWSConfig(ctx, &opts)
+		if err != nil {
+			return reportError(err)
+		}
+		keyArgs, cleanup := instanceConnectArgs(ctx, cfg, user, remotes...)
+		defer cleanup()
+		scpArgs = append(scpArgs, keyArgs...)
+	}
+	return runExternal(ctx, "scp", append(scpArgs, paths...))
+}
+
+// startSocksProxy implements forward --socks: an SSH dynamic forward (ssh -D) through the
+// chosen instance over SSH-over-SSM, so a browser can reach internal sites through it.
+// Unless identity is given or instanceConnect is off, a temporary key is pushed with EC2
+// Instance Connect.
+func startSocksProxy(ctx context.Context, opts *options, port int, user, identity string, instanceConnect bool) int {
+	cfg, target, err := resolveTarget(ctx, opts)
+	if err != nil {
+		return targetErrorCode(err, opts)
+	}
+	if err := ensureRunning(ctx, cfg, opts, target); err != nil {
+		return targetErrorCode(err, opts)
+	}
+	proxy, err := proxyCommand(opts, cfg.Region)
+	if err != nil {
+		return reportError(err)
+	}
+
+	sshArgs := []string{"-N", "-D", fmt.Sprintf("localhost:%d", port),
+		"-o", "ProxyCommand=" + proxy,
+		"-o", "ExitOnForwardFailure=yes",
+		"-o", "ServerAliveInterval=30"}
+	if opts.DryRun {
+		if identity != "" {
+			sshArgs = append(sshArgs, "-i", identity)
+		}
+		printDryRun("ssh", append(sshArgs, user+"@"+target.InstanceID)...)
+		return exitOK
+	}
+	switch {
+	case identity != "":
+		sshArgs = append(sshArgs, "-i", identity)
+	case instanceConnect:
+		keyArgs, cleanup := instanceConnectArgs(ctx, cfg, user, target.InstanceID)
+		defer cleanup()
+		sshArgs = append(sshArgs, keyArgs...)
+	}
+	sshArgs = append(sshArgs, user+"@"+target.InstanceID)
+
+	recordHistory(opts, target)
+	fmt.Printf("\nSOCKS5 proxy on localhost:%d through %s. Press Ctrl+C to stop.\n", port, target.InstanceID)
+	fmt.Printf("Point your browser or tools at it, e.g. curl --proxy socks5h://localhost:%d http://internal.example/\n", port)
+	return runExternal(ctx, "ssh", sshArgs)
+}
+
+// runExternal runs an interactive local tool (ssh, scp, ...) attached to the terminal and
+// returns its exit code.
+func runExternal(ctx context.Context, name string, args []string) int {
+	path, err := executor.LookPath(name)
+	if err != nil {
+		return reportError(withKind(kindMissingTool, withHints(fmt.Errorf("%s was not found in your PATH", name),
+			"Install the OpenSSH client tools.")))
+	}
+
+	debugCommand(path, args)
+	if err := executor.Run(ctx, path, args, os.Stdin, os.Stdout, os.Stderr); err != nil {
+		if code, ok := exitCode(err); ok {
+			return code
+		}
+		return reportError(err)
+	}
+	return exitOK
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCredentialArgs(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       *options
+		endpoint   string
+		fips       bool
+		maxRetries int
+		want       []string
+	}{
+		{
+			name:       "profile and region",
+			opts:       &options{Profile: "dev"},
+			maxRetries: defaultMaxRetries,
+			want:       []string{"--profile", "dev", "--region", "eu-west-1"},
+		},
+		{
+			name:       "role and MFA",
+			opts:       &options{RoleARN: "arn:aws:iam::123456789012:role/admin", MFASerial: "arn:aws:iam::123456789012:mfa/alice"},
+			maxRetries: defaultMaxRetries,
+			want: []string{"--region", "eu-west-1", "--role-arn", "arn:aws:iam::123456789012:role/admin",
+				"--mfa-serial", "arn:aws:iam::123456789012:mfa/alice"},
+		},
+		{
+			name:       "endpoint, FIPS and retries",
+			opts:       &options{},
+			endpoint:   "http://localhost:4566",
+			fips:       true,
+			maxRetries: 10,
+			want:       []string{"--region", "eu-west-1", "--endpoint-url", "http://localhost:4566", "--fips", "--max-retries", "10"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			savedEndpoint, savedFIPS, savedRetries := endpointURL, useFIPS, maxRetries
+			t.Cleanup(func() { endpointURL, useFIPS, maxRetries = savedEndpoint, savedFIPS, savedRetries })
+			endpointURL, useFIPS, maxRetries = tt.endpoint, tt.fips, tt.maxRetries
+
+			if got := credentialArgs(tt.opts, "eu-west-1"); !slices.Equal(got, tt.want) {
+				t.Errorf("credentialArgs = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
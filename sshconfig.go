@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sshConfigMarker begins the comments that delimit the blocks of ~/.ssh/config this tool
+// maintains: one per profile for ssh-config --write, and one for connect --code.
+const sshConfigMarker = "# aws-ssm-connect ssh-config"
+
+// runSSHConfig implements the ssh-config command: print an OpenSSH Host entry for every
+// discovered instance, with this binary's proxy command as ProxyCommand, so plain ssh,
+// scp and editors such as VS Code Remote-SSH reach the fleet by name:
+//
+//	aws-ssm-connect ssh-config --tag Env=dev --write
+//	ssh web-1
+//
+// With --write the entries replace the profile's managed block in ~/.ssh/config (added at
+// the end the first time), leaving the rest of the file alone; rerun it as the fleet changes.
+func runSSHConfig(ctx context.Context, args []string) int {
+	var opts options
+	var user, prefix, file string
+	var write bool
+	fs := newFlagSet(findCommand("ssh-config"), &opts)
+	addDiscoveryFlags(fs, &opts)
+	fs.StringVar(&user, "user", defaultSSHUser, "remote `login` name of the entries")
+	fs.StringVar(&prefix, "prefix", "", "put this `text` before each host name, e.g. 'dev-'")
+	fs.BoolVar(&write, "write", false, "replace the profile's managed block in the SSH config file instead of printing the entries")
+	fs.StringVar(&file, "file", "", "SSH config `file` for --write (default ~/.ssh/config)")
+
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return flagErrorCode(err)
+	}
+	if len(positional) > 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	if err := opts.applyFileConfig(); err != nil {
+		return reportError(err)
+	}
+	if len(opts.Accounts) > 0 {
+		return reportError(withHints(errors.New("ssh-config can't be used with --accounts: the proxy command only has the profile's credentials"),
+			"Write one block per account with a --profile for each."))
+	}
+
+	cfg, err := resolveAWSConfig(ctx, &opts)
+	if err != nil {
+		return reportError(err)
+	}
+	instances, err := discoverInstances(ctx, cfg, &opts)
+	if err != nil {
+		return reportError(err)
+	}
+	entries, count, err := sshConfigEntries(&opts, instances, cfg.Region, user, prefix)
+	if err != nil {
+		return reportError(err)
+	}
+	if !write {
+		fmt.Print(entries)
+		return exitOK
+	}
+
+	file, err = updateSSHConfig(file, "profile "+profileName(opts.Profile), func(string) string { return entries })
+	if err != nil {
+		return reportError(err)
+	}
+	fmt.Printf("Wrote %d hosts to %s (profile %s).\n", count, file, profileName(opts.Profile))
+	return exitOK
+}
+
+// sshConfigEntries returns the Host entries of instances and how many there are. Hosts are
+// named after the Name tag; instances sharing a name, such as those of an Auto Scaling
+// group, get their ID appended. ECS tasks are left out, as SSH can't be proxied to them.
+func sshConfigEntries(opts *options, instances []Instance, region, user, prefix string) (string, int, error) {
+	names := map[string]int{}
+	for _, inst := range instances {
+		names[sshHostName(inst)]++
+	}
+
+	var b strings.Builder
+	count := 0
+	for _, inst := range instances {
+		if strings.HasPrefix(inst.InstanceID, "ecs:") {
+			continue
+		}
+		instRegion := inst.Region
+		if instRegion == "" {
+			instRegion = region
+		}
+		proxy, err := proxyCommand(opts, instRegion)
+		if err != nil {
+			return "", 0, err
+		}
+		host := sshHostName(inst)
+		if names[host] > 1 {
+			host += "-" + inst.InstanceID
+		}
+		fmt.Fprintf(&b, "Host %s%s\n", prefix, host)
+		fmt.Fprintf(&b, "    HostName %s\n", inst.InstanceID)
+		fmt.Fprintf(&b, "    User %s\n", user)
+		fmt.Fprintf(&b, "    ProxyCommand %s\n\n", proxy)
+		count++
+	}
+	return b.String(), count, nil
+}
+
+// sshHostName turns the instance's name into an SSH host name, replacing the characters
+// ssh treats as patterns or separators. Unnamed instances go by their ID.
+func sshHostName(inst Instance) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || r == '.' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9') {
+			return r
+		}
+		return '-'
+	}, inst.Name)
+	if name = strings.Trim(name, "-"); name == "" {
+		return inst.InstanceID
+	}
+	return name
+}
+
+// updateSSHConfig replaces the entries of the managed block called name in the SSH config
+// file (~/.ssh/config if file is "") with what update returns for the current ones, and
+// returns the file's path.
+func updateSSHConfig(file, name string, update func(entries string) string) (string, error) {
+	if file == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("locating the home directory: %w", err)
+		}
+		file = filepath.Join(home, ".ssh", "config")
+	}
+	existing, err := os.ReadFile(file)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("reading %s: %w", file, err)
+	}
+	entries, err := sshConfigEntriesOf(string(existing), name)
+	if err != nil {
+		return "", fmt.Errorf("updating %s: %w", file, err)
+	}
+	updated, err := replaceSSHConfigBlock(string(existing), name, update(entries))
+	if err != nil {
+		return "", fmt.Errorf("updating %s: %w", file, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0o700); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(file, []byte(updated), 0o600); err != nil {
+		return "", fmt.Errorf("writing %s: %w", file, err)
+	}
+	return file, nil
+}
+
+// sshConfigBlock finds the managed block called name in config and returns the offsets of
+// its first line and of the end of its last line, or -1 and -1 if config has none.
+func sshConfigBlock(config, name string) (int, int, error) {
+	begin := fmt.Sprintf("%s begin (%s)", sshConfigMarker, name)
+	end := fmt.Sprintf("%s end (%s)", sshConfigMarker, name)
+	start := strings.Index(config, begin)
+	if start < 0 {
+		return -1, -1, nil
+	}
+	stop := strings.Index(config[start:], end)
+	if stop < 0 {
+		return 0, 0, fmt.Errorf("the block of %s has no end line (%s)", name, end)
+	}
+	return start, start + stop + len(end), nil
+}
+
+// sshConfigEntriesOf returns the entries of the managed block called name in config.
+func sshConfigEntriesOf(config, name string) (string, error) {
+	start, stop, err := sshConfigBlock(config, name)
+	if err != nil || start < 0 {
+		return "", err
+	}
+	block := config[start:stop]
+	// Drop the begin and comment lines and the end line.
+	if i := strings.Index(block, "\n\n"); i >= 0 {
+		block = block[i+2:]
+	}
+	return block[:strings.LastIndex(block, "\n")+1], nil
+}
+
+// replaceSSHConfigBlock returns config with the managed block called name holding entries,
+// appending the block if config has none yet.
+func replaceSSHConfigBlock(config, name, entries string) (string, error) {
+	block := fmt.Sprintf("%s begin (%s)\n# Generated; edits inside this block are overwritten.\n\n%s%s end (%s)\n",
+		sshConfigMarker, name, entries, sshConfigMarker, name)
+	start, stop, err := sshConfigBlock(config, name)
+	if err != nil {
+		return "", err
+	}
+	if start < 0 {
+		if config != "" && !strings.HasSuffix(config, "\n\n") {
+			config = strings.TrimRight(config, "\n") + "\n\n"
+		}
+		return config + block, nil
+	}
+	return config[:start] + block + strings.TrimPrefix(config[stop:], "\n"), nil
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/ssocreds"
+	"github.com/aws/aws-sdk-go-v2/service/sso"
+	ssotypes "github.com/aws/aws-sdk-go-v2/service/sso/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssooidc"
+	"github.com/aws/smithy-go"
+	"github.com/nkarisa/homebrew-aws-ssm-connect/pkg/picker"
+	"golang.org/x/term"
+)
+
+// isSSOTokenError reports whether err means the cached IAM Identity Center (SSO) token is
+// missing or expired, which 'aws sso login' fixes.
+func isSSOTokenError(err error) bool {
+	var invalidToken *ssocreds.InvalidTokenError
+	if errors.As(err, &invalidToken) {
+		return true
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == "UnauthorizedException" {
+		// Returned by sso:GetRoleCredentials for a revoked or expired access token.
+		return true
+	}
+	// sso-session profiles surface token refresh failures as plain errors.
+	msg := err.Error()
+	return strings.Contains(msg, "cached SSO token") || strings.Contains(msg, "SSOProviderInvalidToken")
+}
+
+// renewSSOSession offers to run 'aws sso login' for the profile after cause reported an
+// expired SSO session. It only prompts when attached to a terminal.
+func renewSSOSession(ctx context.Context, profile string, cause error) error {
+	loginCmd := "aws sso login"
+	if profile != "" {
+		loginCmd += " --profile " + profile
+	}
+	expired := withHints(fmt.Errorf("SSO session expired or not logged in: %w", cause),
+		fmt.Sprintf("Run '%s' and try again.", loginCmd))
+
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return expired
+	}
+	if !picker.Confirm(fmt.Sprintf("Your SSO session has expired. Run '%s' now?", loginCmd), true) {
+		return expired
+	}
+
+	args := []string{"sso", "login"}
+	if profile != "" {
+		args = append(args, "--profile", profile)
+	}
+	debugCommand("aws", args)
+	if err := executor.Run(ctx, "aws", args, os.Stdin, os.Stdout, os.Stderr); err != nil {
+		return withHints(fmt.Errorf("'%s' failed: %w", loginCmd, err),
+			"Is the 'aws' CLI (v2) installed and in your PATH?")
+	}
+	return nil
+}
+
+// applySSORole switches cfg to an account and role of the profile's IAM Identity Center
+// (SSO) session, so one sso-session profile can reach every account the user is assigned
+// to. The account and role come from --sso-account and --sso-role, or are picked from the
+// user's assignments with --sso-pick, or when the profile names no account of its own.
+func applySSORole(ctx context.Context, cfg aws.Config, opts *options) (aws.Config, error) {
+	requested := opts.SSOPick || opts.SSOAccount != "" || opts.SSORole != ""
+	profile, err := config.LoadSharedConfigProfile(ctx, profileName(opts.Profile))
+	if err != nil {
+		if requested {
+			return cfg, fmt.Errorf("--sso-pick needs an SSO profile: %w", err)
+		}
+		return cfg, nil
+	}
+
+	startURL, region, cacheKey := profile.SSOStartURL, profile.SSORegion, profile.SSOStartURL
+	if profile.SSOSession != nil {
+		startURL, region, cacheKey = profile.SSOSession.SSOStartURL, profile.SSOSession.SSORegion, profile.SSOSessionName
+	}
+	switch {
+	case startURL == "" && requested:
+		return cfg, withHints(fmt.Errorf("profile %s is not an IAM Identity Center (SSO) profile", profileName(opts.Profile)),
+			"Set up one with 'aws configure sso'.")
+	case startURL == "":
+		return cfg, nil
+	case !requested && profile.SSOAccountID != "":
+		return cfg, nil
+	}
+
+	tokenPath, err := ssocreds.StandardCachedTokenFilepath(cacheKey)
+	if err != nil {
+		return cfg, err
+	}
+	ssoCfg := cfg.Copy()
+	ssoCfg.Region = region
+	tokens := ssocreds.NewSSOTokenProvider(ssooidc.NewFromConfig(ssoCfg), tokenPath)
+	token, err := tokens.RetrieveBearerToken(ctx)
+	if err != nil {
+		if err := renewSSOSession(ctx, opts.Profile, err); err != nil {
+			return cfg, err
+		}
+		if token, err = tokens.RetrieveBearerToken(ctx); err != nil {
+			return cfg, fmt.Errorf("reading the SSO token: %w", err)
+		}
+	}
+	client := sso.NewFromConfig(ssoCfg)
+
+	if (opts.SSOAccount == "" || opts.SSORole == "") && !term.IsTerminal(int(os.Stdin.Fd())) {
+		return cfg, withHints(fmt.Errorf("profile %s needs an SSO account and role to be chosen", profileName(opts.Profile)),
+			"Pass --sso-account and --sso-role when not running in a terminal.")
+	}
+	account := opts.SSOAccount
+	if account == "" {
+		if account, err = pickSSOAccount(ctx, client, token.Value, opts.Numbered); err != nil {
+			return cfg, err
+		}
+	}
+	role := opts.SSORole
+	if role == "" {
+		if role, err = pickSSORole(ctx, client, token.Value, account, opts.Numbered); err != nil {
+			return cfg, err
+		}
+	}
+	opts.SSOAccount, opts.SSORole = account, role
+
+	fmt.Fprintf(os.Stderr, "Using SSO role: %s in account %s\n", role, account)
+	cfg.Credentials = aws.NewCredentialsCache(ssocreds.New(client, account, role, startURL, func(o *ssocreds.Options) {
+		o.SSOTokenProvider = tokens
+	}))
+	if _, err := cfg.Credentials.Retrieve(ctx); err != nil {
+		return cfg, withHints(fmt.Errorf("getting credentials for %s in account %s: %w", role, account, describeAPIError(err)),
+			"Check that you are assigned this role in the account (see the AWS access portal).")
+	}
+	return cfg, nil
+}
+
+// pickSSOAccount asks the user to choose one of the accounts they are assigned to. With
+// a single account there is nothing to ask.
+func pickSSOAccount(ctx context.Context, client *sso.Client, token string, numbered bool) (string, error) {
+	var accounts []ssotypes.AccountInfo
+	paginator := sso.NewListAccountsPaginator(client, &sso.ListAccountsInput{AccessToken: aws.String(token)})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return "", fmt.Errorf("listing your SSO accounts: %w", describeAPIError(err))
+		}
+		accounts = append(accounts, page.AccountList...)
+	}
+	if len(accounts) == 0 {
+		return "", errors.New("you are not assigned to any accounts in IAM Identity Center")
+	}
+	if len(accounts) == 1 {
+		return aws.ToString(accounts[0].AccountId), nil
+	}
+
+	sort.Slice(accounts, func(i, j int) bool {
+		return strings.ToLower(aws.ToString(accounts[i].AccountName)) < strings.ToLower(aws.ToString(accounts[j].AccountName))
+	})
+	rows := make([]string, len(accounts))
+	for i, account := range accounts {
+		rows[i] = fmt.Sprintf("%s  %s", aws.ToString(account.AccountId), aws.ToString(account.AccountName))
+	}
+	index, err := picker.Choose("Select an AWS account", rows, numbered)
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(accounts[index].AccountId), nil
+}
+
+// pickSSORole asks the user to choose one of their roles in account, unless there is
+// only one.
+func pickSSORole(ctx context.Context, client *sso.Client, token, account string, numbered bool) (string, error) {
+	var roles []string
+	paginator := sso.NewListAccountRolesPaginator(client, &sso.ListAccountRolesInput{
+		AccessToken: aws.String(token),
+		AccountId:   aws.String(account),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return "", fmt.Errorf("listing your roles in account %s: %w", account, describeAPIError(err))
+		}
+		for _, role := range page.RoleList {
+			roles = append(roles, aws.ToString(role.RoleName))
+		}
+	}
+	if len(roles) == 0 {
+		return "", fmt.Errorf("you have no roles in account %s", account)
+	}
+	if len(roles) == 1 {
+		return roles[0], nil
+	}
+
+	sort.Strings(roles)
+	index, err := picker.Choose("Select a role in "+account, roles, numbered)
+	if err != nil {
+		return "", err
+	}
+	return roles[index], nil
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/nkarisa/homebrew-aws-ssm-connect/pkg/picker"
+	"golang.org/x/term"
+)
+
+// startTimeout bounds how long a started instance may take to boot and register with SSM.
+const startTimeout = 10 * time.Minute
+
+// readyPollInterval is how often the instance and agent status are polled while waiting.
+const readyPollInterval = 5 * time.Second
+
+// ensureRunning offers to start inst if it is stopped, and then waits until it is running
+// and its SSM agent is online, so a session can be opened on a dev box shut down overnight.
+// With --start the instance is started without asking.
+func ensureRunning(ctx context.Context, cfg aws.Config, opts *options, inst Instance) error {
+	if !strings.HasPrefix(inst.InstanceID, "i-") {
+		return nil // Only EC2 instances can be started; hybrid servers and ECS tasks can't.
+	}
+	client := ec2.NewFromConfig(cfg)
+	state := inst.State
+	if state == "" {
+		// Given by ID, so the listing was skipped.
+		out, err := client.DescribeInstances(ctx, &ec2.DescribeInstancesInput{InstanceIds: []string{inst.InstanceID}})
+		if err != nil || len(out.Reservations) == 0 || len(out.Reservations[0].Instances) == 0 {
+			return nil // Let StartSession report the problem.
+		}
+		state = string(out.Reservations[0].Instances[0].State.Name)
+	}
+	if state != string(types.InstanceStateNameStopped) {
+		return nil
+	}
+
+	if opts.DryRun {
+		printDryRun("aws", append([]string{"ec2", "start-instances", "--instance-ids", inst.InstanceID}, awsCLIArgs(cfg, opts)...)...)
+		return nil
+	}
+	if !opts.Start {
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			return withKind(kindTargetOffline, withHints(fmt.Errorf("instance %s is stopped", inst.InstanceID),
+				"Pass --start to start it before connecting."))
+		}
+		if !picker.Confirm(fmt.Sprintf("\nInstance %s is stopped. Start it?", hostLabel(inst)), true) {
+			return errQuit
+		}
+	}
+
+	if _, err := client.StartInstances(ctx, &ec2.StartInstancesInput{InstanceIds: []string{inst.InstanceID}}); err != nil {
+		return withHints(fmt.Errorf("starting instance %s: %w", inst.InstanceID, describeAPIError(err)),
+			"You are not allowed to call ec2:StartInstances on the instance.")
+	}
+	return waitUntilReady(ctx, cfg, inst.InstanceID, startTimeout)
+}
+
+// waitUntilReady polls until the instance is running and its SSM agent is online, showing
+// a spinner with the current status on stderr.
+func waitUntilReady(ctx context.Context, cfg aws.Config, instanceID string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ec2Client, ssmClient := ec2.NewFromConfig(cfg), ssm.NewFromConfig(cfg)
+
+	spin := startSpinner(fmt.Sprintf("Waiting for %s to start", instanceID))
+	defer spin.stop()
+	start := time.Now()
+	for {
+		status, err := instanceReadiness(ctx, ec2Client, ssmClient, instanceID)
+		switch {
+		case errors.Is(err, errInstanceReady):
+			spin.stop()
+			fmt.Fprintf(os.Stderr, "%s is ready after %s.\n", instanceID, time.Since(start).Round(time.Second))
+			return nil
+		case err != nil:
+			return err
+		}
+		spin.update(fmt.Sprintf("Waiting for %s: %s", instanceID, status))
+
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return withKind(kindTargetOffline, withHints(fmt.Errorf("%s was not ready after %s (%s)", instanceID, timeout, status),
+					"Check that the SSM Agent starts on boot and that the instance can reach the SSM endpoints."))
+			}
+			return ctx.Err()
+		case <-time.After(readyPollInterval):
+		}
+	}
+}
+
+// waitForAgent polls until the SSM agent of instanceID is online, backing off from a few
+// seconds to half a minute between checks. It is used after StartSession failed with
+// TargetNotConnected, e.g. because the instance is still booting. Unlike waitUntilReady it
+// only asks SSM, so it works for hybrid (mi-) instances too.
+func waitForAgent(ctx context.Context, cfg aws.Config, instanceID string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	client := ssm.NewFromConfig(cfg)
+
+	spin := startSpinner(fmt.Sprintf("Waiting for the SSM agent on %s to connect", instanceID))
+	defer spin.stop()
+	start := time.Now()
+	delay := 2 * time.Second
+	for {
+		info, err := client.DescribeInstanceInformation(ctx, &ssm.DescribeInstanceInformationInput{
+			Filters: []ssmtypes.InstanceInformationStringFilter{{Key: aws.String("InstanceIds"), Values: []string{instanceID}}},
+		})
+		status := "not registered"
+		switch {
+		case err != nil && ctx.Err() == nil:
+			return fmt.Errorf("checking the SSM agent on %s: %w", instanceID, describeAPIError(err))
+		case err == nil && len(info.InstanceInformationList) > 0:
+			status = string(info.InstanceInformationList[0].PingStatus)
+		}
+		if status == string(ssmtypes.PingStatusOnline) {
+			spin.stop()
+			fmt.Fprintf(os.Stderr, "The SSM agent on %s connected after %s.\n", instanceID, time.Since(start).Round(time.Second))
+			return nil
+		}
+		spin.update(fmt.Sprintf("Waiting for the SSM agent on %s (%s, %s elapsed)", instanceID, status, time.Since(start).Round(time.Second)))
+
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return withKind(kindTargetOffline, withHints(fmt.Errorf("the SSM agent on %s did not connect within %s", instanceID, timeout),
+					"Check that the SSM Agent is installed and running, and that the instance can reach the SSM endpoints."))
+			}
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay = min(2*delay, 30*time.Second)
+	}
+}
+
+// errInstanceReady is returned by instanceReadiness once nothing is left to wait for.
+var errInstanceReady = errors.New("instance ready")
+
+// instanceReadiness describes what the instance is waiting for, or returns errInstanceReady.
+func instanceReadiness(ctx context.Context, ec2Client *ec2.Client, ssmClient *ssm.Client, instanceID string) (string, error) {
+	out, err := ec2Client.DescribeInstances(ctx, &ec2.DescribeInstancesInput{InstanceIds: []string{instanceID}})
+	if err != nil {
+		return "", fmt.Errorf("checking instance %s: %w", instanceID, describeAPIError(err))
+	}
+	if len(out.Reservations) == 0 || len(out.Reservations[0].Instances) == 0 {
+		return "", fmt.Errorf("instance %s not found", instanceID)
+	}
+	if state := out.Reservations[0].Instances[0].State.Name; state != types.InstanceStateNameRunning {
+		return "instance " + string(state), nil
+	}
+
+	info, err := ssmClient.DescribeInstanceInformation(ctx, &ssm.DescribeInstanceInformationInput{
+		Filters: []ssmtypes.InstanceInformationStringFilter{{Key: aws.String("InstanceIds"), Values: []string{instanceID}}},
+	})
+	if err != nil {
+		return "", fmt.Errorf("checking the SSM agent on %s: %w", instanceID, describeAPIError(err))
+	}
+	if len(info.InstanceInformationList) == 0 {
+		return "SSM agent not registered yet", nil
+	}
+	if status := info.InstanceInformationList[0].PingStatus; status != ssmtypes.PingStatusOnline {
+		return "SSM agent " + string(status), nil
+	}
+	return "", errInstanceReady
+}
+
+// spinner animates a status message on a single, rewritten stderr line. When stderr is not
+// a terminal, each new message is printed once instead.
+type spinner struct {
+	mu      sync.Mutex
+	message string
+	done    chan struct{}
+	stopped bool
+}
+
+// startSpinner shows message with a spinner until stop is called.
+func startSpinner(message string) *spinner {
+	s := &spinner{message: message, done: make(chan struct{})}
+	if !liveOutput() {
+		fmt.Fprintln(os.Stderr, message+"...")
+		return s
+	}
+	go func() {
+		frames := `|/-\`
+		ticker := time.NewTicker(150 * time.Millisecond)
+		defer ticker.Stop()
+		for i := 0; ; i++ {
+			s.mu.Lock()
+			fmt.Fprintf(os.Stderr, "\r\033[K%c %s", frames[i%len(frames)], s.message)
+			s.mu.Unlock()
+			select {
+			case <-s.done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return s
+}
+
+// update replaces the message.
+func (s *spinner) update(message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if message != s.message && !liveOutput() {
+		fmt.Fprintln(os.Stderr, message+"...")
+	}
+	s.message = message
+}
+
+// stop removes the spinner line. It may be called more than once.
+func (s *spinner) stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return
+	}
+	s.stopped = true
+	close(s.done)
+	if liveOutput() {
+		fmt.Fprint(os.Stderr, "\r\033[K")
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	logstypes "github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// logPollInterval is how often streamed command output is fetched from CloudWatch Logs.
+const logPollInterval = 2 * time.Second
+
+// commandOutput is where Run Command should send a command's output besides the 24,000
+// characters GetCommandInvocation returns.
+type commandOutput struct {
+	logGroup string // CloudWatch Logs group; output is streamed from it as it arrives
+	s3Bucket string // S3 bucket; complete output is read from it once the command is done
+	s3Prefix string
+}
+
+// s3OutputFlag is a flag.Value for --s3-output s3://bucket/prefix.
+type s3OutputFlag struct{ output *commandOutput }
+
+func (f s3OutputFlag) String() string {
+	if f.output == nil || f.output.s3Bucket == "" {
+		return ""
+	}
+	return "s3://" + strings.TrimSuffix(f.output.s3Bucket+"/"+f.output.s3Prefix, "/")
+}
+
+func (f s3OutputFlag) Set(v string) error {
+	bucket, prefix, _ := strings.Cut(strings.TrimPrefix(v, "s3://"), "/")
+	if bucket == "" {
+		return fmt.Errorf("expected s3://bucket or s3://bucket/prefix, got '%s'", v)
+	}
+	f.output.s3Bucket, f.output.s3Prefix = bucket, strings.Trim(prefix, "/")
+	return nil
+}
+
+// addCommandOutputFlags adds --log-group and --s3-output, for commands that send Run Command
+// documents.
+func addCommandOutputFlags(fs *flag.FlagSet, output *commandOutput) {
+	fs.StringVar(&output.logGroup, "log-group", "", "send output to this CloudWatch Logs `group` and stream it while the command runs")
+	fs.Var(s3OutputFlag{output}, "s3-output", "also save output to this `s3://bucket/prefix`, and read it back from there untruncated")
+}
+
+// apply sets the SendCommand parameters that configure output.
+func (o commandOutput) apply(input *ssm.SendCommandInput) {
+	if o.logGroup != "" {
+		input.CloudWatchOutputConfig = &ssmtypes.CloudWatchOutputConfig{
+			CloudWatchOutputEnabled: true,
+			CloudWatchLogGroupName:  aws.String(o.logGroup),
+		}
+	}
+	if o.s3Bucket != "" {
+		input.OutputS3BucketName = aws.String(o.s3Bucket)
+		if o.s3Prefix != "" {
+			input.OutputS3KeyPrefix = aws.String(o.s3Prefix)
+		}
+	}
+}
+
+// streamCommandLogs copies the output a command writes to its CloudWatch Logs streams
+// (named <command>/<instance>/<plugin>/stdout and .../stderr) to stdout and stderr as it
+// arrives, until stop is closed, and then once more to catch the tail.
+//
+// The agent uploads output in batches, so lines show up a few seconds after they are
+// printed. Errors are reported once and end the streaming; the command itself goes on.
+func streamCommandLogs(ctx context.Context, cfg aws.Config, logGroup, commandID, instanceID string, stdout, stderr io.Writer, stop <-chan struct{}) {
+	client := cloudwatchlogs.NewFromConfig(cfg)
+	seen := map[string]bool{}
+	var start int64
+	for {
+		stopping := false
+		select {
+		case <-stop:
+			stopping = true
+		case <-ctx.Done():
+			return
+		case <-time.After(logPollInterval):
+		}
+
+		paginator := cloudwatchlogs.NewFilterLogEventsPaginator(client, &cloudwatchlogs.FilterLogEventsInput{
+			LogGroupName:        aws.String(logGroup),
+			LogStreamNamePrefix: aws.String(commandID + "/" + instanceID + "/"),
+			StartTime:           aws.Int64(start),
+		})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				// The group or streams don't exist until the agent first writes output.
+				var notYet *logstypes.ResourceNotFoundException
+				if errors.As(err, &notYet) {
+					break
+				}
+				fmt.Fprintf(os.Stderr, "Warning: streaming output from %s stopped: %v\n", logGroup, describeAPIError(err))
+				return
+			}
+			for _, event := range page.Events {
+				id := aws.ToString(event.EventId)
+				if seen[id] {
+					continue
+				}
+				seen[id] = true
+				// Events with the same timestamp may arrive later, so ask from this one again.
+				start = max(start, aws.ToInt64(event.Timestamp))
+				w := stdout
+				if strings.HasSuffix(aws.ToString(event.LogStreamName), "/stderr") {
+					w = stderr
+				}
+				fmt.Fprintln(w, strings.TrimRight(aws.ToString(event.Message), "\n"))
+			}
+		}
+		if stopping {
+			return
+		}
+	}
+}
+
+// readS3Output reads the complete output of a finished command from its S3 output
+// location, where the agent writes <prefix>/<command>/<instance>/<plugin>/.../stdout
+// and stderr.
+func readS3Output(ctx context.Context, cfg aws.Config, output commandOutput, commandID, instanceID string) (stdout, stderr string, err error) {
+	client := s3.NewFromConfig(cfg)
+	prefix := commandID + "/" + instanceID + "/"
+	if output.s3Prefix != "" {
+		prefix = output.s3Prefix + "/" + prefix
+	}
+	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(output.s3Bucket),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return "", "", fmt.Errorf("listing s3://%s/%s: %w", output.s3Bucket, prefix, describeAPIError(err))
+		}
+		for _, object := range page.Contents {
+			key := aws.ToString(object.Key)
+			var target *string
+			switch {
+			case strings.HasSuffix(key, "/stdout"):
+				target = &stdout
+			case strings.HasSuffix(key, "/stderr"):
+				target = &stderr
+			default:
+				continue
+			}
+			got, err := client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(output.s3Bucket), Key: object.Key})
+			if err != nil {
+				return "", "", fmt.Errorf("reading s3://%s/%s: %w", output.s3Bucket, key, describeAPIError(err))
+			}
+			body, err := io.ReadAll(got.Body)
+			got.Body.Close()
+			if err != nil {
+				return "", "", fmt.Errorf("reading s3://%s/%s: %w", output.s3Bucket, key, err)
+			}
+			*target += string(body)
+		}
+	}
+	return stdout, stderr, nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	elb "github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2"
+	elbtypes "github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2/types"
+	"github.com/nkarisa/homebrew-aws-ssm-connect/pkg/picker"
+)
+
+// pickTargetGroup lists the instance target groups of the load balancers in cfg's region
+// and lets the user pick one, for --target-group.
+func pickTargetGroup(ctx context.Context, client *elb.Client, region string, numbered bool) (elbtypes.TargetGroup, error) {
+	var groups []elbtypes.TargetGroup
+	paginator := elb.NewDescribeTargetGroupsPaginator(client, &elb.DescribeTargetGroupsInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return elbtypes.TargetGroup{}, withHints(fmt.Errorf("describing target groups: %w", describeAPIError(err)),
+				"You are not allowed to call elasticloadbalancing:DescribeTargetGroups.")
+		}
+		for _, group := range page.TargetGroups {
+			// IP, Lambda and ALB targets aren't instances we could connect to.
+			if group.TargetType == elbtypes.TargetTypeEnumInstance {
+				groups = append(groups, group)
+			}
+		}
+	}
+	if len(groups) == 0 {
+		return elbtypes.TargetGroup{}, fmt.Errorf("no target groups with instance targets found in %s", region)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return aws.ToString(groups[i].TargetGroupName) < aws.ToString(groups[j].TargetGroupName)
+	})
+
+	rows := make([]string, len(groups))
+	for i, group := range groups {
+		var balancers []string
+		for _, arn := range group.LoadBalancerArns {
+			balancers = append(balancers, loadBalancerName(arn))
+		}
+		rows[i] = fmt.Sprintf("%-32s %-7s %5d  %s", aws.ToString(group.TargetGroupName), group.Protocol,
+			aws.ToInt32(group.Port), strings.Join(balancers, ", "))
+	}
+	index, err := picker.Choose("Select a target group", rows, numbered)
+	if err != nil {
+		return elbtypes.TargetGroup{}, err
+	}
+	return groups[index], nil
+}
+
+// loadBalancerName extracts the name from a load balancer ARN such as
+// arn:aws:elasticloadbalancing:...:loadbalancer/app/my-alb/50dc6c495c0c9188.
+func loadBalancerName(arn string) string {
+	parts := strings.Split(arn, "/")
+	if len(parts) < 3 {
+		return arn
+	}
+	return parts[len(parts)-2]
+}
+
+// applyTargetGroup narrows the listing to the instances registered in the target group the
+// user picks, and remembers their health for the HEALTH column. The reasons of unhealthy
+// targets are printed, as they are usually what the user is after.
+func (o *options) applyTargetGroup(ctx context.Context, cfg aws.Config) error {
+	if o.AllRegions || len(o.Accounts) > 0 {
+		return errors.New("--target-group can't be combined with --all-regions or --accounts")
+	}
+	client := elb.NewFromConfig(cfg)
+	group, err := pickTargetGroup(ctx, client, cfg.Region, o.Numbered)
+	if err != nil {
+		return err
+	}
+	name := aws.ToString(group.TargetGroupName)
+
+	out, err := client.DescribeTargetHealth(ctx, &elb.DescribeTargetHealthInput{TargetGroupArn: group.TargetGroupArn})
+	if err != nil {
+		return fmt.Errorf("describing the health of target group %s: %w", name, describeAPIError(err))
+	}
+	if len(out.TargetHealthDescriptions) == 0 {
+		return fmt.Errorf("target group %s has no registered instances", name)
+	}
+
+	o.targetHealth = map[string]string{}
+	fmt.Fprintf(os.Stderr, "Listing the instances registered in target group %s.\n", name)
+	for _, target := range out.TargetHealthDescriptions {
+		id := aws.ToString(target.Target.Id)
+		state := "unknown"
+		if health := target.TargetHealth; health != nil {
+			state = string(health.State)
+			if health.State != elbtypes.TargetHealthStateEnumHealthy {
+				fmt.Fprintf(os.Stderr, "  %s port %d: %s (%s) %s\n", id, aws.ToInt32(target.Target.Port), state,
+					health.Reason, aws.ToString(health.Description))
+			}
+		}
+		// An instance registered on several ports shows its least healthy one.
+		if previous, ok := o.targetHealth[id]; ok && state == string(elbtypes.TargetHealthStateEnumHealthy) {
+			state = previous
+		}
+		o.targetHealth[id] = state
+	}
+	return nil
+}
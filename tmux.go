@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// openInTmux implements connect --tmux: each target's session runs in its own tmux window,
+// or with panes in tiled panes of one window, optionally with synchronized input so that
+// what is typed goes to every host. Inside tmux the windows are added to the current
+// session; otherwise a new tmux session is created and attached.
+func openInTmux(ctx context.Context, opts *options, targets []Instance, panes, sync bool) int {
+	self, err := os.Executable()
+	if err != nil {
+		return reportError(fmt.Errorf("locating the aws-ssm-connect binary: %w", err))
+	}
+	if _, err := executor.LookPath("tmux"); err != nil && !opts.DryRun {
+		return reportError(withKind(kindMissingTool, withHints(errors.New("tmux was not found in your PATH"),
+			"Install tmux, or connect to one instance at a time.")))
+	}
+
+	inside := os.Getenv("TMUX") != ""
+	session := fmt.Sprintf("aws-ssm-connect-%d", time.Now().Unix())
+	var window string
+	for i, target := range targets {
+		command := tmuxSessionCommand(self, opts, target)
+		var args []string
+		switch {
+		case i == 0 && inside:
+			args = []string{"new-window", "-P", "-F", "#{window_id}", "-n", hostLabel(target), command}
+		case i == 0:
+			args = []string{"new-session", "-d", "-P", "-F", "#{window_id}", "-s", session, "-n", hostLabel(target), command}
+		case panes:
+			args = []string{"split-window", "-t", window, command}
+		case inside:
+			args = []string{"new-window", "-d", "-n", hostLabel(target), command}
+		default:
+			args = []string{"new-window", "-d", "-t", session + ":", "-n", hostLabel(target), command}
+		}
+		id, err := runTmux(opts, args...)
+		if err != nil {
+			return reportError(err)
+		}
+		if i == 0 {
+			window = id
+		}
+		// Re-tile after every split, or tmux runs out of room for the next pane.
+		if panes && i > 0 {
+			if _, err := runTmux(opts, "select-layout", "-t", window, "tiled"); err != nil {
+				return reportError(err)
+			}
+		}
+		if !opts.DryRun {
+			recordHistory(opts, target)
+		}
+	}
+	if panes && sync {
+		if _, err := runTmux(opts, "set-window-option", "-t", window, "synchronize-panes", "on"); err != nil {
+			return reportError(err)
+		}
+	}
+
+	switch {
+	case inside && opts.DryRun:
+		return exitOK
+	case inside:
+		fmt.Fprintf(os.Stderr, "Opened %d sessions in tmux.\n", len(targets))
+		return exitOK
+	case opts.DryRun:
+		printDryRun("tmux", "attach-session", "-t", session)
+		return exitOK
+	}
+	return runExternal(ctx, "tmux", []string{"attach-session", "-t", session})
+}
+
+// runTmux runs a tmux command and returns its trimmed output. With --dry-run it prints the
+// command and returns a placeholder window ID.
+func runTmux(opts *options, args ...string) (string, error) {
+	if opts.DryRun {
+		printDryRun("tmux", args...)
+		return "@1", nil
+	}
+	debugCommand("tmux", args)
+	var out bytes.Buffer
+	if err := executor.Run(context.Background(), "tmux", args, nil, &out, &out); err != nil {
+		return "", fmt.Errorf("tmux %s: %v: %s", args[0], err, strings.TrimSpace(out.String()))
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+// tmuxSessionCommand returns the shell command a tmux window runs for target: this binary's
+// connect with the same credentials, reason and shell options. If the session fails the
+// window stays open until Enter is pressed, so the error can be read.
+func tmuxSessionCommand(self string, opts *options, target Instance) string {
+	args := append(guardEnvArgs(opts), self, "connect", target.InstanceID)
+	args = append(args, credentialArgs(opts, target.Region)...)
+	if opts.Reason != "" {
+		args = append(args, "--reason", opts.Reason)
+	}
+	if opts.User != "" {
+		args = append(args, "--user", opts.User)
+	}
+	if opts.Document != "" {
+		args = append(args, "--document-name", opts.Document)
+	}
+	for _, param := range opts.Parameters {
+		args = append(args, "--parameter", param)
+	}
+	if opts.LogSession {
+		args = append(args, "--log-session")
+	}
+	if opts.Record != "" {
+		args = append(args, "--record", opts.Record)
+	}
+	if opts.Native {
+		args = append(args, "--native")
+	}
+	if opts.Reconnect > 0 {
+		args = append(args, "--reconnect", strconv.Itoa(opts.Reconnect))
+	}
+
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shellQuote(arg)
+	}
+	return strings.Join(quoted, " ") + ` || { echo "Press Enter to close."; read _; }`
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTmuxSessionCommand(t *testing.T) {
+	target := Instance{InstanceID: "i-0aaa1111aaaa1111a", Region: "eu-west-1"}
+	guarded := &guardPolicy{tags: []string{"Env=prod"}}
+	tests := []struct {
+		name string
+		opts *options
+		want string
+	}{
+		{
+			name: "credentials",
+			opts: &options{Profile: "dev"},
+			want: "/bin/asc connect i-0aaa1111aaaa1111a --profile dev --region eu-west-1",
+		},
+		{
+			name: "guard already confirmed",
+			opts: &options{guard: guarded},
+			want: "env AWS_SSM_CONNECT_GUARD_CONFIRMED=1 /bin/asc connect i-0aaa1111aaaa1111a --region eu-west-1",
+		},
+		{
+			name: "reason",
+			opts: &options{guard: guarded, Reason: "JIRA-123 it's down"},
+			want: `env AWS_SSM_CONNECT_GUARD_CONFIRMED=1 /bin/asc connect i-0aaa1111aaaa1111a --region eu-west-1 --reason 'JIRA-123 it'\''s down'`,
+		},
+		{
+			name: "shell options",
+			opts: &options{User: "app user", Reconnect: 2},
+			want: "/bin/asc connect i-0aaa1111aaaa1111a --region eu-west-1 --user 'app user' --reconnect 2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tmuxSessionCommand("/bin/asc", tt.opts, target)
+			command, _, _ := strings.Cut(got, " || ")
+			if command != tt.want {
+				t.Errorf("tmuxSessionCommand = %s, want %s", command, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,445 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/nkarisa/homebrew-aws-ssm-connect/pkg/picker"
+	"golang.org/x/term"
+)
+
+// tuiDetailHeight is the number of lines of the detail pane, including its rule.
+const tuiDetailHeight = 10
+
+// runTUI implements the tui command: a full-screen browser with the instance list, a
+// detail pane for the selected instance and a status bar. Enter opens a session, and when
+// it ends the browser comes back, so the next host is one keystroke away. The detail pane
+// includes a CloudWatch snapshot of the last 15 minutes, loaded in the background.
+func runTUI(ctx context.Context, args []string) int {
+	var opts options
+	fs := newFlagSet(findCommand("tui"), &opts)
+	addDiscoveryFlags(fs, &opts)
+	addShellFlags(fs, &opts)
+
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return flagErrorCode(err)
+	}
+	if len(positional) > 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		return reportError(withHints(errors.New("the tui command needs a terminal"),
+			"Use 'list' or 'connect --numbered' from scripts."))
+	}
+	if plainOutput {
+		return reportError(withHints(errors.New("the tui command redraws the whole screen and has no plain mode"),
+			"Use 'list' or 'connect --plain' instead."))
+	}
+	if err := opts.applyFileConfig(); err != nil {
+		return reportError(err)
+	}
+	if err := pickProfile(&opts); err != nil {
+		return targetErrorCode(err, &opts)
+	}
+	cfg, err := resolveAWSConfig(ctx, &opts)
+	if err != nil {
+		return reportError(err)
+	}
+	instances, err := discoverInstances(ctx, cfg, &opts)
+	if err != nil {
+		return reportError(err)
+	}
+
+	ui := &tui{opts: &opts, region: cfg.Region, all: instances}
+	ui.applyFilter()
+	go ui.loadMetrics(ctx, cfg, instances)
+	for {
+		inst, err := ui.browse(func() ([]Instance, error) {
+			opts.Refresh = true
+			instances, err := discoverInstances(ctx, cfg, &opts)
+			if err == nil {
+				go ui.loadMetrics(ctx, cfg, instances)
+			}
+			return instances, err
+		})
+		if errors.Is(err, errQuit) {
+			return exitOK
+		}
+		if err != nil {
+			return reportError(err)
+		}
+
+		instCfg := targetConfig(ctx, cfg, &opts, inst)
+		fmt.Printf("Connecting to %s (%s)...\n", inst.InstanceID, hostLabel(inst))
+		if !opts.DryRun {
+			err = checkGuard(ctx, cfg, &opts, []Instance{inst})
+		}
+		if err == nil {
+			err = ensureRunning(ctx, instCfg, &opts, inst)
+		}
+		if err == nil {
+			if !opts.DryRun {
+				recordHistory(&opts, inst)
+			}
+			err = startSSMSession(ctx, instCfg, &opts, inst)
+		}
+		ui.mu.Lock()
+		switch {
+		case errors.Is(err, errQuit):
+			ui.message = "Not connected."
+		case err != nil:
+			ui.message = fmt.Sprintf("Session to %s failed: %v", hostLabel(inst), err)
+		default:
+			ui.message = fmt.Sprintf("Session to %s ended.", hostLabel(inst))
+		}
+		ui.mu.Unlock()
+	}
+}
+
+// tui is the state of the full-screen browser.
+type tui struct {
+	opts    *options
+	region  string
+	all     []Instance
+	visible []Instance // all, narrowed by the filter
+	cursor  int        // index into visible
+	offset  int        // first visible row shown
+	filter  string
+	typing  bool // the filter has the keyboard
+	message string
+
+	// mu guards the browser's state against loadMetrics, which runs in the background.
+	// browse holds it except while waiting for a key.
+	mu      sync.Mutex
+	metrics map[string]instanceMetrics // by instance ID; nil until loaded
+	active  bool                       // browse is showing the screen
+}
+
+// loadMetrics fetches the metrics snapshot of instances and redraws the screen with it.
+func (ui *tui) loadMetrics(ctx context.Context, cfg aws.Config, instances []Instance) {
+	metrics, err := loadMetrics(ctx, cfg, ui.opts, instances)
+	ui.mu.Lock()
+	defer ui.mu.Unlock()
+	ui.metrics = metrics
+	if err != nil {
+		ui.message = fmt.Sprintf("Metrics unavailable: %v", err)
+	}
+	if ui.active {
+		ui.draw()
+	}
+}
+
+// browse shows the browser until the user picks an instance (returned) or quits (errQuit).
+// The terminal is in raw mode and on the alternate screen only while browsing, so sessions
+// get a normal terminal.
+func (ui *tui) browse(refresh func() ([]Instance, error)) (Instance, error) {
+	fd := int(os.Stdin.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return Instance{}, fmt.Errorf("switching the terminal to raw mode: %w", err)
+	}
+	fmt.Print("\033[?1049h\033[?25l")
+	defer func() {
+		fmt.Print("\033[?25h\033[?1049l")
+		term.Restore(fd, state)
+	}()
+
+	ui.mu.Lock()
+	ui.active = true
+	defer func() {
+		ui.active = false
+		ui.mu.Unlock()
+	}()
+
+	buf := make([]byte, 16)
+	for {
+		ui.draw()
+		ui.mu.Unlock()
+		n, err := picker.Stdin.Read(buf)
+		ui.mu.Lock()
+		if err != nil {
+			return Instance{}, errQuit
+		}
+		key := string(buf[:n])
+
+		if ui.typing {
+			ui.editFilter(key)
+			continue
+		}
+		switch key {
+		case "q", "\x03":
+			return Instance{}, errQuit
+		case "\r", "\n":
+			if len(ui.visible) > 0 {
+				return ui.visible[ui.cursor], nil
+			}
+		case "/":
+			ui.typing = true
+		case "\x1b":
+			ui.filter = ""
+			ui.applyFilter()
+		case "j", "\x1b[B", "\x1bOB":
+			ui.move(1)
+		case "k", "\x1b[A", "\x1bOA":
+			ui.move(-1)
+		case "\x1b[6~", "\x06":
+			ui.move(ui.listHeight())
+		case "\x1b[5~", "\x02":
+			ui.move(-ui.listHeight())
+		case "g", "\x1b[H", "\x1bOH":
+			ui.move(-len(ui.visible))
+		case "G", "\x1b[F", "\x1bOF":
+			ui.move(len(ui.visible))
+		case "o":
+			if len(ui.visible) > 0 {
+				link := consoleLink(context.Background(), ui.opts, ui.visible[ui.cursor])
+				ui.message = "Opened the console."
+				if err := openBrowser(context.Background(), link); err != nil {
+					ui.message = err.Error()
+				}
+			}
+		case "y", "Y":
+			if len(ui.visible) > 0 {
+				ui.copy(ui.visible[ui.cursor], key == "Y")
+			}
+		case "s":
+			ui.opts.Sort = nextSortKey(ui.opts.Sort)
+			sortInstances(ui.all, ui.opts.Sort)
+			ui.applyFilter()
+		case "r":
+			ui.message = "Refreshing..."
+			ui.draw()
+			// Discovery reports progress on stderr; keep it off the screen.
+			instances, err := withStderrDiscarded(refresh)
+			if err != nil {
+				ui.message = fmt.Sprintf("Refresh failed: %v", err)
+				continue
+			}
+			diff := diffListings(ui.all, instances)
+			ui.all = instances
+			ui.applyFilter()
+			ui.message = diff.summary()
+			if ui.message == "" {
+				ui.message = "No changes."
+			}
+		}
+	}
+}
+
+// copy puts the instance's ID or, with ip, its private IP on the clipboard.
+func (ui *tui) copy(inst Instance, ip bool) {
+	value := inst.InstanceID
+	if ip {
+		value = inst.PrivateIPAddress
+	}
+	if value == "" {
+		ui.message = hostLabel(inst) + " has no private IP."
+		return
+	}
+	if _, err := copyToClipboard(context.Background(), value); err != nil {
+		ui.message = fmt.Sprintf("Copy failed: %v", err)
+		return
+	}
+	ui.message = "Copied " + value + "."
+}
+
+// editFilter applies a key pressed while typing the filter. Enter keeps the filter,
+// Escape clears it.
+func (ui *tui) editFilter(key string) {
+	switch key {
+	case "\r", "\n":
+		ui.typing = false
+	case "\x1b", "\x03":
+		ui.typing = false
+		ui.filter = ""
+	case "\x7f", "\b":
+		if r := []rune(ui.filter); len(r) > 0 {
+			ui.filter = string(r[:len(r)-1])
+		}
+	default:
+		if !strings.ContainsAny(key, "\x1b\r\n\t") {
+			ui.filter += key
+		}
+	}
+	ui.applyFilter()
+}
+
+// applyFilter recomputes the visible rows, keeping the cursor in range.
+func (ui *tui) applyFilter() {
+	cols := ui.columns()
+	ui.visible = ui.visible[:0]
+	for _, inst := range ui.all {
+		if picker.FuzzyMatch(ui.filter, formatInstanceRow(inst, cols)) {
+			ui.visible = append(ui.visible, inst)
+		}
+	}
+	ui.move(0)
+}
+
+// move moves the cursor by delta rows and scrolls it into view.
+func (ui *tui) move(delta int) {
+	ui.cursor = max(0, min(ui.cursor+delta, len(ui.visible)-1))
+	height := ui.listHeight()
+	if ui.cursor < ui.offset {
+		ui.offset = ui.cursor
+	}
+	if ui.cursor >= ui.offset+height {
+		ui.offset = ui.cursor - height + 1
+	}
+}
+
+func (ui *tui) columns() []column {
+	return fitToTerminal(ui.opts.tableColumns(), 2)
+}
+
+// size returns the terminal size, assuming 80x24 if it is unknown.
+func (ui *tui) size() (int, int) {
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || width <= 0 || height <= 0 {
+		return 80, 24
+	}
+	return width, height
+}
+
+// listHeight is the number of instance rows that fit: the screen minus the status bar,
+// table header, detail pane and key hints.
+func (ui *tui) listHeight() int {
+	_, height := ui.size()
+	return max(1, height-3-tuiDetailHeight)
+}
+
+// draw renders the whole screen. Lines end in \r\n, as the terminal is in raw mode.
+func (ui *tui) draw() {
+	width, _ := ui.size()
+	var b strings.Builder
+	line := func(s string) {
+		b.WriteString(padCell(s, width))
+		b.WriteString("\r\n")
+	}
+
+	b.WriteString("\033[H")
+	status := fmt.Sprintf(" aws-ssm-connect | profile %s | region %s | %d of %d instances | sort %s",
+		profileName(ui.opts.Profile), ui.region, len(ui.visible), len(ui.all), ui.opts.Sort)
+	if ui.filter != "" || ui.typing {
+		status += " | filter: " + ui.filter
+	}
+	b.WriteString("\033[7m")
+	line(status)
+	b.WriteString("\033[0m")
+
+	cols := ui.columns()
+	line("  " + instanceTableHeader(cols))
+	height := ui.listHeight()
+	for i := ui.offset; i < ui.offset+height; i++ {
+		switch {
+		case i >= len(ui.visible):
+			line("")
+		case i == ui.cursor:
+			// Bold marks the cursor even without color.
+			cursor := "\033[1m"
+			if colorEnabled(os.Stdout) {
+				cursor = sgr("cursor")
+			}
+			b.WriteString(cursor)
+			line("▸ " + formatInstanceRow(ui.visible[i], cols))
+			b.WriteString("\033[0m")
+		default:
+			line("  " + formatInstanceRow(ui.visible[i], cols))
+		}
+	}
+
+	details := make([]string, tuiDetailHeight-1)
+	if len(ui.visible) > 0 {
+		details = instanceDetails(ui.visible[ui.cursor], ui.metrics, tuiDetailHeight-1)
+	}
+	line(strings.Repeat("─", width))
+	for _, d := range details {
+		line(" " + d)
+	}
+
+	hints := " ↑/↓ move  Enter connect  / filter  Esc clear  y/Y copy ID/IP  o console  s sort  r refresh  q quit"
+	if ui.typing {
+		hints = " Type to filter  Enter done  Esc clear"
+	}
+	if ui.message != "" {
+		hints = " " + ui.message + "  |" + hints
+	}
+	b.WriteString("\033[7m")
+	b.WriteString(padCell(hints, width))
+	b.WriteString("\033[0m")
+	fmt.Print(b.String())
+}
+
+// instanceDetails describes inst for the detail pane in exactly lines lines. metrics holds
+// the CloudWatch snapshots loaded so far.
+func instanceDetails(inst Instance, metrics map[string]instanceMetrics, lines int) []string {
+	launched := ""
+	if !inst.LaunchTime.IsZero() {
+		launched = inst.LaunchTime.Local().Format("2006-01-02 15:04")
+	}
+	agent := inst.AgentVersion
+	if inst.AgentOutdated {
+		agent += " (outdated)"
+	}
+	lastPing := ""
+	if !inst.LastPing.IsZero() {
+		lastPing = formatAge(time.Since(inst.LastPing))
+	}
+	pairs := [][2]string{
+		{"Instance", inst.InstanceID}, {"Name", inst.Name},
+		{"State", inst.State}, {"SSM", inst.SSMStatus},
+		{"Private IP", inst.PrivateIPAddress}, {"Type", inst.InstanceType},
+		{"Zone", inst.AvailabilityZone}, {"Launched", launched},
+		{"Platform", inst.Platform}, {"Account", inst.Account},
+		{"VPC", inst.VpcID}, {"Subnet", inst.SubnetID},
+		{"SSM agent", agent}, {"Last ping", lastPing},
+	}
+	var out []string
+	for i := 0; i+1 < len(pairs); i += 2 {
+		out = append(out, fmt.Sprintf("%-11s %-32s %-11s %s", pairs[i][0], pairs[i][1], pairs[i+1][0], pairs[i+1][1]))
+	}
+	switch {
+	case !strings.HasPrefix(inst.InstanceID, "i-"):
+		out = append(out, fmt.Sprintf("%-11s %s", "Metrics", "only EC2 instances report to CloudWatch"))
+	case metrics == nil:
+		out = append(out, fmt.Sprintf("%-11s %s", "Metrics", "loading..."))
+	default:
+		out = append(out, fmt.Sprintf("%-11s %s (last %d min)", "Metrics", metrics[inst.InstanceID].summary(), int(metricsWindow.Minutes())))
+	}
+	var tags []string
+	for key, value := range inst.Tags {
+		if key != "Name" {
+			tags = append(tags, key+"="+value)
+		}
+	}
+	if len(tags) > 0 {
+		sort.Strings(tags)
+		out = append(out, fmt.Sprintf("%-11s %s", "Tags", strings.Join(tags, ", ")))
+	}
+	for len(out) < lines {
+		out = append(out, "")
+	}
+	return out[:lines]
+}
+
+// withStderrDiscarded runs fn with stderr pointed at the null device.
+func withStderrDiscarded(fn func() ([]Instance, error)) ([]Instance, error) {
+	null, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		return fn()
+	}
+	defer null.Close()
+	stderr := os.Stderr
+	os.Stderr = null
+	defer func() { os.Stderr = stderr }()
+	return fn()
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tunnel is a port forwarding session running in the background, as recorded in
+// tunnels.json in the state directory.
+type tunnel struct {
+	ID         string    `json:"id"`
+	PID        int       `json:"pid"`
+	InstanceID string    `json:"instance_id"`
+	Name       string    `json:"name,omitempty"`
+	Profile    string    `json:"profile,omitempty"`
+	Region     string    `json:"region"`
+	Forwards   []string  `json:"forwards"`
+	Log        string    `json:"log"`
+	StartedAt  time.Time `json:"started_at"`
+}
+
+func tunnelsPath() (string, error) {
+	dir, err := stateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "tunnels.json"), nil
+}
+
+// loadTunnels returns the recorded background tunnels whose process is still running.
+// The others are dropped from the list the next time it is saved.
+func loadTunnels() ([]tunnel, error) {
+	path, err := tunnelsPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	var all []tunnel
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	var running []tunnel
+	for _, t := range all {
+		if t.running() {
+			running = append(running, t)
+		}
+	}
+	return running, nil
+}
+
+// running reports whether the tunnel's process is still running. A process that started
+// after the tunnel was recorded has merely been given its PID since, and must not be
+// stopped in its place; so must one whose start time can't be checked.
+func (t tunnel) running() bool {
+	if !processAlive(t.PID) {
+		return false
+	}
+	started, err := processStartTime(t.PID)
+	return err == nil && !started.After(t.StartedAt)
+}
+
+// saveTunnels replaces the recorded background tunnels.
+func saveTunnels(tunnels []tunnel) error {
+	path, err := tunnelsPath()
+	if err != nil {
+		return err
+	}
+	if tunnels == nil {
+		tunnels = []tunnel{}
+	}
+	data, err := json.MarshalIndent(tunnels, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("creating %s: %w", filepath.Dir(path), err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	return nil
+}
+
+// startBackgroundTunnel implements forward --background: the instance is chosen here,
+// interactively if need be, and the session itself runs in a detached copy of this program
+// that outlives the terminal. Its output goes to a log file next to tunnels.json.
+func startBackgroundTunnel(ctx context.Context, opts *options, forwards []portForward) int {
+	cfg, target, err := resolveTarget(ctx, opts)
+	if err != nil {
+		return targetErrorCode(err, opts)
+	}
+	if err := ensureRunning(ctx, cfg, opts, target); err != nil {
+		return targetErrorCode(err, opts)
+	}
+
+	args := []string{"forward"}
+	var specs []string
+	for _, forward := range forwards {
+		args = append(args, "-L", forward.String())
+		specs = append(specs, forward.String())
+	}
+	args = append(append(args, target.InstanceID), credentialArgs(opts, cfg.Region)...)
+	if opts.Reason != "" {
+		args = append(args, "--reason", opts.Reason)
+	}
+	if opts.Reconnect > 0 {
+		args = append(args, "--reconnect", strconv.Itoa(opts.Reconnect))
+	}
+	if opts.DryRun {
+		printDryRun("aws-ssm-connect", args...)
+		return exitOK
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		return reportError(fmt.Errorf("locating the aws-ssm-connect binary: %w", err))
+	}
+	id := newTunnelID()
+	dir, err := stateDir()
+	if err != nil {
+		return reportError(err)
+	}
+	logPath := filepath.Join(dir, "tunnels", id+".log")
+	if err := os.MkdirAll(filepath.Dir(logPath), 0o700); err != nil {
+		return reportError(fmt.Errorf("creating the tunnel log directory: %w", err))
+	}
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return reportError(fmt.Errorf("creating the tunnel log: %w", err))
+	}
+	defer logFile.Close()
+
+	debugCommand(self, args)
+	child, err := executor.Start(self, args, nil, logFile, logFile, true)
+	if err != nil {
+		return reportError(fmt.Errorf("starting the background tunnel: %w", err))
+	}
+	exited := make(chan struct{})
+	go func() {
+		child.Wait()
+		close(exited)
+	}()
+
+	// Wait for the local ports to open, so a broken tunnel is reported here and not when
+	// something first tries to use it.
+	waitCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	for _, forward := range forwards {
+		address := net.JoinHostPort("localhost", strconv.Itoa(forward.LocalPort))
+		ready := make(chan bool, 1)
+		go func() { ready <- waitForListener(waitCtx, address, 60*time.Second) }()
+		select {
+		case <-exited:
+			return reportError(withHints(fmt.Errorf("the background tunnel exited right away; see %s", logPath),
+				"Run the same forward command without --background to see the problem."))
+		case ok := <-ready:
+			if !ok {
+				stopProcess(child.Pid())
+				return reportError(fmt.Errorf("the tunnel on %s did not come up within a minute; see %s", address, logPath))
+			}
+		}
+	}
+
+	tunnels, err := loadTunnels()
+	if err != nil {
+		return reportError(err)
+	}
+	tunnels = append(tunnels, tunnel{
+		ID:         id,
+		PID:        child.Pid(),
+		InstanceID: target.InstanceID,
+		Name:       target.Name,
+		Profile:    opts.Profile,
+		Region:     cfg.Region,
+		Forwards:   specs,
+		Log:        logPath,
+		StartedAt:  time.Now(),
+	})
+	if err := saveTunnels(tunnels); err != nil {
+		return reportError(err)
+	}
+	recordHistory(opts, target)
+	child.Release()
+
+	fmt.Printf("\nTunnel %s (-L %s via %s) is running in the background (pid %d).\n", id, strings.Join(specs, ", -L "), target.InstanceID, child.Pid())
+	fmt.Printf("Stop it with 'aws-ssm-connect tunnels stop %s'.\n", id)
+	return exitOK
+}
+
+// newTunnelID returns a short random identifier for a background tunnel.
+func newTunnelID() string {
+	b := make([]byte, 3)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// runTunnels implements the tunnels command, listing and stopping the tunnels started
+// with forward --background.
+func runTunnels(ctx context.Context, args []string) int {
+	var opts options
+	var all bool
+	fs := newFlagSet(findCommand("tunnels"), &opts)
+	fs.BoolVar(&all, "all", false, "with stop: stop every background tunnel")
+
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return flagErrorCode(err)
+	}
+	tunnels, err := loadTunnels()
+	if err != nil {
+		return reportError(err)
+	}
+
+	switch {
+	case len(positional) == 0 || (positional[0] == "list" && len(positional) == 1):
+		// Dead tunnels were dropped while loading; forget them for good.
+		saveTunnels(tunnels)
+		if len(tunnels) == 0 {
+			fmt.Println("No background tunnels are running.")
+			return exitOK
+		}
+		fmt.Printf("%-8s %-8s %-40s %-12s %s\n", "ID", "PID", "FORWARDS", "STARTED", "INSTANCE")
+		for _, t := range tunnels {
+			instance := t.InstanceID
+			if t.Name != "" {
+				instance += " (" + t.Name + ")"
+			}
+			fmt.Printf("%-8s %-8d %-40s %-12s %s\n", t.ID, t.PID, strings.Join(t.Forwards, " "),
+				formatAge(time.Since(t.StartedAt)), instance)
+		}
+	case positional[0] == "stop" && (len(positional) == 2) != all:
+		var kept []tunnel
+		stopped := 0
+		for _, t := range tunnels {
+			if !all && t.ID != positional[1] {
+				kept = append(kept, t)
+				continue
+			}
+			if err := stopProcess(t.PID); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: stopping tunnel %s (pid %d): %v\n", t.ID, t.PID, err)
+				kept = append(kept, t)
+				continue
+			}
+			fmt.Printf("Stopped tunnel %s (-L %s).\n", t.ID, strings.Join(t.Forwards, ", -L "))
+			stopped++
+		}
+		if err := saveTunnels(kept); err != nil {
+			return reportError(err)
+		}
+		if stopped == 0 && !all {
+			return reportError(fmt.Errorf("no running tunnel '%s'; see 'aws-ssm-connect tunnels list'", positional[1]))
+		}
+	default:
+		fs.Usage()
+		return exitUsage
+	}
+	return exitOK
+}
+
+// tunnelIDs returns the IDs of the running background tunnels, for shell completion.
+func tunnelIDs() []string {
+	tunnels, _ := loadTunnels()
+	ids := make([]string, len(tunnels))
+	for i, t := range tunnels {
+		ids[i] = t.ID
+	}
+	return ids
+}
@@ -0,0 +1,40 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// detach starts cmd in a session of its own, so it keeps running when the terminal that
+// started it closes.
+func detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
+
+// processAlive reports whether a process with the given PID exists.
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// processStartTime returns when the process with the given PID started, to the second.
+func processStartTime(pid int) (time.Time, error) {
+	out, err := executor.Output(context.Background(), "ps", "-o", "lstart=", "-p", strconv.Itoa(pid))
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.ParseInLocation("Mon Jan _2 15:04:05 2006", strings.TrimSpace(string(out)), time.Local)
+}
+
+// stopProcess asks a background tunnel to end. It relays SIGTERM to the plugin, which
+// closes the session.
+func stopProcess(pid int) error {
+	return syscall.Kill(pid, syscall.SIGTERM)
+}
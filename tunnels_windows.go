@@ -0,0 +1,54 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	detachedProcess                = 0x00000008
+	processQueryLimitedInformation = 0x1000
+	stillActive                    = 259
+)
+
+// detach starts cmd without a console, so it keeps running when the one that started it
+// closes.
+func detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP | detachedProcess}
+}
+
+// processAlive reports whether a process with the given PID is still running.
+func processAlive(pid int) bool {
+	h, err := syscall.OpenProcess(processQueryLimitedInformation, false, uint32(pid))
+	if err != nil {
+		return false
+	}
+	defer syscall.CloseHandle(h)
+	var code uint32
+	return syscall.GetExitCodeProcess(h, &code) == nil && code == stillActive
+}
+
+// processStartTime returns when the process with the given PID started.
+func processStartTime(pid int) (time.Time, error) {
+	h, err := syscall.OpenProcess(processQueryLimitedInformation, false, uint32(pid))
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer syscall.CloseHandle(h)
+	var created, exited, kernel, user syscall.Filetime
+	if err := syscall.GetProcessTimes(h, &created, &exited, &kernel, &user); err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, created.Nanoseconds()), nil
+}
+
+// stopProcess ends a background tunnel together with its session-manager-plugin; Windows
+// has no signal to ask it to.
+func stopProcess(pid int) error {
+	return executor.Run(context.Background(), "taskkill", []string{"/T", "/F", "/PID", strconv.Itoa(pid)}, nil, nil, nil)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// latestReleaseURL is the GitHub API endpoint for the newest release of the tool.
+const latestReleaseURL = "https://api.github.com/repos/nkarisa/homebrew-aws-ssm-connect/releases/latest"
+
+// runVersion implements the version command: the version and build metadata to include in
+// bug reports and, with --check, whether a newer release is available.
+func runVersion(ctx context.Context, args []string) int {
+	var opts options
+	var check bool
+	fs := newFlagSet(findCommand("version"), &opts)
+	fs.BoolVar(&check, "check", false, "check GitHub for a newer release")
+
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return flagErrorCode(err)
+	}
+	if len(positional) > 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	fmt.Printf("aws-ssm-connect %s\n", version)
+	rev, built := buildInfo()
+	if rev != "" {
+		fmt.Printf("  commit:  %s\n", rev)
+	}
+	if built != "" {
+		fmt.Printf("  built:   %s\n", built)
+	}
+	fmt.Printf("  go:      %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+
+	if !check {
+		return exitOK
+	}
+	latest, err := latestRelease(ctx)
+	if err != nil {
+		return reportError(fmt.Errorf("checking for updates: %w", err))
+	}
+	switch {
+	case version == "dev":
+		fmt.Printf("\nThe latest release is %s; this is a development build.\n", latest)
+	case strings.TrimPrefix(latest, "v") != strings.TrimPrefix(version, "v"):
+		fmt.Printf("\nA newer release is available: %s. Upgrade with 'brew upgrade aws-ssm-connect'.\n", latest)
+	default:
+		fmt.Println("\nThis is the latest release.")
+	}
+	return exitOK
+}
+
+// buildInfo returns the commit and build date set with -ldflags or, failing that, the VCS
+// revision and commit time the Go toolchain records for builds from a checkout.
+func buildInfo() (rev, built string) {
+	rev, built = commit, date
+	if info, ok := debug.ReadBuildInfo(); ok {
+		modified := false
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if rev == "" {
+					rev = setting.Value
+				}
+			case "vcs.time":
+				if built == "" {
+					built = setting.Value
+				}
+			case "vcs.modified":
+				modified = setting.Value == "true"
+			}
+		}
+		if modified && commit == "" && rev != "" {
+			rev += " (modified)"
+		}
+	}
+	return rev, built
+}
+
+// latestRelease returns the tag of the newest GitHub release.
+func latestRelease(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, latestReleaseURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("GitHub returned %s", resp.Status)
+	}
+
+	var release struct {
+		TagName string `json:"tag_name"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return "", fmt.Errorf("decoding the GitHub response: %w", err)
+	}
+	return release.TagName, nil
+}
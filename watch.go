@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"golang.org/x/term"
+)
+
+// listingDiff is what changed between two fetches of the instance list.
+type listingDiff struct {
+	added map[string]bool // IDs that weren't in the previous listing
+	gone  []Instance      // instances that are no longer listed
+}
+
+// diffListings compares two listings by instance ID. With no previous listing nothing
+// counts as added.
+func diffListings(before, after []Instance) listingDiff {
+	if before == nil {
+		return listingDiff{}
+	}
+	diff := listingDiff{added: map[string]bool{}}
+	listed := map[string]bool{}
+	for _, inst := range after {
+		listed[inst.InstanceID] = true
+	}
+	previous := map[string]bool{}
+	for _, inst := range before {
+		previous[inst.InstanceID] = true
+		if !listed[inst.InstanceID] {
+			diff.gone = append(diff.gone, inst)
+		}
+	}
+	for _, inst := range after {
+		if !previous[inst.InstanceID] {
+			diff.added[inst.InstanceID] = true
+		}
+	}
+	return diff
+}
+
+// summary describes the diff in a few words, or returns "" when nothing changed.
+func (d listingDiff) summary() string {
+	if len(d.added) == 0 && len(d.gone) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d new (+), %d gone (-) since the last refresh", len(d.added), len(d.gone))
+}
+
+// watchList implements list --watch: fetch and print the table every interval until
+// interrupted, marking the instances that appeared (+) or disappeared (-) since the
+// previous fetch, e.g. while an Auto Scaling group scales or a deploy replaces hosts.
+func watchList(ctx context.Context, cfg aws.Config, opts *options, interval time.Duration) int {
+	// Plain output appends each table instead of redrawing the screen.
+	clear := !plainOutput && term.IsTerminal(int(os.Stdout.Fd()))
+	var previous []Instance
+	for {
+		instances, err := discoverInstances(ctx, cfg, opts)
+		if err != nil {
+			return reportError(err)
+		}
+		// The cache is only good for the first fetch.
+		opts.Refresh = true
+
+		diff := diffListings(previous, instances)
+		previous = instances
+		if clear {
+			fmt.Print("\033[H\033[2J")
+		}
+		fmt.Printf("Every %s, %d instances, at %s. Press Ctrl+C to stop.\n", interval, len(instances), time.Now().Format("15:04:05"))
+		if s := diff.summary(); s != "" {
+			fmt.Println(s)
+		}
+		fmt.Println()
+
+		cols := fitToTerminal(opts.tableColumns(), 2)
+		fmt.Println("  " + paintTableHeader(cols))
+		for _, inst := range instances {
+			mark := "  "
+			if diff.added[inst.InstanceID] {
+				mark = "+ "
+			}
+			fmt.Println(mark + paintInstanceRow(inst, cols))
+		}
+		for _, inst := range diff.gone {
+			fmt.Println("- " + paintInstanceRow(inst, cols))
+		}
+
+		select {
+		case <-ctx.Done():
+			return exitOK
+		case <-time.After(interval):
+		}
+	}
+}